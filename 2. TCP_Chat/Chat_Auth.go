@@ -0,0 +1,177 @@
+package main
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	passwordIterations = 210000         // PBKDF2 반복 횟수
+	tokenLifetime      = 24 * time.Hour // 로그인 토큰 유효 기간
+)
+
+// userRecord는 사용자 파일에 저장되는 한 사용자의 정보입니다.
+// 비밀번호는 평문 대신 솔트를 넣은 PBKDF2-SHA256 해시로만 보관합니다.
+type userRecord struct {
+	Salt       string `json:"salt"`
+	Hash       string `json:"hash"`
+	Iterations int    `json:"iterations"`
+}
+
+// session은 로그인에 성공한 사용자에게 발급한 토큰 정보입니다.
+type session struct {
+	user    string
+	expires time.Time
+}
+
+// UserDB는 사용자 목록과 발급한 로그인 토큰을 관리합니다.
+type UserDB struct {
+	mu     sync.Mutex
+	path   string
+	users  map[string]userRecord
+	tokens map[string]session
+}
+
+// LoadUserDB는 사용자 파일을 읽습니다. 파일이 없으면 빈 목록으로 시작합니다.
+func LoadUserDB(path string) (*UserDB, error) {
+	db := &UserDB{
+		path:   path,
+		users:  make(map[string]userRecord),
+		tokens: make(map[string]session),
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &db.users); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// AddUser는 사용자를 추가하거나 비밀번호를 바꾸고 파일에 저장합니다.
+func (db *UserDB) AddUser(name, password string) error {
+	if err := validateNick(name); err != nil {
+		return err
+	}
+	if len(password) < 8 {
+		return errors.New("비밀번호는 8자 이상이어야 합니다.")
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	hash, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, sha256.Size)
+	if err != nil {
+		return err
+	}
+	record := userRecord{
+		Salt:       hex.EncodeToString(salt),
+		Hash:       hex.EncodeToString(hash),
+		Iterations: passwordIterations,
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.users[name] = record
+
+	data, err := json.MarshalIndent(db.users, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(db.path, data, 0600)
+}
+
+// Authenticate는 사용자 이름과 비밀번호가 맞는지 확인합니다.
+func (db *UserDB) Authenticate(name, password string) bool {
+	db.mu.Lock()
+	record, ok := db.users[name]
+	db.mu.Unlock()
+	if !ok {
+		// 존재하지 않는 사용자도 같은 시간이 걸리도록 계산은 수행
+		pbkdf2.Key(sha256.New, password, []byte(name), passwordIterations, sha256.Size)
+		return false
+	}
+
+	salt, err := hex.DecodeString(record.Salt)
+	if err != nil {
+		return false
+	}
+	want, err := hex.DecodeString(record.Hash)
+	if err != nil {
+		return false
+	}
+	got, err := pbkdf2.Key(sha256.New, password, salt, record.Iterations, len(want))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// IssueToken은 재접속할 때 비밀번호 대신 쓸 수 있는 토큰을 발급합니다.
+func (db *UserDB) IssueToken(name string) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	now := time.Now()
+	for t, s := range db.tokens {
+		if now.After(s.expires) {
+			delete(db.tokens, t)
+		}
+	}
+	db.tokens[token] = session{user: name, expires: now.Add(tokenLifetime)}
+	return token, nil
+}
+
+// CheckToken은 토큰이 유효하면 해당 사용자 이름을 반환합니다.
+func (db *UserDB) CheckToken(token string) (string, bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	s, ok := db.tokens[token]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(s.expires) {
+		delete(db.tokens, token)
+		return "", false
+	}
+	return s.user, true
+}
+
+// RevokeTokens는 사용자에게 발급한 토큰을 모두 무효로 만듭니다.
+// 강제 퇴장당한 사용자가 토큰으로 바로 다시 로그인하지 못하게 할 때 씁니다.
+func (db *UserDB) RevokeTokens(name string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for t, s := range db.tokens {
+		if s.user == name {
+			delete(db.tokens, t)
+		}
+	}
+}
+
+// newToken은 추측할 수 없는 임의의 토큰 문자열을 만듭니다.
+func newToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -1,45 +1,910 @@
 package main
 
+// 실행 방법: go run Chat_Client.go Chat_Protocol.go Chat_TUI.go
+// TLS 서버 접속: go run Chat_Client.go Chat_Protocol.go Chat_TUI.go -tls -ca chat_cert.pem
+// 전체 화면 대신 줄 단위로 표시: -plain (Tab: 다음 방, PageUp/PageDown: 스크롤, Ctrl+C: 종료)
+// 파일 보내기: /send <닉네임> <경로>, 받기: /accept <전송ID>, 거절/취소: /reject, /cancel <전송ID>
+
 import (
 	"bufio"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"flag"
 	"fmt"
+	"hash"
+	"io"
+	"math/rand"
 	"net"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+)
+
+// 터미널 색상 (ANSI 이스케이프 코드)
+const (
+	colorReset   = "\033[0m"
+	colorSystem  = "\033[33m" // 서버 시스템 메시지: 노란색
+	colorPrivate = "\033[35m" // 귓속말: 보라색
+	colorError   = "\033[31m" // 오류: 빨간색
+	colorHistory = "\033[90m" // 지난 기록: 회색
+	colorFile    = "\033[36m" // 파일 전송: 청록색
+)
+
+// 재접속 대기 시간 (지수적으로 늘어남)
+const (
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
 )
 
 func main() {
+	addr := flag.String("addr", "localhost:8080", "서버 주소")
+	useTLS := flag.Bool("tls", false, "TLS로 접속")
+	caFile := flag.String("ca", "", "신뢰할 인증서 파일 (자체 서명 인증서용)")
+	insecure := flag.Bool("insecure", false, "서버 인증서를 검증하지 않음 (개발용)")
+	timeout := flag.Duration("timeout", 90*time.Second, "서버로부터 아무 프레임도 오지 않을 때 끊긴 것으로 보는 시간")
+	downloadDir := flag.String("downloads", ".", "받은 파일을 저장할 디렉터리")
+	plain := flag.Bool("plain", false, "전체 화면 TUI 대신 줄 단위로 출력")
+	flag.Parse()
+
+	connect := func() (*FrameConn, error) {
+		conn, err := dial(*addr, *useTLS, *caFile, *insecure)
+		if err != nil {
+			return nil, err
+		}
+		// 프로토콜 버전 협상
+		fc := NewFrameConn(conn)
+		if err := fc.Dial(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return fc, nil
+	}
+
 	// 서버에 연결
-	conn, err := net.Dial("tcp", "localhost:8080")
+	fc, err := connect()
 	if err != nil {
 		fmt.Println("서버 연결 실패:", err)
 		return
 	}
-	defer conn.Close()
-	fmt.Println("서버에 연결되었습니다. 메시지를 입력하세요.")
 
-	// 고루틴으로 수신 메시지 처리
-	go func() {
-		reader := bufio.NewReader(conn)
-		for {
-			message, err := reader.ReadString('\n')
-			if err != nil {
-				fmt.Println("서버 연결 종료")
-				os.Exit(0)
-			}
-			fmt.Print(message)
+	// 화면 준비 (터미널이 아니면 줄 단위 출력으로 대신함)
+	var view chatView = plainView{}
+	if !*plain {
+		tui, err := newTUIView()
+		if err != nil {
+			fmt.Println("전체 화면을 사용할 수 없어 줄 단위로 표시합니다:", err)
+		} else {
+			view = tui
 		}
-	}()
+	}
+	view.Show(Frame{Kind: KindSystem, Text: fmt.Sprintf("서버에 연결되었습니다. (프로토콜 v%d) 메시지를 입력하세요.", fc.Version)})
+
+	session := newChatSession(fc, *downloadDir, view)
+	defer session.Close()
+
+	// 고루틴으로 수신 메시지 처리 (연결이 끊기면 재접속)
+	go session.readLoop(connect, *timeout)
 
-	// 사용자 입력 처리
+	// 사용자 입력 처리 ("exit" 또는 입력 끝까지)
+	view.Run(session.Send)
+	view.Close()
+	fmt.Println("연결을 종료합니다.")
+}
+
+// chatView는 메시지를 화면에 보여 주고 사용자 입력을 받는 방식입니다.
+// 줄 단위 출력(plainView)과 전체 화면 TUI(tuiView)가 있습니다.
+// Show, Notice, SetRooms는 세션의 잠금을 잡은 채로 호출될 수 있으므로 오래 막히면 안 됩니다.
+type chatView interface {
+	Show(frame Frame)                              // 서버에서 온 프레임이나 로컬 안내/오류 표시
+	Notice(format string, args ...any)             // 파일 전송 같은 로컬 진행 상황 표시
+	SetRooms(nick, current string, rooms []string) // 닉네임이나 참여 중인 방이 바뀌었을 때 호출
+	Run(input func(text string))                   // 사용자가 끝낼 때까지 입력을 받아 input에 넘김
+	Close()
+}
+
+// plainView는 받은 메시지를 터미널에 한 줄씩 출력하는 예전 방식입니다.
+type plainView struct{}
+
+func (plainView) Show(frame Frame)                  { printFrame(frame) }
+func (plainView) Notice(format string, args ...any) { printFileNotice(format, args...) }
+func (plainView) SetRooms(string, string, []string) {}
+func (plainView) Close()                            {}
+
+func (plainView) Run(input func(text string)) {
 	scanner := bufio.NewScanner(os.Stdin)
 	for scanner.Scan() {
 		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
 		if text == "exit" {
-			fmt.Println("연결을 종료합니다.")
 			break
 		}
-		// 서버로 메시지 전송
-		conn.Write([]byte(text + "\n"))
+		input(text)
+	}
+}
+
+// chatSession은 현재 연결과, 재접속한 뒤 복원해야 하는 상태를 함께 관리합니다.
+type chatSession struct {
+	mu      sync.Mutex
+	view    chatView
+	fc      *FrameConn // 현재 연결 (재접속 중에는 nil)
+	nextID  int
+	pending map[string]string // 응답을 기다리는 명령 (요청 ID -> 명령)
+	outbox  []string          // 재접속 중에 입력된 메시지
+
+	kicked bool // 운영자가 내보내 다시 접속하지 않음
+
+	nick     string
+	token    string // 재접속할 때 닉네임/로그인을 되찾는 토큰
+	loggedIn bool   // /login 으로 등록했는지 여부
+	autoRoom string // 등록할 때 서버가 자동으로 넣어 준 방
+	rooms    map[string]bool
+	current  string
+	lastSeen map[string]uint64 // 방마다 마지막으로 받은 메시지 ID
+
+	downloadDir string
+	offers      map[string]*fileTransfer // 서버의 응답을 기다리는 파일 제안 (요청 ID -> 전송)
+	transfers   map[string]*fileTransfer // 진행 중인 파일 전송 (전송 ID -> 전송)
+}
+
+func newChatSession(fc *FrameConn, downloadDir string, view chatView) *chatSession {
+	return &chatSession{
+		view:        view,
+		fc:          fc,
+		pending:     make(map[string]string),
+		rooms:       make(map[string]bool),
+		lastSeen:    make(map[string]uint64),
+		downloadDir: downloadDir,
+		offers:      make(map[string]*fileTransfer),
+		transfers:   make(map[string]*fileTransfer),
+	}
+}
+
+// Send는 사용자가 입력한 한 줄을 서버로 보냅니다.
+// 재접속 중이면 보관했다가 연결이 복구된 뒤 보냅니다.
+func (s *chatSession) Send(text string) {
+	if s.fileCommand(text) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.kicked {
+		s.view.Show(Frame{Kind: KindError, Text: "서버에서 내보내져 연결이 끊어졌습니다. exit 로 종료하세요."})
+		return
+	}
+	if s.fc == nil {
+		s.outbox = append(s.outbox, text)
+		s.view.Show(Frame{Kind: KindSystem, Text: "재접속 중입니다. 연결되면 전송합니다."})
+		return
+	}
+	if err := s.sendLocked(text); err != nil {
+		s.view.Show(Frame{Kind: KindError, Text: "메시지 전송 실패: " + err.Error()})
+	}
+}
+
+// sendLocked는 한 줄을 프레임으로 만들어 보냅니다. s.mu를 잡은 상태에서 호출합니다.
+func (s *chatSession) sendLocked(text string) error {
+	s.nextID++
+	frame := Frame{Kind: KindChat, ID: "c" + strconv.Itoa(s.nextID), Text: text}
+	if strings.HasPrefix(text, "/") {
+		frame.Kind = KindCommand
+		s.pending[frame.ID] = text
+	}
+	return s.fc.WriteFrame(frame)
+}
+
+// Close는 현재 연결을 닫습니다.
+func (s *chatSession) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fc != nil {
+		s.fc.conn.Close()
+	}
+}
+
+// readLoop는 서버에서 오는 프레임을 처리합니다.
+// 연결이 끊기면 지수 백오프로 재접속하고, 닉네임과 참여 중인 방을 복원합니다.
+// 운영자가 내보낸 경우(kicked 프레임)에는 다시 접속하지 않습니다.
+func (s *chatSession) readLoop(connect func() (*FrameConn, error), timeout time.Duration) {
+	s.mu.Lock()
+	fc := s.fc
+	s.mu.Unlock()
+
+	for {
+		for {
+			// ping을 보내는 서버라면 제한 시간 안에 반드시 무언가 와야 함
+			if fc.Version >= 4 {
+				fc.conn.SetReadDeadline(time.Now().Add(timeout))
+			}
+			frame, err := fc.ReadFrame()
+			if err != nil {
+				break
+			}
+			s.handleFrame(fc, frame)
+		}
+
+		s.mu.Lock()
+		s.fc = nil
+		s.pending = make(map[string]string)
+		s.abortTransfers("서버와의 연결이 끊어졌습니다.")
+		kicked := s.kicked
+		s.mu.Unlock()
+		fc.conn.Close()
+
+		if kicked {
+			s.view.Show(Frame{Kind: KindError, Text: "서버에서 내보내져 다시 접속하지 않습니다. exit 로 종료하세요."})
+			return
+		}
+
+		s.view.Show(Frame{Kind: KindError, Text: "서버와의 연결이 끊어졌습니다. 재접속을 시도합니다..."})
+		fc = reconnect(connect, s.view)
+		s.view.Show(Frame{Kind: KindSystem, Text: "재접속되었습니다."})
+		s.restore(fc)
+	}
+}
+
+// reconnect는 접속에 성공할 때까지 대기 시간을 두 배씩 늘려 가며 다시 시도합니다.
+func reconnect(connect func() (*FrameConn, error), view chatView) *FrameConn {
+	backoff := minBackoff
+	for {
+		// 여러 클라이언트가 동시에 몰리지 않도록 대기 시간을 조금씩 흩뜨림
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff)))
+		time.Sleep(wait)
+
+		fc, err := connect()
+		if err == nil {
+			return fc
+		}
+		view.Show(Frame{Kind: KindError, Text: fmt.Sprintf("재접속 실패: %v (%s 후 다시 시도)", err, backoff)})
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// restore는 새 연결에서 예전 닉네임(또는 로그인)과 방을 되찾고, 밀린 메시지를 보냅니다.
+// 서버는 한 연결의 요청을 순서대로 처리하므로 응답을 기다리지 않고 차례로 보냅니다.
+func (s *chatSession) restore(fc *FrameConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fc = fc
+
+	var commands []string
+	if s.token != "" {
+		if s.loggedIn {
+			commands = append(commands, "/login "+s.token)
+		} else {
+			commands = append(commands, "/nick "+s.nick+" "+s.token)
+		}
+
+		rooms := make([]string, 0, len(s.rooms))
+		for room := range s.rooms {
+			if room != s.current {
+				rooms = append(rooms, room)
+			}
+		}
+		sort.Strings(rooms)
+		for _, room := range rooms {
+			commands = append(commands, "/join "+room)
+		}
+		if s.autoRoom != "" && !s.rooms[s.autoRoom] {
+			commands = append(commands, "/leave "+s.autoRoom)
+		}
+		// 마지막으로 현재 방에 입장해 대화 대상 방을 맞춤
+		if s.current != "" {
+			commands = append(commands, "/join "+s.current)
+		}
+	}
+	commands = append(commands, s.outbox...)
+	s.outbox = nil
+
+	for _, text := range commands {
+		if err := s.sendLocked(text); err != nil {
+			return
+		}
+	}
+}
+
+// handleFrame은 서버에서 온 프레임 하나를 처리합니다.
+func (s *chatSession) handleFrame(fc *FrameConn, frame Frame) {
+	switch frame.Kind {
+	case KindPing:
+		fc.WriteFrame(Frame{Kind: KindPong})
+		return
+	case KindAck:
+		if s.offerAccepted(frame) {
+			return
+		}
+		s.applyAck(frame)
+	case KindError:
+		s.mu.Lock()
+		delete(s.pending, frame.Ref)
+		s.offerFailed(frame.Ref)
+		s.mu.Unlock()
+	case KindKicked:
+		s.mu.Lock()
+		s.kicked = true
+		s.mu.Unlock()
+	case KindFileOffer, KindFileAccept, KindFileChunk, KindFileProgress, KindFileDone, KindFileCancel:
+		s.handleFileFrame(fc, frame)
+		return
+	case KindChat:
+		if frame.Room != "" && !s.markSeen(frame) {
+			// 재접속 후 다시 받은 기록 중 이미 본 메시지
+			return
+		}
+	}
+	s.view.Show(frame)
+}
+
+// markSeen은 방 메시지의 ID를 기록합니다. 이미 본 기록 메시지면 false를 반환합니다.
+func (s *chatSession) markSeen(frame Frame) bool {
+	id, err := strconv.ParseUint(frame.ID, 10, 64)
+	if err != nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if frame.History && id <= s.lastSeen[frame.Room] {
+		return false
+	}
+	if id > s.lastSeen[frame.Room] {
+		s.lastSeen[frame.Room] = id
+	}
+	return true
+}
+
+// applyAck은 명령에 대한 응답을 보고 닉네임과 참여 중인 방 상태를 갱신합니다.
+func (s *chatSession) applyAck(frame Frame) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	command, ok := s.pending[frame.Ref]
+	if !ok {
+		return
+	}
+	delete(s.pending, frame.Ref)
+
+	fields := strings.Fields(command)
+	switch fields[0] {
+	case "/nick", "/login":
+		s.nick = frame.From
+		s.token = frame.Token
+		s.loggedIn = fields[0] == "/login"
+		if frame.Room != "" {
+			// 처음 등록되면서 서버가 자동으로 입장시킨 방
+			s.autoRoom = frame.Room
+			s.rooms[frame.Room] = true
+			s.current = frame.Room
+		}
+	case "/join":
+		s.rooms[frame.Room] = true
+		s.current = frame.Room
+	case "/leave":
+		delete(s.rooms, frame.Room)
+		if s.current == frame.Room {
+			s.current = ""
+			for room := range s.rooms {
+				s.current = room
+				break
+			}
+		}
+	}
+	s.view.SetRooms(s.nick, s.current, s.roomNames())
+}
+
+// roomNames는 참여 중인 방 이름을 정렬해 반환합니다. s.mu를 잡은 상태에서 호출합니다.
+func (s *chatSession) roomNames() []string {
+	rooms := make([]string, 0, len(s.rooms))
+	for room := range s.rooms {
+		rooms = append(rooms, room)
+	}
+	sort.Strings(rooms)
+	return rooms
+}
+
+// fileTransfer는 이 클라이언트가 보내거나 받는 파일 하나입니다.
+type fileTransfer struct {
+	id      string // 서버가 부여한 전송 ID
+	peer    string // 상대방 닉네임
+	name    string
+	size    int64
+	hash    string // 보내는 쪽이 계산한 SHA-256 (16진수)
+	sending bool
+	file    *os.File // 보낼 원본 또는 받는 중인 임시(.part) 파일
+	path    string   // 받은 파일을 저장할 경로
+
+	accepted bool
+	received int64     // 받는 쪽: 지금까지 받은 크기
+	hasher   hash.Hash // 받는 쪽: 받은 내용의 SHA-256
+	reported int64     // 마지막으로 표시한 진행률 (10% 단위)
+
+	progress chan int64    // 보내는 쪽: 받는 쪽이 확인한 크기 (최신 값 하나만 유지)
+	stop     chan struct{} // 전송을 그만둘 때 닫힘
+}
+
+// fileCommand는 파일 전송 명령(/send, /accept, /reject, /cancel)을 처리합니다.
+// 서버로 보낼 일반 입력이면 false를 반환합니다.
+func (s *chatSession) fileCommand(text string) bool {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return false
+	}
+	switch fields[0] {
+	case "/send":
+		// 경로의 공백을 보존하기 위해 닉네임 뒤는 그대로 사용
+		rest := strings.TrimSpace(strings.TrimPrefix(text, "/send"))
+		to, path, ok := strings.Cut(rest, " ")
+		path = strings.TrimSpace(path)
+		if !ok || path == "" {
+			s.view.Show(Frame{Kind: KindError, Text: "사용법: /send <닉네임> <경로>"})
+			return true
+		}
+		s.offerFile(to, path)
+	case "/accept":
+		if len(fields) != 2 {
+			s.view.Show(Frame{Kind: KindError, Text: "사용법: /accept <전송ID>"})
+			return true
+		}
+		s.acceptFile(fields[1])
+	case "/reject", "/cancel":
+		if len(fields) != 2 {
+			s.view.Show(Frame{Kind: KindError, Text: fmt.Sprintf("사용법: %s <전송ID>", fields[0])})
+			return true
+		}
+		reason := "취소했습니다."
+		if fields[0] == "/reject" {
+			reason = "거절했습니다."
+		}
+		s.cancelFile(fields[1], reason)
+	default:
+		return false
+	}
+	return true
+}
+
+// offerFile은 파일의 SHA-256을 계산한 뒤 상대에게 전송을 제안합니다.
+func (s *chatSession) offerFile(to, path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		s.view.Show(Frame{Kind: KindError, Text: "파일을 열 수 없습니다: " + err.Error()})
+		return
+	}
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() || info.Size() == 0 {
+		file.Close()
+		s.view.Show(Frame{Kind: KindError, Text: "보낼 수 있는 파일이 아닙니다: " + path})
+		return
+	}
+
+	// 받는 쪽이 검증할 수 있도록 보내기 전에 전체 해시를 계산
+	hasher := sha256.New()
+	if _, err := io.CopyN(hasher, file, info.Size()); err != nil {
+		file.Close()
+		s.view.Show(Frame{Kind: KindError, Text: "파일 읽기 실패: " + err.Error()})
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		s.view.Show(Frame{Kind: KindError, Text: "파일 읽기 실패: " + err.Error()})
+		return
+	}
+	t := &fileTransfer{
+		peer:     to,
+		name:     filepath.Base(path),
+		size:     info.Size(),
+		hash:     hex.EncodeToString(hasher.Sum(nil)),
+		sending:  true,
+		file:     file,
+		progress: make(chan int64, 1),
+		stop:     make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fc == nil {
+		file.Close()
+		s.view.Show(Frame{Kind: KindError, Text: "재접속 중에는 파일을 보낼 수 없습니다."})
+		return
+	}
+	s.nextID++
+	id := "c" + strconv.Itoa(s.nextID)
+	s.offers[id] = t
+	offer := Frame{Kind: KindFileOffer, ID: id, To: to, Name: t.name, Size: t.size, Hash: t.hash}
+	if err := s.fc.WriteFrame(offer); err != nil {
+		delete(s.offers, id)
+		file.Close()
+		s.view.Show(Frame{Kind: KindError, Text: "메시지 전송 실패: " + err.Error()})
+	}
+}
+
+// offerAccepted는 파일 제안에 대한 서버의 응답이면 전송 ID를 기록하고 true를 반환합니다.
+func (s *chatSession) offerAccepted(frame Frame) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.offers[frame.Ref]
+	if !ok {
+		return false
+	}
+	delete(s.offers, frame.Ref)
+	t.id = frame.ID
+	s.transfers[t.id] = t
+	s.view.Notice("%s 님에게 %s (%s) 전송을 제안했습니다. 수락을 기다립니다. (전송 ID: %s)",
+		t.peer, t.name, formatSize(t.size), t.id)
+	return true
+}
+
+// offerFailed는 서버가 거절한 파일 제안을 정리합니다. s.mu를 잡은 상태에서 호출합니다.
+func (s *chatSession) offerFailed(ref string) {
+	if t, ok := s.offers[ref]; ok {
+		delete(s.offers, ref)
+		t.file.Close()
+	}
+}
+
+// acceptFile은 받은 제안을 수락하고 내려받을 임시 파일을 만듭니다.
+func (s *chatSession) acceptFile(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := s.transfers[id]
+	if t == nil || t.sending || t.accepted || s.fc == nil {
+		s.view.Show(Frame{Kind: KindError, Text: "수락할 수 있는 파일 전송이 없습니다: " + id})
+		return
+	}
+	path, file, err := createDownload(s.downloadDir, t.name)
+	if err != nil {
+		s.view.Show(Frame{Kind: KindError, Text: "파일을 만들 수 없습니다: " + err.Error()})
+		return
+	}
+	t.path = path
+	t.file = file
+	t.hasher = sha256.New()
+	t.accepted = true
+	if err := s.fc.WriteFrame(Frame{Kind: KindFileAccept, Transfer: id}); err != nil {
+		s.closeTransfer(t, false)
+		s.view.Show(Frame{Kind: KindError, Text: "메시지 전송 실패: " + err.Error()})
+		return
+	}
+	s.view.Notice("%s 을(를) 받는 중입니다. 저장 위치: %s", t.name, path)
+}
+
+// cancelFile은 진행 중이거나 대기 중인 전송을 거절/취소합니다.
+func (s *chatSession) cancelFile(id, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := s.transfers[id]
+	if t == nil {
+		s.view.Show(Frame{Kind: KindError, Text: "진행 중인 파일 전송이 없습니다: " + id})
+		return
+	}
+	if s.fc != nil {
+		s.fc.WriteFrame(Frame{Kind: KindFileCancel, Transfer: id, Text: reason})
+	}
+	s.closeTransfer(t, false)
+	s.view.Notice("%s 전송을 %s", t.name, reason)
+}
+
+// handleFileFrame은 서버가 중계한 파일 전송 프레임을 처리합니다.
+func (s *chatSession) handleFileFrame(fc *FrameConn, frame Frame) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if frame.Kind == KindFileOffer {
+		s.transfers[frame.Transfer] = &fileTransfer{
+			id:   frame.Transfer,
+			peer: frame.From,
+			name: frame.Name,
+			size: frame.Size,
+			hash: frame.Hash,
+			stop: make(chan struct{}),
+		}
+		s.view.Notice("%s 님이 파일을 보내려고 합니다: %s (%s)", frame.From, frame.Name, formatSize(frame.Size))
+		s.view.Notice("받으려면 /accept %s, 거절하려면 /reject %s", frame.Transfer, frame.Transfer)
+		return
+	}
+
+	t := s.transfers[frame.Transfer]
+	if t == nil {
+		// 이미 취소한 전송에 대해 늦게 도착한 프레임
+		return
+	}
+	switch frame.Kind {
+	case KindFileAccept:
+		if !t.sending || t.accepted {
+			return
+		}
+		t.accepted = true
+		s.view.Notice("%s 님이 %s 을(를) 수락했습니다. 전송을 시작합니다.", t.peer, t.name)
+		go s.sendFile(fc, t)
+
+	case KindFileChunk:
+		if t.sending || !t.accepted || frame.Offset != t.received || t.received+int64(len(frame.Data)) > t.size {
+			s.failTransfer(fc, t, "잘못된 파일 조각을 받았습니다.")
+			return
+		}
+		if _, err := t.file.Write(frame.Data); err != nil {
+			s.failTransfer(fc, t, "파일 저장 실패: "+err.Error())
+			return
+		}
+		t.hasher.Write(frame.Data)
+		t.received += int64(len(frame.Data))
+		// 보내는 쪽은 이 확인을 받아야 다음 조각을 보낼 수 있음
+		fc.WriteFrame(Frame{Kind: KindFileProgress, Transfer: t.id, Offset: t.received})
+		t.report(s.view, t.received)
+
+	case KindFileProgress:
+		if !t.sending {
+			return
+		}
+		t.report(s.view, frame.Offset)
+		// 읽는 고루틴은 이 고루틴 하나뿐이므로, 오래된 값을 비우면 바로 넣을 수 있음
+		select {
+		case <-t.progress:
+		default:
+		}
+		t.progress <- frame.Offset
+
+	case KindFileDone:
+		if t.sending {
+			s.closeTransfer(t, true)
+			s.view.Notice("%s 전송을 마쳤습니다. %s 님이 SHA-256을 확인했습니다.", t.name, t.peer)
+			return
+		}
+		s.verifyFile(fc, t)
+
+	case KindFileCancel:
+		s.closeTransfer(t, false)
+		reason := frame.Text
+		if frame.From != "" {
+			reason = fmt.Sprintf("%s 님이 %s", frame.From, reason)
+		}
+		s.view.Show(Frame{Kind: KindError, Text: fmt.Sprintf("%s 전송이 중단되었습니다: %s", t.name, reason), Time: frame.Time})
+	}
+}
+
+// verifyFile은 다 받은 파일의 SHA-256을 확인한 뒤 임시 파일을 원래 이름으로 바꿉니다.
+func (s *chatSession) verifyFile(fc *FrameConn, t *fileTransfer) {
+	sum := hex.EncodeToString(t.hasher.Sum(nil))
+	if t.received != t.size || sum != t.hash {
+		s.failTransfer(fc, t, "SHA-256이 일치하지 않습니다. 파일이 손상되었습니다.")
+		return
+	}
+
+	partial := t.file.Name()
+	if err := t.file.Close(); err != nil {
+		s.failTransfer(fc, t, "파일 저장 실패: "+err.Error())
+		return
+	}
+	t.file = nil
+	if err := os.Rename(partial, t.path); err != nil {
+		os.Remove(partial)
+		s.failTransfer(fc, t, "파일 저장 실패: "+err.Error())
+		return
+	}
+	fc.WriteFrame(Frame{Kind: KindFileDone, Transfer: t.id, Hash: sum})
+	s.closeTransfer(t, true)
+	s.view.Notice("%s 님에게서 %s 을(를) 받았습니다: %s (SHA-256 확인)", t.peer, t.name, t.path)
+}
+
+// sendFile은 수락된 파일을 조각으로 나눠 보냅니다.
+// 받는 쪽이 확인한 위치보다 fileWindow개 조각 이상 앞서지 않도록 기다리므로
+// 파일을 보내는 동안에도 다른 메시지가 조각 뒤에 오래 밀리지 않습니다.
+func (s *chatSession) sendFile(fc *FrameConn, t *fileTransfer) {
+	buf := make([]byte, fileChunkSize)
+	var sent, acked int64
+	for sent < t.size {
+		for sent-acked >= fileWindow*fileChunkSize {
+			select {
+			case acked = <-t.progress:
+			case <-t.stop:
+				return
+			}
+		}
+		select {
+		case <-t.stop:
+			return
+		default:
+		}
+
+		n := int64(len(buf))
+		if remaining := t.size - sent; remaining < n {
+			n = remaining
+		}
+		if _, err := io.ReadFull(t.file, buf[:n]); err != nil {
+			s.abortSend(fc, t, "파일 읽기 실패: "+err.Error())
+			return
+		}
+		if err := fc.WriteFrame(Frame{Kind: KindFileChunk, Transfer: t.id, Offset: sent, Data: buf[:n]}); err != nil {
+			// 연결이 끊기면 readLoop가 전송을 정리함
+			return
+		}
+		sent += n
+	}
+	fc.WriteFrame(Frame{Kind: KindFileDone, Transfer: t.id, Hash: t.hash})
+}
+
+// abortSend는 보내는 도중 실패한 전송을 취소합니다. 이미 정리된 전송이면 무시합니다.
+func (s *chatSession) abortSend(fc *FrameConn, t *fileTransfer, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.transfers[t.id] != t {
+		return
+	}
+	s.failTransfer(fc, t, reason)
+}
+
+// failTransfer는 상대에게 취소를 알리고 전송을 정리합니다. s.mu를 잡은 상태에서 호출합니다.
+func (s *chatSession) failTransfer(fc *FrameConn, t *fileTransfer, reason string) {
+	fc.WriteFrame(Frame{Kind: KindFileCancel, Transfer: t.id, Text: reason})
+	s.closeTransfer(t, false)
+	s.view.Show(Frame{Kind: KindError, Text: fmt.Sprintf("%s 전송 실패: %s", t.name, reason)})
+}
+
+// closeTransfer는 전송을 목록에서 지우고 파일을 닫습니다.
+// 다 받지 못한 파일은 임시 파일을 지웁니다. s.mu를 잡은 상태에서 호출합니다.
+func (s *chatSession) closeTransfer(t *fileTransfer, completed bool) {
+	delete(s.transfers, t.id)
+	close(t.stop)
+	if t.file == nil {
+		return
+	}
+	t.file.Close()
+	if !t.sending && !completed {
+		os.Remove(t.file.Name())
+	}
+}
+
+// abortTransfers는 연결이 끊겼을 때 모든 전송을 정리합니다. s.mu를 잡은 상태에서 호출합니다.
+// 서버도 연결이 끊긴 쪽의 전송을 정리하므로 재접속한 뒤에는 처음부터 다시 보내야 합니다.
+func (s *chatSession) abortTransfers(reason string) {
+	for ref, t := range s.offers {
+		delete(s.offers, ref)
+		t.file.Close()
+	}
+	for _, t := range s.transfers {
+		s.closeTransfer(t, false)
+		s.view.Show(Frame{Kind: KindError, Text: fmt.Sprintf("%s 전송이 중단되었습니다: %s", t.name, reason)})
+	}
+}
+
+// report는 전송 진행률이 10% 넘어갈 때마다 표시합니다.
+func (t *fileTransfer) report(view chatView, done int64) {
+	step := done * 10 / t.size
+	if step <= t.reported {
+		return
+	}
+	t.reported = step
+	direction := "받는 중"
+	if t.sending {
+		direction = "보내는 중"
+	}
+	view.Notice("%s %s: %d%% (%s / %s)", t.name, direction, step*10, formatSize(done), formatSize(t.size))
+}
+
+// createDownload는 받을 파일의 저장 경로를 정하고 임시(.part) 파일을 만듭니다.
+// 상대가 보낸 이름에서 디렉터리 부분은 버리고, 같은 이름이 있으면 번호를 붙입니다.
+func createDownload(dir, name string) (string, *os.File, error) {
+	name = filepath.Base(filepath.Clean("/" + name))
+	if name == "/" || name == "." || name == ".." {
+		name = "download"
+	}
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+
+	for i := 0; i < 1000; i++ {
+		candidate := name
+		if i > 0 {
+			candidate = fmt.Sprintf("%s (%d)%s", stem, i, ext)
+		}
+		path := filepath.Join(dir, candidate)
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		file, err := os.OpenFile(path+".part", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		return path, file, nil
+	}
+	return "", nil, errors.New("저장할 파일 이름을 정할 수 없습니다: " + name)
+}
+
+// dial은 서버에 접속합니다. useTLS가 참이면 TLS로 접속하고,
+// caFile이 있으면 그 인증서를 신뢰할 인증 기관으로 추가합니다.
+func dial(addr string, useTLS bool, caFile string, insecure bool) (net.Conn, error) {
+	if !useTLS {
+		return net.Dial("tcp", addr)
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: insecure}
+	if caFile != "" {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.New("인증서 파일을 읽을 수 없습니다: " + caFile)
+		}
+		config.RootCAs = pool
+	}
+	return tls.Dial("tcp", addr, config)
+}
+
+// printFrame은 프레임 종류에 따라 색을 달리해 출력합니다.
+func printFrame(frame Frame) {
+	stamp := formatTime(frame.Time)
+	switch frame.Kind {
+	case KindChat:
+		if frame.To != "" {
+			fmt.Printf("%s%s[귓속말] %s -> %s: %s%s\n", colorPrivate, stamp, frame.From, frame.To, frame.Text, colorReset)
+			return
+		}
+		if frame.History {
+			fmt.Printf("%s%s[%s] %s: %s%s\n", colorHistory, stamp, frame.Room, frame.From, frame.Text, colorReset)
+			return
+		}
+		fmt.Printf("%s[%s] %s: %s\n", stamp, frame.Room, frame.From, frame.Text)
+	case KindSystem:
+		text := frame.Text
+		if frame.Room != "" {
+			text = fmt.Sprintf("[%s] %s", frame.Room, text)
+		}
+		fmt.Printf("%s%s*** %s%s\n", colorSystem, stamp, text, colorReset)
+	case KindError:
+		fmt.Printf("%s%s*** 오류: %s%s\n", colorError, stamp, frame.Text, colorReset)
+	case KindKicked:
+		fmt.Printf("%s%s*** %s%s\n", colorError, stamp, frame.Text, colorReset)
+	case KindAck, KindMembers:
+		// 전송 확인과 참여자 목록은 따로 표시하지 않음
+	default:
+		fmt.Printf("%s*** 알 수 없는 프레임: %s%s\n", colorError, frame.Kind, colorReset)
+	}
+}
+
+// printFileNotice는 파일 전송 안내를 출력합니다.
+func printFileNotice(format string, args ...any) {
+	fmt.Printf("%s*** %s%s\n", colorFile, fmt.Sprintf(format, args...), colorReset)
+}
+
+// formatSize는 바이트 수를 읽기 쉬운 단위로 바꿉니다.
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	value := float64(n)
+	for _, suffix := range []string{"KB", "MB", "GB"} {
+		value /= unit
+		if value < unit || suffix == "GB" {
+			return fmt.Sprintf("%.1f%s", value, suffix)
+		}
+	}
+	return ""
+}
+
+// formatTime은 프레임의 시각을 "15:04 " 형식으로 바꿉니다.
+func formatTime(value string) string {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return ""
 	}
+	return t.Local().Format("15:04 ")
 }
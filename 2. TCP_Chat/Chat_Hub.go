@@ -0,0 +1,668 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	defaultRoom   = "lobby" // 닉네임 등록 직후 자동으로 입장하는 방
+	maxNickLength = 16
+	maxHistory    = 200 // /history 로 한 번에 볼 수 있는 최대 메시지 수
+)
+
+// Client는 허브에 연결된 하나의 TCP 접속을 나타냅니다.
+// nick, rooms, room 필드는 허브 고루틴에서만 접근합니다.
+type Client struct {
+	fc    *FrameConn
+	send  chan Frame      // 클라이언트에게 보낼 프레임 큐
+	nick  string          // 등록된 닉네임 (등록 전에는 빈 문자열)
+	token string          // 재접속할 때 닉네임을 되찾는 데 쓰는 토큰
+	op    bool            // 운영자 여부
+	rooms map[string]bool // 참여 중인 방 목록
+	room  string          // 현재 대화 중인 방
+}
+
+// NewClient는 연결에 대한 새 클라이언트를 생성합니다.
+func NewClient(fc *FrameConn) *Client {
+	return &Client{
+		fc:    fc,
+		send:  make(chan Frame, maxHistory+64), // 기록 재전송이 한 번에 들어갈 수 있는 크기
+		rooms: make(map[string]bool),
+	}
+}
+
+// Name은 메시지에 표시할 클라이언트 이름을 반환합니다.
+func (c *Client) Name() string {
+	if c.nick != "" {
+		return c.nick
+	}
+	return c.fc.conn.RemoteAddr().String()
+}
+
+// roomRequest는 방 입장/퇴장 요청입니다.
+type roomRequest struct {
+	client *Client
+	room   string
+	ref    string // 요청 프레임 ID
+}
+
+// roomMessage는 방에 전달할 채팅 메시지입니다.
+type roomMessage struct {
+	client *Client
+	room   string // 비어 있으면 현재 방
+	text   string
+	ref    string
+}
+
+// nickRequest는 닉네임 등록/변경 요청입니다.
+type nickRequest struct {
+	client *Client
+	nick   string
+	token  string // 재접속한 클라이언트가 예전 연결의 닉네임을 되찾을 때 사용
+	ref    string
+}
+
+// loginRequest는 인증을 마친 사용자를 허브에 알리는 요청입니다.
+type loginRequest struct {
+	client *Client
+	user   string
+	token  string // 재접속용으로 발급한 토큰
+	ref    string
+}
+
+// historyRequest는 방의 지난 메시지 조회 요청입니다.
+type historyRequest struct {
+	client *Client
+	count  int
+	ref    string
+}
+
+// privateMessage는 특정 사용자에게 보내는 귓속말입니다.
+type privateMessage struct {
+	from *Client
+	to   string
+	text string
+	ref  string
+}
+
+// Hub는 모든 연결과 방을 관리하는 중앙 고루틴입니다.
+type Hub struct {
+	clients map[*Client]bool
+	nicks   map[string]*Client // 소문자 닉네임 -> 클라이언트
+	rooms   map[string]map[*Client]bool
+	nextID  uint64 // 마지막으로 부여한 메시지 ID
+	store   MessageStore
+	replay  int // 방에 입장할 때 다시 보내 줄 최근 메시지 수
+
+	// users가 있으면 /nick 대신 /login 으로 인증해야 하고,
+	// 닉네임은 사용자 이름으로 고정됩니다. nil이면 누구나 /nick 으로 참여합니다.
+	users *UserDB
+
+	bans         *BanList
+	muted        map[string]time.Time // 소문자 닉네임 -> 발언 금지 종료 시각
+	kicked       map[string]time.Time // 소문자 닉네임 -> 강제 퇴장 후 다시 들어올 수 있는 시각
+	topics       map[string]string    // 방 이름 -> 주제
+	operPassword string               // /oper 로 운영자가 될 때 쓰는 비밀번호 (비어 있으면 사용 안 함)
+	operators    map[string]bool      // 로그인하면 바로 운영자가 되는 사용자
+
+	transfers    map[string]*transfer // 중계 중인 파일 전송 (전송 ID -> 전송)
+	nextTransfer uint64
+	maxFileSize  int64 // 주고받을 수 있는 파일의 최대 크기
+
+	register   chan *Client
+	unregister chan *Client
+	setNick    chan nickRequest
+	login      chan loginRequest
+	join       chan roomRequest
+	leave      chan roomRequest
+	broadcast  chan roomMessage
+	private    chan privateMessage
+	history    chan historyRequest
+	moderate   chan modRequest
+	files      chan fileFrame
+	notice     chan roomMessage
+	listRooms  chan *Client
+	who        chan *Client
+}
+
+// NewHub는 빈 허브를 생성합니다. Run을 고루틴으로 실행해야 동작합니다.
+// 방 메시지는 store에 기록되고, 입장할 때 최근 replay개를 다시 보내 줍니다.
+func NewHub(store MessageStore, replay int, bans *BanList) *Hub {
+	return &Hub{
+		clients:     make(map[*Client]bool),
+		nicks:       make(map[string]*Client),
+		rooms:       make(map[string]map[*Client]bool),
+		nextID:      store.LastID(),
+		store:       store,
+		replay:      replay,
+		bans:        bans,
+		muted:       make(map[string]time.Time),
+		kicked:      make(map[string]time.Time),
+		topics:      make(map[string]string),
+		operators:   make(map[string]bool),
+		transfers:   make(map[string]*transfer),
+		maxFileSize: 100 << 20,
+		register:    make(chan *Client),
+		unregister:  make(chan *Client),
+		setNick:     make(chan nickRequest),
+		login:       make(chan loginRequest),
+		join:        make(chan roomRequest),
+		leave:       make(chan roomRequest),
+		broadcast:   make(chan roomMessage),
+		private:     make(chan privateMessage),
+		history:     make(chan historyRequest),
+		moderate:    make(chan modRequest),
+		files:       make(chan fileFrame),
+		notice:      make(chan roomMessage),
+		listRooms:   make(chan *Client),
+		who:         make(chan *Client),
+	}
+}
+
+// Run은 허브의 이벤트 루프입니다. 모든 상태 변경은 이 고루틴에서만 일어납니다.
+func (h *Hub) Run() {
+	for {
+		select {
+		case c := <-h.register:
+			h.clients[c] = true
+			if h.users != nil {
+				h.system(c, "환영합니다! /login <사용자> <비밀번호> 로 먼저 로그인하세요.")
+			} else {
+				h.system(c, "환영합니다! /nick <닉네임> 으로 닉네임을 먼저 등록하세요.")
+			}
+
+		case c := <-h.unregister:
+			if !h.clients[c] {
+				continue
+			}
+			h.drop(c)
+
+		case req := <-h.setNick:
+			if !h.clients[req.client] {
+				continue
+			}
+			if h.users != nil {
+				h.fail(req.client, req.ref, "로그인 모드에서는 닉네임을 바꿀 수 없습니다.")
+				continue
+			}
+			h.changeNick(req.client, req.nick, req.token, req.ref)
+
+		case req := <-h.login:
+			if !h.clients[req.client] {
+				continue
+			}
+			h.loginUser(req)
+
+		case req := <-h.join:
+			if !h.registered(req.client, req.ref) {
+				continue
+			}
+			h.joinRoom(req.client, req.room)
+			h.ackRoom(req.client, req.ref, req.room)
+
+		case req := <-h.leave:
+			if !h.registered(req.client, req.ref) {
+				continue
+			}
+			room := req.room
+			if room == "" {
+				room = req.client.room
+			}
+			if !req.client.rooms[room] {
+				h.fail(req.client, req.ref, "참여하지 않은 방입니다: "+room)
+				continue
+			}
+			h.leaveRoom(req.client, room)
+			h.system(req.client, fmt.Sprintf("'%s' 방에서 나왔습니다.", room))
+			h.ackRoom(req.client, req.ref, room)
+
+		case msg := <-h.broadcast:
+			c := msg.client
+			if !h.registered(c, msg.ref) {
+				continue
+			}
+			room := msg.room
+			if room == "" {
+				room = c.room
+			}
+			if room == "" {
+				h.fail(c, msg.ref, "참여 중인 방이 없습니다. /join <방이름> 으로 입장하세요.")
+				continue
+			}
+			if !c.rooms[room] {
+				h.fail(c, msg.ref, "참여하지 않은 방입니다: "+room)
+				continue
+			}
+			if h.isMuted(c) {
+				h.fail(c, msg.ref, "발언이 금지된 상태입니다.")
+				continue
+			}
+			frame := h.newChat(c, msg.text)
+			frame.Room = room
+			fmt.Printf("[%s] %s: %s\n", room, c.nick, msg.text)
+			if err := h.store.Append(frame); err != nil {
+				fmt.Println("메시지 기록 실패:", err)
+			}
+			for member := range h.rooms[room] {
+				h.deliver(member, frame)
+			}
+			h.ack(c, msg.ref, frame.ID)
+
+		case msg := <-h.private:
+			if !h.registered(msg.from, msg.ref) {
+				continue
+			}
+			target := h.nicks[strings.ToLower(msg.to)]
+			if target == nil {
+				h.fail(msg.from, msg.ref, "접속하지 않은 사용자입니다: "+msg.to)
+				continue
+			}
+			if h.isMuted(msg.from) {
+				h.fail(msg.from, msg.ref, "발언이 금지된 상태입니다.")
+				continue
+			}
+			frame := h.newChat(msg.from, msg.text)
+			frame.To = target.nick
+			h.deliver(target, frame)
+			if target != msg.from {
+				h.deliver(msg.from, frame)
+			}
+			h.ack(msg.from, msg.ref, frame.ID)
+
+		case req := <-h.history:
+			if !h.registered(req.client, req.ref) {
+				continue
+			}
+			if req.client.room == "" {
+				h.fail(req.client, req.ref, "참여 중인 방이 없습니다.")
+				continue
+			}
+			count := req.count
+			if count > maxHistory {
+				count = maxHistory
+			}
+			h.sendHistory(req.client, req.client.room, count)
+			h.ack(req.client, req.ref, "")
+
+		case req := <-h.moderate:
+			if req.action == "/oper" {
+				if !h.clients[req.client] {
+					continue
+				}
+				h.grantOper(req)
+				continue
+			}
+			if !h.registered(req.client, req.ref) {
+				continue
+			}
+			h.applyModeration(req)
+
+		case req := <-h.files:
+			if !h.registered(req.client, req.frame.ID) {
+				continue
+			}
+			h.relayFile(req.client, req.frame)
+
+		case msg := <-h.notice:
+			if !h.clients[msg.client] {
+				continue
+			}
+			h.fail(msg.client, msg.ref, msg.text)
+
+		case c := <-h.listRooms:
+			if !h.registered(c, "") {
+				continue
+			}
+			h.system(c, h.describeRooms(c))
+
+		case c := <-h.who:
+			if !h.registered(c, "") {
+				continue
+			}
+			h.system(c, h.describeUsers())
+		}
+	}
+}
+
+// Reject는 한 클라이언트의 요청을 오류 프레임으로 거절합니다.
+func (h *Hub) Reject(c *Client, ref, text string) {
+	h.notice <- roomMessage{client: c, text: text, ref: ref}
+}
+
+// registered는 닉네임 등록을 마친 클라이언트인지 확인합니다.
+// 아직 등록하지 않았다면 오류 프레임을 보냅니다.
+func (h *Hub) registered(c *Client, ref string) bool {
+	if !h.clients[c] {
+		return false
+	}
+	if c.nick == "" {
+		if h.users != nil {
+			h.fail(c, ref, "먼저 /login <사용자> <비밀번호> 로 로그인하세요.")
+		} else {
+			h.fail(c, ref, "먼저 /nick <닉네임> 으로 닉네임을 등록하세요.")
+		}
+		return false
+	}
+	return true
+}
+
+// newChat은 새 메시지 ID를 부여한 채팅 프레임을 만듭니다.
+func (h *Hub) newChat(from *Client, text string) Frame {
+	h.nextID++
+	return Frame{
+		Kind: KindChat,
+		ID:   strconv.FormatUint(h.nextID, 10),
+		From: from.nick,
+		Text: text,
+		Time: Timestamp(),
+	}
+}
+
+// changeNick은 닉네임을 등록하거나 변경합니다. 첫 등록이면 기본 방에 입장시킵니다.
+// token이 닉네임을 가진 기존 연결의 토큰과 같으면 그 연결을 끊고 닉네임을 넘겨받습니다.
+func (h *Hub) changeNick(c *Client, nick, token, ref string) {
+	if err := validateNick(nick); err != nil {
+		h.fail(c, ref, err.Error())
+		return
+	}
+	if h.bans.IsNickBanned(nick) {
+		h.fail(c, ref, "차단된 닉네임입니다: "+nick)
+		return
+	}
+	if wait, ok := h.kickWait(nick); ok {
+		h.fail(c, ref, fmt.Sprintf("강제 퇴장된 닉네임입니다. %s 후에 다시 사용할 수 있습니다.", wait))
+		return
+	}
+	if c.nick != "" && h.isMuted(c) {
+		h.fail(c, ref, "발언 금지 중에는 닉네임을 바꿀 수 없습니다.")
+		return
+	}
+	key := strings.ToLower(nick)
+	if owner, ok := h.nicks[key]; ok && owner != c {
+		if token == "" || token != owner.token {
+			h.fail(c, ref, "이미 사용 중인 닉네임입니다: "+nick)
+			return
+		}
+		h.system(owner, "다른 연결에서 닉네임을 되찾아 연결을 끊습니다.")
+		h.drop(owner)
+	}
+
+	if c.token == "" {
+		generated, err := newToken()
+		if err != nil {
+			h.fail(c, ref, "토큰 발급 실패")
+			return
+		}
+		c.token = generated
+	}
+	h.deliver(c, h.registrationAck(c, ref, nick, c.token))
+	h.assignNick(c, nick)
+}
+
+// registrationAck은 닉네임 등록/로그인 요청에 대한 응답입니다.
+// 처음 등록하는 경우 자동으로 입장할 방을 Room에 담아 클라이언트가 상태를 맞출 수 있게 합니다.
+func (h *Hub) registrationAck(c *Client, ref, nick, token string) Frame {
+	ack := Frame{Kind: KindAck, Ref: ref, From: nick, Token: token}
+	if c.nick == "" {
+		ack.Room = defaultRoom
+	}
+	return ack
+}
+
+// loginUser는 인증된 사용자 이름을 닉네임으로 지정합니다.
+// 같은 사용자가 이미 접속해 있으면 예전 연결을 끊고 자리를 넘겨받습니다.
+func (h *Hub) loginUser(req loginRequest) {
+	c := req.client
+	if c.nick != "" && c.nick != req.user {
+		h.fail(c, req.ref, "이미 다른 사용자로 로그인되어 있습니다.")
+		return
+	}
+	if h.bans.IsNickBanned(req.user) {
+		h.fail(c, req.ref, "차단된 사용자입니다.")
+		return
+	}
+	if wait, ok := h.kickWait(req.user); ok {
+		// 비밀번호로 로그인하면서 방금 발급한 토큰도 쓰지 못하게 함
+		h.users.RevokeTokens(req.user)
+		h.fail(c, req.ref, fmt.Sprintf("강제 퇴장된 사용자입니다. %s 후에 다시 로그인할 수 있습니다.", wait))
+		return
+	}
+	if owner, ok := h.nicks[strings.ToLower(req.user)]; ok && owner != c {
+		// 안내 메시지를 보낸 뒤 전송 큐가 닫히면 쓰기 고루틴이 연결을 닫음
+		h.system(owner, "다른 곳에서 로그인하여 연결을 끊습니다.")
+		h.drop(owner)
+	}
+
+	h.deliver(c, h.registrationAck(c, req.ref, req.user, req.token))
+	if h.operators[req.user] {
+		c.op = true
+	}
+	if c.nick != req.user {
+		h.assignNick(c, req.user)
+	}
+}
+
+// assignNick은 검사를 마친 닉네임을 클라이언트에 지정합니다.
+func (h *Hub) assignNick(c *Client, nick string) {
+	old := c.nick
+	if old != "" {
+		delete(h.nicks, strings.ToLower(old))
+	}
+	h.nicks[strings.ToLower(nick)] = c
+	c.nick = nick
+
+	if old == "" {
+		fmt.Printf("닉네임 등록: %s (%s)\n", nick, c.fc.conn.RemoteAddr())
+		h.system(c, fmt.Sprintf("'%s'(으)로 등록되었습니다.", nick))
+		h.joinRoom(c, defaultRoom)
+		return
+	}
+	fmt.Printf("닉네임 변경: %s -> %s\n", old, nick)
+	h.system(c, fmt.Sprintf("닉네임이 '%s'(으)로 변경되었습니다.", nick))
+	for room := range c.rooms {
+		h.announce(room, c, fmt.Sprintf("%s 님의 닉네임이 %s(으)로 바뀌었습니다.", old, nick))
+		h.sendMembers(room)
+	}
+}
+
+// validateNick은 닉네임 형식을 검사합니다.
+func validateNick(nick string) error {
+	if nick == "" || len([]rune(nick)) > maxNickLength {
+		return fmt.Errorf("닉네임은 1~%d자여야 합니다.", maxNickLength)
+	}
+	for _, r := range nick {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' {
+			return errors.New("닉네임에는 문자, 숫자, '_', '-'만 쓸 수 있습니다.")
+		}
+	}
+	return nil
+}
+
+// joinRoom은 클라이언트를 방에 추가하고 현재 방으로 지정합니다.
+func (h *Hub) joinRoom(c *Client, room string) {
+	if c.rooms[room] {
+		c.room = room
+		h.system(c, fmt.Sprintf("'%s' 방으로 전환했습니다.", room))
+		return
+	}
+	if h.rooms[room] == nil {
+		h.rooms[room] = make(map[*Client]bool)
+	}
+	h.announce(room, c, fmt.Sprintf("%s 님이 입장했습니다.", c.nick))
+	h.rooms[room][c] = true
+	c.rooms[room] = true
+	c.room = room
+	h.sendMembers(room)
+	h.system(c, fmt.Sprintf("'%s' 방에 입장했습니다. (%d명)", room, len(h.rooms[room])))
+	if h.topics[room] != "" {
+		h.system(c, h.describeTopic(room))
+	}
+	h.sendHistory(c, room, h.replay)
+}
+
+// sendHistory는 방의 최근 메시지를 기록 표시를 붙여 다시 보냅니다.
+func (h *Hub) sendHistory(c *Client, room string, count int) {
+	if count <= 0 {
+		return
+	}
+	for _, frame := range h.store.Recent(room, count) {
+		frame.History = true
+		h.deliver(c, frame)
+	}
+}
+
+// leaveRoom은 클라이언트를 방에서 제거하고, 빈 방은 삭제합니다.
+func (h *Hub) leaveRoom(c *Client, room string) {
+	delete(h.rooms[room], c)
+	if len(h.rooms[room]) == 0 {
+		delete(h.rooms, room)
+	}
+	delete(c.rooms, room)
+	if c.room == room {
+		// 남아 있는 방 중 하나를 현재 방으로 지정
+		c.room = ""
+		for other := range c.rooms {
+			c.room = other
+			break
+		}
+	}
+	h.announce(room, c, fmt.Sprintf("%s 님이 퇴장했습니다.", c.nick))
+	h.sendMembers(room)
+}
+
+// announce는 방의 다른 참여자들에게 시스템 메시지를 보냅니다.
+func (h *Hub) announce(room string, except *Client, text string) {
+	frame := Frame{Kind: KindSystem, Room: room, Text: text, Time: Timestamp()}
+	for member := range h.rooms[room] {
+		if member != except {
+			h.deliver(member, frame)
+		}
+	}
+}
+
+// sendMembers는 방의 참여자 목록을 목록 표시를 지원하는(v6 이상) 참여자에게 보냅니다.
+func (h *Hub) sendMembers(room string) {
+	members := h.rooms[room]
+	if len(members) == 0 {
+		return
+	}
+	names := make([]string, 0, len(members))
+	for member := range members {
+		names = append(names, member.nick)
+	}
+	sort.Strings(names)
+
+	frame := Frame{Kind: KindMembers, Room: room, Users: names}
+	for member := range members {
+		if member.fc.Version >= 6 {
+			h.deliver(member, frame)
+		}
+	}
+}
+
+// describeRooms는 /rooms 명령에 대한 응답 문자열을 만듭니다.
+func (h *Hub) describeRooms(c *Client) string {
+	if len(h.rooms) == 0 {
+		return "열려 있는 방이 없습니다."
+	}
+	names := make([]string, 0, len(h.rooms))
+	for name := range h.rooms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("방 목록:")
+	for _, name := range names {
+		mark := " "
+		if name == c.room {
+			mark = "*"
+		} else if c.rooms[name] {
+			mark = "+"
+		}
+		fmt.Fprintf(&b, "\n %s %s (%d명)", mark, name, len(h.rooms[name]))
+	}
+	return b.String()
+}
+
+// describeUsers는 /who 명령에 대한 응답 문자열을 만듭니다.
+func (h *Hub) describeUsers() string {
+	names := make([]string, 0, len(h.nicks))
+	for _, c := range h.nicks {
+		names = append(names, c.nick)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "접속 중인 사용자 (%d명):", len(names))
+	for _, name := range names {
+		c := h.nicks[strings.ToLower(name)]
+		rooms := make([]string, 0, len(c.rooms))
+		for room := range c.rooms {
+			rooms = append(rooms, room)
+		}
+		sort.Strings(rooms)
+		fmt.Fprintf(&b, "\n - %s [%s]", name, strings.Join(rooms, ", "))
+	}
+	return b.String()
+}
+
+// system은 한 클라이언트에게 시스템 메시지를 보냅니다.
+func (h *Hub) system(c *Client, text string) {
+	h.deliver(c, Frame{Kind: KindSystem, Text: text, Time: Timestamp()})
+}
+
+// fail은 요청에 대한 오류 프레임을 보냅니다.
+func (h *Hub) fail(c *Client, ref, text string) {
+	h.deliver(c, Frame{Kind: KindError, Ref: ref, Text: text, Time: Timestamp()})
+}
+
+// ack은 요청 ID가 있는 요청에 대해 처리 완료를 알립니다.
+func (h *Hub) ack(c *Client, ref, id string) {
+	if ref == "" {
+		return
+	}
+	h.deliver(c, Frame{Kind: KindAck, Ref: ref, ID: id})
+}
+
+// ackRoom은 방 입장/퇴장 요청에 대해 대상 방을 담아 처리 완료를 알립니다.
+func (h *Hub) ackRoom(c *Client, ref, room string) {
+	if ref == "" {
+		return
+	}
+	h.deliver(c, Frame{Kind: KindAck, Ref: ref, Room: room})
+}
+
+// deliver는 클라이언트의 전송 큐에 프레임을 넣습니다.
+// 큐가 가득 찬 느린 클라이언트는 허브 전체를 막지 않도록 연결을 끊습니다.
+func (h *Hub) deliver(c *Client, frame Frame) {
+	if !h.clients[c] {
+		return
+	}
+	select {
+	case c.send <- frame:
+	default:
+		fmt.Println("전송 큐가 가득 차 연결을 끊습니다:", c.Name())
+		h.drop(c)
+		c.fc.conn.Close()
+	}
+}
+
+// drop은 클라이언트를 모든 방과 허브에서 제거합니다.
+func (h *Hub) drop(c *Client) {
+	delete(h.clients, c)
+	h.dropTransfers(c)
+	for room := range c.rooms {
+		h.leaveRoom(c, room)
+	}
+	if c.nick != "" && h.nicks[strings.ToLower(c.nick)] == c {
+		delete(h.nicks, strings.ToLower(c.nick))
+	}
+	close(c.send)
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 강제 퇴장된 닉네임(로그인 모드에서는 사용자)이 다시 들어올 수 없는 시간
+const kickCooldown = 5 * time.Minute
+
+// ban은 차단 목록의 한 항목입니다.
+type ban struct {
+	Reason string `json:"reason,omitempty"`
+	By     string `json:"by"`
+	Time   string `json:"time"`
+}
+
+// BanList는 닉네임과 IP 차단 목록입니다. 바뀔 때마다 파일에 저장됩니다.
+// 접속을 받는 main 고루틴과 허브가 함께 사용하므로 뮤텍스로 보호합니다.
+type BanList struct {
+	mu    sync.Mutex
+	path  string
+	Nicks map[string]ban `json:"nicks"` // 소문자 닉네임 -> 차단 정보
+	IPs   map[string]ban `json:"ips"`
+}
+
+// LoadBanList는 차단 목록 파일을 읽습니다. 파일이 없으면 빈 목록으로 시작합니다.
+func LoadBanList(path string) (*BanList, error) {
+	b := &BanList{
+		path:  path,
+		Nicks: make(map[string]ban),
+		IPs:   make(map[string]ban),
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, err
+	}
+	if b.Nicks == nil {
+		b.Nicks = make(map[string]ban)
+	}
+	if b.IPs == nil {
+		b.IPs = make(map[string]ban)
+	}
+	return b, nil
+}
+
+// save는 차단 목록을 파일에 씁니다. b.mu를 잡은 상태에서 호출합니다.
+func (b *BanList) save() error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(b.path, data, 0644)
+}
+
+// BanNick은 닉네임을 차단합니다.
+func (b *BanList) BanNick(nick string, entry ban) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.Nicks[strings.ToLower(nick)] = entry
+	return b.save()
+}
+
+// BanIP는 IP 주소를 차단합니다.
+func (b *BanList) BanIP(ip string, entry ban) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.IPs[ip] = entry
+	return b.save()
+}
+
+// Unban은 닉네임 또는 IP 차단을 해제합니다. 해제한 항목이 없으면 false를 반환합니다.
+// IP는 차단할 때처럼 net.ParseIP로 맞춘 형태로 찾으므로 "::1"과 "0:0::1"은 같은 주소입니다.
+func (b *BanList) Unban(target string) (bool, error) {
+	ip := target
+	if parsed := net.ParseIP(target); parsed != nil {
+		ip = parsed.String()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	_, nickBanned := b.Nicks[strings.ToLower(target)]
+	_, ipBanned := b.IPs[ip]
+	if !nickBanned && !ipBanned {
+		return false, nil
+	}
+	delete(b.Nicks, strings.ToLower(target))
+	delete(b.IPs, ip)
+	return true, b.save()
+}
+
+// IsNickBanned는 닉네임이 차단되었는지 확인합니다.
+func (b *BanList) IsNickBanned(nick string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.Nicks[strings.ToLower(nick)]
+	return ok
+}
+
+// IsAddrBanned는 접속 주소의 IP가 차단되었는지 확인합니다.
+func (b *BanList) IsAddrBanned(addr net.Addr) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.IPs[hostOf(addr)]
+	return ok
+}
+
+// Describe는 /bans 명령에 대한 응답 문자열을 만듭니다.
+func (b *BanList) Describe() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.Nicks) == 0 && len(b.IPs) == 0 {
+		return "차단된 항목이 없습니다."
+	}
+	var lines []string
+	for nick, entry := range b.Nicks {
+		lines = append(lines, fmt.Sprintf(" - 닉네임 %s (%s, %s)", nick, entry.By, entry.Reason))
+	}
+	for ip, entry := range b.IPs {
+		lines = append(lines, fmt.Sprintf(" - IP %s (%s, %s)", ip, entry.By, entry.Reason))
+	}
+	sort.Strings(lines)
+	return "차단 목록:\n" + strings.Join(lines, "\n")
+}
+
+// hostOf는 접속 주소에서 포트를 뺀 IP 부분을 반환합니다.
+func hostOf(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// RateLimiter는 연결마다 메시지 전송 속도를 제한하는 토큰 버킷입니다.
+// 연결 고루틴 하나에서만 사용하므로 잠금이 필요 없습니다.
+type RateLimiter struct {
+	rate   float64 // 초당 채워지는 토큰 수
+	burst  float64 // 한 번에 몰아서 보낼 수 있는 최대 메시지 수
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter는 초당 rate개, 최대 burst개까지 허용하는 제한기를 만듭니다.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Allow는 지금 메시지 하나를 보내도 되는지 확인하고, 되면 토큰을 하나 씁니다.
+func (r *RateLimiter) Allow() bool {
+	now := time.Now()
+	r.tokens += now.Sub(r.last).Seconds() * r.rate
+	if r.tokens > r.burst {
+		r.tokens = r.burst
+	}
+	r.last = now
+	if r.tokens < 1 {
+		return false
+	}
+	r.tokens--
+	return true
+}
+
+// modRequest는 운영자 명령 요청입니다.
+type modRequest struct {
+	client *Client
+	action string   // 명령 이름 ("/kick" 등)
+	args   []string // 명령 인자
+	ref    string
+}
+
+// applyModeration은 운영자 명령을 처리합니다. 허브 고루틴에서만 호출합니다.
+func (h *Hub) applyModeration(req modRequest) {
+	c := req.client
+
+	// /topic 은 누구나 조회할 수 있고, 변경만 운영자 권한이 필요
+	if req.action == "/topic" && len(req.args) == 0 {
+		if c.room == "" {
+			h.fail(c, req.ref, "참여 중인 방이 없습니다.")
+			return
+		}
+		h.system(c, h.describeTopic(c.room))
+		return
+	}
+	if !c.op {
+		h.fail(c, req.ref, "운영자만 사용할 수 있는 명령입니다.")
+		return
+	}
+
+	switch req.action {
+	case "/kick":
+		target := h.nicks[strings.ToLower(req.args[0])]
+		if target == nil {
+			h.fail(c, req.ref, "접속하지 않은 사용자입니다: "+req.args[0])
+			return
+		}
+		reason := strings.Join(req.args[1:], " ")
+		h.broadcastAll(fmt.Sprintf("%s 님이 %s 님을 내보냈습니다. %s", c.nick, target.nick, reason))
+		fmt.Printf("강제 퇴장: %s (운영자 %s)\n", target.nick, c.nick)
+		// 자동 재접속하는 클라이언트가 토큰으로 닉네임을 바로 되찾지 못하게 함
+		h.kicked[strings.ToLower(target.nick)] = time.Now().Add(kickCooldown)
+		if h.users != nil {
+			h.users.RevokeTokens(target.nick)
+		}
+		h.disconnect(target, fmt.Sprintf("운영자에 의해 연결이 끊어졌습니다. %s 동안 다시 들어올 수 없습니다. %s", kickCooldown, reason))
+
+	case "/ban":
+		if !h.banTarget(c, req.args[0], strings.Join(req.args[1:], " "), req.ref) {
+			return
+		}
+
+	case "/unban":
+		ok, err := h.bans.Unban(req.args[0])
+		if err != nil {
+			h.fail(c, req.ref, "차단 목록 저장 실패: "+err.Error())
+			return
+		}
+		if !ok {
+			h.fail(c, req.ref, "차단되지 않은 대상입니다: "+req.args[0])
+			return
+		}
+		h.system(c, req.args[0]+" 의 차단을 해제했습니다.")
+
+	case "/bans":
+		h.system(c, h.bans.Describe())
+
+	case "/mute":
+		key := strings.ToLower(req.args[0])
+		duration := 10 * time.Minute
+		if len(req.args) > 1 {
+			d, err := time.ParseDuration(req.args[1])
+			if err != nil || d <= 0 {
+				h.fail(c, req.ref, "사용법: /mute <닉네임> [기간, 예: 10m]")
+				return
+			}
+			duration = d
+		}
+		h.muted[key] = time.Now().Add(duration)
+		if target := h.nicks[key]; target != nil {
+			h.system(target, fmt.Sprintf("운영자에 의해 %s 동안 발언이 금지되었습니다.", duration))
+		}
+		h.system(c, fmt.Sprintf("%s 님의 발언을 %s 동안 금지했습니다.", req.args[0], duration))
+
+	case "/unmute":
+		key := strings.ToLower(req.args[0])
+		delete(h.muted, key)
+		if target := h.nicks[key]; target != nil {
+			h.system(target, "발언 금지가 해제되었습니다.")
+		}
+		h.system(c, req.args[0]+" 님의 발언 금지를 해제했습니다.")
+
+	case "/topic":
+		if c.room == "" {
+			h.fail(c, req.ref, "참여 중인 방이 없습니다.")
+			return
+		}
+		topic := strings.Join(req.args, " ")
+		h.topics[c.room] = topic
+		frame := Frame{Kind: KindSystem, Room: c.room, Text: fmt.Sprintf("%s 님이 주제를 바꾸었습니다: %s", c.nick, topic), Time: Timestamp()}
+		for member := range h.rooms[c.room] {
+			h.deliver(member, frame)
+		}
+	}
+	h.ack(c, req.ref, "")
+}
+
+// grantOper는 /oper <비밀번호> 가 맞으면 운영자 권한을 줍니다.
+func (h *Hub) grantOper(req modRequest) {
+	c := req.client
+	if h.operPassword == "" || len(req.args) != 1 ||
+		subtle.ConstantTimeCompare([]byte(req.args[0]), []byte(h.operPassword)) != 1 {
+		fmt.Println("운영자 인증 실패:", c.fc.conn.RemoteAddr())
+		h.fail(c, req.ref, "운영자 비밀번호가 올바르지 않습니다.")
+		return
+	}
+	c.op = true
+	fmt.Println("운영자 인증:", c.Name())
+	h.system(c, "운영자 권한을 얻었습니다.")
+	h.ack(c, req.ref, "")
+}
+
+// banTarget은 닉네임 또는 IP를 차단하고, 해당하는 접속을 모두 끊습니다.
+// 닉네임을 차단하면 그 사용자가 지금 쓰는 IP도 함께 차단합니다.
+func (h *Hub) banTarget(op *Client, target, reason, ref string) bool {
+	entry := ban{Reason: reason, By: op.nick, Time: Timestamp()}
+
+	var ips []string
+	if ip := net.ParseIP(target); ip != nil {
+		ips = append(ips, ip.String())
+	} else {
+		if err := h.bans.BanNick(target, entry); err != nil {
+			h.fail(op, ref, "차단 목록 저장 실패: "+err.Error())
+			return false
+		}
+		// 운영자 자신과 같은 IP(같은 컴퓨터, 같은 NAT)는 함께 막지 않음
+		if c := h.nicks[strings.ToLower(target)]; c != nil && hostOf(c.fc.conn.RemoteAddr()) != hostOf(op.fc.conn.RemoteAddr()) {
+			ips = append(ips, hostOf(c.fc.conn.RemoteAddr()))
+		}
+	}
+	for _, ip := range ips {
+		if err := h.bans.BanIP(ip, entry); err != nil {
+			h.fail(op, ref, "차단 목록 저장 실패: "+err.Error())
+			return false
+		}
+	}
+
+	for c := range h.clients {
+		if c == op {
+			continue
+		}
+		banned := strings.EqualFold(c.nick, target)
+		for _, ip := range ips {
+			if hostOf(c.fc.conn.RemoteAddr()) == ip {
+				banned = true
+			}
+		}
+		if banned {
+			fmt.Printf("차단: %s (%s, 운영자 %s)\n", c.Name(), c.fc.conn.RemoteAddr(), op.nick)
+			h.disconnect(c, "운영자에 의해 차단되었습니다. "+reason)
+		}
+	}
+	h.broadcastAll(fmt.Sprintf("%s 님이 %s 을(를) 차단했습니다. %s", op.nick, target, reason))
+	return true
+}
+
+// disconnect는 안내를 보낸 뒤 연결을 끊습니다. v7 이상 클라이언트에게는 다시 접속하지 말라는
+// kicked 프레임을 보내고, 그보다 오래된 클라이언트에게는 시스템 메시지를 보냅니다.
+func (h *Hub) disconnect(c *Client, text string) {
+	if c.fc.Version >= 7 {
+		h.deliver(c, Frame{Kind: KindKicked, Text: text, Time: Timestamp()})
+	} else {
+		h.system(c, text)
+	}
+	// 전송 큐가 가득 차 deliver가 이미 끊었을 수 있음
+	if h.clients[c] {
+		h.drop(c)
+	}
+}
+
+// kickWait은 강제 퇴장된 닉네임이면 남은 시간을 반환하고, 기간이 지난 항목은 정리합니다.
+func (h *Hub) kickWait(nick string) (time.Duration, bool) {
+	key := strings.ToLower(nick)
+	until, ok := h.kicked[key]
+	if !ok {
+		return 0, false
+	}
+	wait := time.Until(until)
+	if wait <= 0 {
+		delete(h.kicked, key)
+		return 0, false
+	}
+	return wait.Round(time.Second), true
+}
+
+// isMuted는 클라이언트가 발언 금지 중인지 확인하고, 기간이 지난 금지는 정리합니다.
+func (h *Hub) isMuted(c *Client) bool {
+	key := strings.ToLower(c.nick)
+	until, ok := h.muted[key]
+	if !ok {
+		return false
+	}
+	if time.Now().After(until) {
+		delete(h.muted, key)
+		return false
+	}
+	return true
+}
+
+// describeTopic은 방의 주제를 안내하는 문자열을 만듭니다.
+func (h *Hub) describeTopic(room string) string {
+	if topic := h.topics[room]; topic != "" {
+		return fmt.Sprintf("[%s] 주제: %s", room, topic)
+	}
+	return fmt.Sprintf("[%s] 주제가 정해지지 않았습니다.", room)
+}
+
+// broadcastAll은 접속한 모든 사용자에게 시스템 메시지를 보냅니다.
+func (h *Hub) broadcastAll(text string) {
+	for c := range h.clients {
+		if c.nick != "" {
+			h.system(c, text)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+// 서버와 클라이언트가 함께 사용하는 채팅 프로토콜 정의입니다.
+// 한 줄에 JSON 프레임 하나를 보내며(newline-delimited JSON), 본문의 줄바꿈은
+// JSON 문자열 안에서 이스케이프되므로 프레임 경계를 깨뜨리지 않습니다.
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 프로토콜 버전. 새 필드나 종류를 추가하면 ProtocolVersion을 올리고,
+// 더 이상 호환되지 않는 변경일 때만 MinProtocolVersion을 올립니다.
+const (
+	ProtocolVersion    = 7
+	MinProtocolVersion = 1
+
+	maxFrameSize = 1 << 20 // 한 프레임(한 줄)의 최대 크기
+)
+
+// 파일 전송 흐름 제어. 보내는 쪽은 받는 쪽이 진행 상황(file_progress)으로
+// 확인해 준 위치보다 fileWindow개 조각 이상 앞서 보내지 않습니다.
+const (
+	fileChunkSize = 32 * 1024 // 조각 하나의 최대 크기 (base64로 인코딩해도 maxFrameSize보다 작음)
+	fileWindow    = 8         // 확인 없이 보낼 수 있는 조각 수
+)
+
+// FrameKind는 프레임의 종류입니다.
+type FrameKind string
+
+const (
+	KindHello   FrameKind = "hello"   // 접속 직후 버전 협상
+	KindChat    FrameKind = "chat"    // 사용자 메시지 (방 메시지 또는 귓속말)
+	KindCommand FrameKind = "command" // 클라이언트 명령 (/join 등)
+	KindSystem  FrameKind = "system"  // 서버 안내 메시지
+	KindAck     FrameKind = "ack"     // 요청 처리 완료 응답
+	KindError   FrameKind = "error"   // 요청 처리 실패 응답
+	KindPing    FrameKind = "ping"    // v4: 연결 확인 요청
+	KindPong    FrameKind = "pong"    // v4: 연결 확인 응답
+
+	KindFileOffer    FrameKind = "file_offer"    // v5: 파일 전송 제안
+	KindFileAccept   FrameKind = "file_accept"   // v5: 받는 쪽의 수락
+	KindFileChunk    FrameKind = "file_chunk"    // v5: 파일 내용 조각
+	KindFileProgress FrameKind = "file_progress" // v5: 받는 쪽이 지금까지 받은 크기
+	KindFileDone     FrameKind = "file_done"     // v5: 전송 끝 (받는 쪽이 보내면 SHA-256 확인 완료)
+	KindFileCancel   FrameKind = "file_cancel"   // v5: 거절, 취소 또는 검증 실패
+
+	KindMembers FrameKind = "members" // v6: 방의 참여자 목록 (입장/퇴장/닉네임 변경 때마다)
+	KindKicked  FrameKind = "kicked"  // v7: 운영자가 연결을 끊음 (클라이언트는 다시 접속하지 않음)
+)
+
+// Frame은 연결 위로 오가는 메시지 하나입니다.
+type Frame struct {
+	Kind       FrameKind `json:"kind"`
+	Version    int       `json:"v,omitempty"`     // hello: 지원하는 최대 버전 / 협상된 버전
+	MinVersion int       `json:"min_v,omitempty"` // hello: 지원하는 최소 버전
+	ID         string    `json:"id,omitempty"`    // 메시지 ID (보낸 쪽에서 부여)
+	Ref        string    `json:"ref,omitempty"`   // ack/error가 가리키는 요청 ID
+	Room       string    `json:"room,omitempty"`
+	From       string    `json:"from,omitempty"`
+	To         string    `json:"to,omitempty"` // 귓속말 대상
+	Text       string    `json:"text,omitempty"`
+	Time       string    `json:"time,omitempty"`    // RFC3339 형식
+	History    bool      `json:"history,omitempty"` // v2: 지난 기록을 다시 보내는 메시지
+	Token      string    `json:"token,omitempty"`   // v3: 로그인 성공 시 발급하는 재접속 토큰
+
+	// v5: 파일 전송
+	Transfer string `json:"transfer,omitempty"` // 서버가 부여한 전송 ID
+	Name     string `json:"name,omitempty"`     // 파일 이름
+	Size     int64  `json:"size,omitempty"`     // 파일 크기 (바이트)
+	Hash     string `json:"hash,omitempty"`     // 파일 전체의 SHA-256 (16진수)
+	Offset   int64  `json:"offset,omitempty"`   // 조각의 시작 위치 / 받은 크기
+	Data     []byte `json:"data,omitempty"`     // 조각 내용 (JSON에서는 base64)
+
+	Users []string `json:"users,omitempty"` // v6: members 프레임의 참여자 닉네임 목록
+}
+
+// Timestamp는 현재 시각을 프레임용 문자열로 반환합니다.
+func Timestamp() string {
+	return time.Now().Format(time.RFC3339)
+}
+
+// FrameConn은 net.Conn 위에서 프레임 단위로 읽고 쓰는 연결입니다.
+// Legacy가 참이면 JSON 이전의 줄 단위 텍스트 클라이언트로 취급합니다.
+type FrameConn struct {
+	conn    net.Conn
+	scanner *bufio.Scanner
+	writeMu sync.Mutex // 여러 고루틴이 동시에 써도 프레임이 섞이지 않도록 보호
+	Legacy  bool
+	Version int // 협상된 프로토콜 버전
+}
+
+// NewFrameConn은 연결을 프레임 연결로 감쌉니다.
+func NewFrameConn(conn net.Conn) *FrameConn {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), maxFrameSize)
+	return &FrameConn{conn: conn, scanner: scanner}
+}
+
+// readLine은 다음 한 줄을 읽습니다.
+func (fc *FrameConn) readLine() ([]byte, error) {
+	if !fc.scanner.Scan() {
+		if err := fc.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, net.ErrClosed
+	}
+	return fc.scanner.Bytes(), nil
+}
+
+// ReadFrame은 다음 프레임을 읽습니다.
+func (fc *FrameConn) ReadFrame() (Frame, error) {
+	line, err := fc.readLine()
+	if err != nil {
+		return Frame{}, err
+	}
+	if fc.Legacy {
+		return parseLegacyLine(string(line)), nil
+	}
+	var f Frame
+	if err := json.Unmarshal(line, &f); err != nil {
+		return Frame{}, fmt.Errorf("잘못된 프레임: %v", err)
+	}
+	return f, nil
+}
+
+// WriteFrame은 프레임 하나를 씁니다.
+func (fc *FrameConn) WriteFrame(f Frame) error {
+	var data []byte
+	if fc.Legacy {
+		text, ok := formatLegacyLine(f)
+		if !ok {
+			return nil
+		}
+		data = []byte(text + "\n")
+	} else {
+		encoded, err := json.Marshal(f)
+		if err != nil {
+			return err
+		}
+		data = append(encoded, '\n')
+	}
+	fc.writeMu.Lock()
+	defer fc.writeMu.Unlock()
+	_, err := fc.conn.Write(data)
+	return err
+}
+
+// Accept는 서버 쪽에서 버전 협상을 진행합니다.
+// 첫 줄이 hello 프레임이 아니면 예전 텍스트 클라이언트로 보고, 그 줄을
+// 첫 메시지로 돌려줍니다.
+func (fc *FrameConn) Accept() (*Frame, error) {
+	line, err := fc.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	var hello Frame
+	if json.Unmarshal(line, &hello) != nil || hello.Kind != KindHello {
+		fc.Legacy = true
+		fc.Version = 0
+		first := parseLegacyLine(string(line))
+		return &first, nil
+	}
+
+	version, err := negotiateVersion(hello)
+	if err != nil {
+		fc.WriteFrame(Frame{Kind: KindError, Text: err.Error()})
+		return nil, err
+	}
+	fc.Version = version
+	if err := fc.WriteFrame(Frame{Kind: KindHello, Version: version, MinVersion: MinProtocolVersion}); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// Dial은 클라이언트 쪽에서 버전 협상을 진행합니다.
+func (fc *FrameConn) Dial() error {
+	hello := Frame{Kind: KindHello, Version: ProtocolVersion, MinVersion: MinProtocolVersion}
+	if err := fc.WriteFrame(hello); err != nil {
+		return err
+	}
+	reply, err := fc.ReadFrame()
+	if err != nil {
+		return err
+	}
+	switch reply.Kind {
+	case KindHello:
+		fc.Version = reply.Version
+		return nil
+	case KindError:
+		return errors.New(reply.Text)
+	default:
+		return fmt.Errorf("예상하지 못한 응답: %s", reply.Kind)
+	}
+}
+
+// negotiateVersion은 양쪽이 모두 지원하는 가장 높은 버전을 고릅니다.
+func negotiateVersion(hello Frame) (int, error) {
+	clientMin := hello.MinVersion
+	if clientMin == 0 {
+		clientMin = hello.Version
+	}
+	version := ProtocolVersion
+	if hello.Version < version {
+		version = hello.Version
+	}
+	if version < MinProtocolVersion || version < clientMin {
+		return 0, fmt.Errorf("지원하지 않는 프로토콜 버전입니다 (클라이언트 %d~%d, 서버 %d~%d)",
+			clientMin, hello.Version, MinProtocolVersion, ProtocolVersion)
+	}
+	return version, nil
+}
+
+// parseLegacyLine은 예전 텍스트 클라이언트가 보낸 한 줄을 프레임으로 바꿉니다.
+func parseLegacyLine(line string) Frame {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "/") {
+		return Frame{Kind: KindCommand, Text: line}
+	}
+	return Frame{Kind: KindChat, Text: line}
+}
+
+// formatLegacyLine은 프레임을 예전 텍스트 형식의 한 줄로 바꿉니다.
+// 텍스트 클라이언트에게 보낼 필요가 없는 프레임이면 false를 반환합니다.
+func formatLegacyLine(f Frame) (string, bool) {
+	switch f.Kind {
+	case KindChat:
+		text := strings.ReplaceAll(f.Text, "\n", " ")
+		if f.To != "" {
+			return fmt.Sprintf("[귓속말] %s -> %s: %s", f.From, f.To, text), true
+		}
+		return fmt.Sprintf("[%s] %s: %s", f.Room, f.From, text), true
+	case KindSystem, KindError, KindKicked:
+		lines := strings.Split(f.Text, "\n")
+		for i, line := range lines {
+			if f.Room != "" && i == 0 {
+				line = fmt.Sprintf("[%s] %s", f.Room, line)
+			}
+			lines[i] = "*** " + line
+		}
+		return strings.Join(lines, "\n"), true
+	default:
+		return "", false
+	}
+}
@@ -1,21 +1,147 @@
 package main
 
+// 실행 방법: go run Chat_Server.go Chat_Hub.go Chat_Protocol.go Chat_Store.go Chat_Auth.go Chat_TLS.go Chat_Moderation.go Chat_Transfer.go Chat_WebSocket.go
+// 브라우저 접속 허용: go run ... -http localhost:8081 (브라우저에서 http://localhost:8081 접속)
+// 사용자 추가: go run ... -users users.json -adduser <이름>
+
 import (
 	"bufio"
+	"crypto/tls"
+	"flag"
 	"fmt"
 	"net"
+	"os"
+	"strconv"
 	"strings"
+	"time"
+)
+
+const (
+	writeTimeout      = 10 * time.Second // 프레임 하나를 쓰는 데 허용하는 시간
+	maxRateViolations = 20               // 연속으로 속도 제한을 넘기면 연결을 끊는 횟수
 )
 
 func main() {
-	// TCP 서버 시작
-	listener, err := net.Listen("tcp", "localhost:8080")
+	addr := flag.String("addr", "localhost:8080", "서버 주소")
+	httpAddr := flag.String("http", "", "브라우저용 HTTP/WebSocket 주소 (빈 값이면 사용 안 함)")
+	certFile := flag.String("tls-cert", "", "TLS 인증서 파일 (지정하면 TLS로 동작)")
+	keyFile := flag.String("tls-key", "", "TLS 개인키 파일")
+	selfSigned := flag.Bool("tls-self-signed", false, "TLS로 동작하고, 인증서 파일이 없으면 개발용 자체 서명 인증서를 생성 (경로를 안 주면 "+defaultSelfSignedCert+", "+defaultSelfSignedKey+")")
+	usersPath := flag.String("users", "", "사용자 파일 (지정하면 /login 이 필요)")
+	addUser := flag.String("adduser", "", "사용자를 추가하고 종료 (비밀번호는 표준 입력으로 받음)")
+	pingInterval := flag.Duration("ping-interval", 30*time.Second, "연결 확인(ping) 주기")
+	idleTimeout := flag.Duration("idle-timeout", 10*time.Minute, "ping을 지원하지 않는 예전 클라이언트의 무응답 제한 시간")
+	bansPath := flag.String("bans", "bans.json", "차단 목록 파일")
+	operPassword := flag.String("oper-password", "", "/oper 명령으로 운영자가 될 때 쓰는 비밀번호")
+	operators := flag.String("ops", "", "로그인하면 운영자가 되는 사용자 목록 (쉼표로 구분)")
+	rate := flag.Float64("rate", 5, "연결마다 초당 허용하는 메시지 수")
+	burst := flag.Int("burst", 10, "한 번에 몰아서 보낼 수 있는 최대 메시지 수")
+	historyPath := flag.String("history", "chat_history.log", "채팅 기록 파일 경로 (빈 값이면 메모리에만 보관)")
+	historyMaxSize := flag.Int64("history-max-size", 1<<20, "기록 파일을 돌려 쓰기 전 최대 크기 (바이트)")
+	historyKeep := flag.Int("history-keep", 5, "보관할 이전 기록 파일 수")
+	replay := flag.Int("replay", 20, "방에 입장할 때 다시 보여 줄 최근 메시지 수")
+	maxFileSize := flag.Int64("max-file-size", 100<<20, "사용자끼리 주고받을 수 있는 파일의 최대 크기 (바이트)")
+	flag.Parse()
+
+	// -tls-self-signed만 주어도 평문으로 조용히 동작하지 않도록 기본 경로의 인증서를 씀
+	if *selfSigned {
+		if *certFile == "" {
+			*certFile = defaultSelfSignedCert
+		}
+		if *keyFile == "" {
+			*keyFile = defaultSelfSignedKey
+		}
+	}
+
+	// 사용자 데이터베이스 준비
+	var users *UserDB
+	if *usersPath != "" {
+		db, err := LoadUserDB(*usersPath)
+		if err != nil {
+			fmt.Println("사용자 파일 읽기 실패:", err)
+			return
+		}
+		users = db
+	}
+	if *addUser != "" {
+		if users == nil {
+			fmt.Println("-adduser 는 -users 와 함께 사용해야 합니다.")
+			return
+		}
+		fmt.Print("비밀번호: ")
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Scan()
+		if err := users.AddUser(*addUser, strings.TrimSpace(scanner.Text())); err != nil {
+			fmt.Println("사용자 추가 실패:", err)
+			return
+		}
+		fmt.Println("사용자가 추가되었습니다:", *addUser)
+		return
+	}
+
+	// 메시지 저장소 준비
+	var store MessageStore = NewMemoryStore(maxHistory)
+	if *historyPath != "" {
+		fileStore, err := NewFileStore(*historyPath, *historyMaxSize, *historyKeep, maxHistory)
+		if err != nil {
+			fmt.Println("채팅 기록 파일 열기 실패:", err)
+			return
+		}
+		store = fileStore
+	}
+	defer store.Close()
+
+	// 차단 목록 로드
+	bans, err := LoadBanList(*bansPath)
+	if err != nil {
+		fmt.Println("차단 목록 읽기 실패:", err)
+		return
+	}
+
+	// TCP 서버 시작 (인증서가 있으면 TLS)
+	listener, err := net.Listen("tcp", *addr)
 	if err != nil {
 		fmt.Println("서버 시작 실패:", err)
 		return
 	}
+	var tlsConfig *tls.Config
+	if *certFile != "" {
+		tlsConfig, err = loadTLSConfig(*certFile, *keyFile, *selfSigned)
+		if err != nil {
+			fmt.Println("TLS 설정 실패:", err)
+			return
+		}
+		listener = tls.NewListener(listener, tlsConfig)
+		fmt.Println("TLS가 활성화되었습니다.")
+	}
 	defer listener.Close()
-	fmt.Println("채팅 서버가 시작되었습니다. 포트: 8080")
+	fmt.Println("채팅 서버가 시작되었습니다. 주소:", *addr)
+	if users != nil {
+		fmt.Println("로그인이 필요합니다. 등록된 사용자 파일:", *usersPath)
+	}
+
+	// 모든 연결과 방을 관리하는 허브 시작
+	hub := NewHub(store, *replay, bans)
+	hub.users = users
+	hub.operPassword = *operPassword
+	hub.maxFileSize = *maxFileSize
+	for _, name := range strings.Split(*operators, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			hub.operators[name] = true
+		}
+	}
+	go hub.Run()
+
+	// 브라우저 클라이언트도 같은 허브에 참여 (TLS 설정도 함께 사용)
+	if *httpAddr != "" {
+		go func() {
+			err := serveWebSocket(*httpAddr, tlsConfig, bans, func(conn net.Conn) {
+				handleClient(hub, conn, *pingInterval, *idleTimeout, NewRateLimiter(*rate, *burst))
+			})
+			fmt.Println("HTTP 서버 종료:", err)
+		}()
+		fmt.Println("브라우저 접속 주소:", *httpAddr)
+	}
 
 	for {
 		// 클라이언트 연결 대기
@@ -24,30 +150,256 @@ func main() {
 			fmt.Println("클라이언트 연결 실패:", err)
 			continue
 		}
-		fmt.Println("클라이언트가 연결되었습니다.")
+		// 차단된 주소는 고루틴을 만들기 전에 바로 끊음
+		if bans.IsAddrBanned(conn.RemoteAddr()) {
+			fmt.Println("차단된 주소의 연결을 거부했습니다:", conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+		fmt.Println("클라이언트가 연결되었습니다:", conn.RemoteAddr())
 
 		// 고루틴을 사용해 클라이언트 핸들링
-		go handleClient(conn)
+		go handleClient(hub, conn, *pingInterval, *idleTimeout, NewRateLimiter(*rate, *burst))
 	}
 }
 
-func handleClient(conn net.Conn) {
+func handleClient(hub *Hub, conn net.Conn, pingInterval, idleTimeout time.Duration, limiter *RateLimiter) {
 	defer conn.Close()
-	reader := bufio.NewReader(conn)
 
+	// 버전 협상 (hello 프레임이 없으면 예전 텍스트 클라이언트)
+	// 협상 단계에서 아무것도 보내지 않는 연결도 무한정 붙잡지 않도록 제한
+	fc := NewFrameConn(conn)
+	conn.SetReadDeadline(time.Now().Add(idleTimeout))
+	first, err := fc.Accept()
+	if err != nil {
+		fmt.Println("프로토콜 협상 실패:", conn.RemoteAddr(), err)
+		return
+	}
+	if fc.Legacy {
+		fmt.Println("텍스트 모드 클라이언트:", conn.RemoteAddr())
+	}
+
+	// ping을 이해하는 클라이언트는 pong이 끊기면 바로 정리하고,
+	// 예전 클라이언트는 idleTimeout 동안 아무 입력이 없을 때 정리
+	readTimeout := idleTimeout
+	if fc.Version >= 4 {
+		readTimeout = 2 * pingInterval
+	} else {
+		pingInterval = 0
+	}
+
+	client := NewClient(fc)
+	hub.register <- client
+	go writeClient(client, pingInterval)
+
+	defer func() {
+		hub.unregister <- client
+		fmt.Println("클라이언트 연결 종료:", conn.RemoteAddr())
+	}()
+
+	if first != nil {
+		handleFrame(hub, client, *first)
+	}
+	violations := 0
 	for {
-		// 클라이언트로부터 메시지 수신
-		message, err := reader.ReadString('\n')
+		// 클라이언트로부터 프레임 수신 (제한 시간 안에 아무 프레임도 없으면 끊긴 연결)
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+		frame, err := fc.ReadFrame()
 		if err != nil {
-			fmt.Println("클라이언트 연결 종료")
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				fmt.Println("응답이 없어 연결을 정리합니다:", conn.RemoteAddr())
+			}
 			break
 		}
 
-		// 메시지 출력
-		message = strings.TrimSpace(message)
-		fmt.Println("클라이언트:", message)
+		// 도배 방지: 속도 제한을 넘긴 메시지는 버리고, 계속 넘기면 연결을 끊음
+		// 파일 조각과 진행 상황은 전송 창(fileWindow)으로 속도가 제한되므로 제외
+		if rateLimited(frame.Kind) && !limiter.Allow() {
+			violations++
+			if violations >= maxRateViolations {
+				fmt.Println("도배로 연결을 끊습니다:", conn.RemoteAddr())
+				break
+			}
+			hub.Reject(client, frame.ID, "메시지를 너무 빠르게 보내고 있습니다. 잠시 후 다시 시도하세요.")
+			continue
+		}
+		violations = 0
+		handleFrame(hub, client, frame)
+	}
+}
+
+// rateLimited는 속도 제한을 적용할 프레임 종류인지 확인합니다.
+func rateLimited(kind FrameKind) bool {
+	switch kind {
+	case KindPing, KindPong, KindFileChunk, KindFileProgress:
+		return false
+	}
+	return true
+}
+
+// handleFrame은 클라이언트가 보낸 프레임 하나를 처리합니다.
+func handleFrame(hub *Hub, client *Client, frame Frame) {
+	switch frame.Kind {
+	case KindPing, KindPong:
+		// 읽기 제한 시간 연장 외에는 할 일이 없음
+	case KindCommand:
+		handleCommand(hub, client, strings.TrimSpace(frame.Text), frame.ID)
+	case KindChat:
+		text := strings.TrimSpace(frame.Text)
+		if text == "" {
+			return
+		}
+		if frame.To != "" {
+			hub.private <- privateMessage{from: client, to: frame.To, text: text, ref: frame.ID}
+			return
+		}
+		// 방의 모든 참여자에게 전달
+		hub.broadcast <- roomMessage{client: client, room: frame.Room, text: text, ref: frame.ID}
+	case KindFileOffer, KindFileAccept, KindFileChunk, KindFileProgress, KindFileDone, KindFileCancel:
+		hub.files <- fileFrame{client: client, frame: frame}
+	default:
+		hub.Reject(client, frame.ID, fmt.Sprintf("지원하지 않는 프레임입니다: %s", frame.Kind))
+	}
+}
+
+// handleCommand는 '/'로 시작하는 명령을 처리합니다.
+func handleCommand(hub *Hub, client *Client, message, ref string) {
+	fields := strings.Fields(message)
+	if len(fields) == 0 {
+		return
+	}
+	switch fields[0] {
+	case "/nick":
+		// 재접속한 클라이언트는 예전 연결의 토큰을 함께 보냄
+		if len(fields) != 2 && len(fields) != 3 {
+			hub.Reject(client, ref, "사용법: /nick <닉네임>")
+			return
+		}
+		token := ""
+		if len(fields) == 3 {
+			token = fields[2]
+		}
+		hub.setNick <- nickRequest{client: client, nick: fields[1], token: token, ref: ref}
+	case "/login":
+		handleLogin(hub, client, fields[1:], ref)
+	case "/msg":
+		// 본문의 공백을 보존하기 위해 닉네임 뒤는 그대로 사용
+		rest := strings.TrimSpace(strings.TrimPrefix(message, "/msg"))
+		to, text, ok := strings.Cut(rest, " ")
+		text = strings.TrimSpace(text)
+		if !ok || text == "" {
+			hub.Reject(client, ref, "사용법: /msg <닉네임> <메시지>")
+			return
+		}
+		hub.private <- privateMessage{from: client, to: to, text: text, ref: ref}
+	case "/who":
+		hub.who <- client
+	case "/join":
+		if len(fields) != 2 {
+			hub.Reject(client, ref, "사용법: /join <방이름>")
+			return
+		}
+		hub.join <- roomRequest{client: client, room: fields[1], ref: ref}
+	case "/leave":
+		room := ""
+		if len(fields) > 1 {
+			room = fields[1]
+		}
+		hub.leave <- roomRequest{client: client, room: room, ref: ref}
+	case "/rooms":
+		hub.listRooms <- client
+	case "/oper", "/topic", "/bans":
+		hub.moderate <- modRequest{client: client, action: fields[0], args: fields[1:], ref: ref}
+	case "/kick", "/ban", "/unban", "/mute", "/unmute":
+		if len(fields) < 2 {
+			hub.Reject(client, ref, fmt.Sprintf("사용법: %s <대상> ...", fields[0]))
+			return
+		}
+		hub.moderate <- modRequest{client: client, action: fields[0], args: fields[1:], ref: ref}
+	case "/history":
+		count := 20
+		if len(fields) > 1 {
+			n, err := strconv.Atoi(fields[1])
+			if err != nil || n <= 0 {
+				hub.Reject(client, ref, "사용법: /history <개수>")
+				return
+			}
+			count = n
+		}
+		hub.history <- historyRequest{client: client, count: count, ref: ref}
+	default:
+		hub.Reject(client, ref, "알 수 없는 명령입니다: "+fields[0])
+	}
+}
+
+// handleLogin은 /login <사용자> <비밀번호> 또는 /login <토큰> 을 처리합니다.
+// 비밀번호 검사는 시간이 걸리므로 허브가 아닌 연결 고루틴에서 수행합니다.
+func handleLogin(hub *Hub, client *Client, args []string, ref string) {
+	if hub.users == nil {
+		hub.Reject(client, ref, "이 서버는 로그인을 사용하지 않습니다. /nick 을 사용하세요.")
+		return
+	}
+
+	var user string
+	switch len(args) {
+	case 1:
+		name, ok := hub.users.CheckToken(args[0])
+		if !ok {
+			hub.Reject(client, ref, "토큰이 만료되었거나 올바르지 않습니다.")
+			return
+		}
+		user = name
+	case 2:
+		if !hub.users.Authenticate(args[0], args[1]) {
+			// 무차별 대입을 늦추기 위해 잠시 대기
+			time.Sleep(time.Second)
+			fmt.Println("로그인 실패:", args[0], client.fc.conn.RemoteAddr())
+			hub.Reject(client, ref, "사용자 이름 또는 비밀번호가 올바르지 않습니다.")
+			return
+		}
+		user = args[0]
+	default:
+		hub.Reject(client, ref, "사용법: /login <사용자> <비밀번호>")
+		return
+	}
+
+	token, err := hub.users.IssueToken(user)
+	if err != nil {
+		hub.Reject(client, ref, "토큰 발급 실패")
+		return
+	}
+	fmt.Println("로그인 성공:", user, client.fc.conn.RemoteAddr())
+	hub.login <- loginRequest{client: client, user: user, token: token, ref: ref}
+}
+
+// writeClient는 전송 큐의 프레임을 연결에 쓰고, pingInterval마다 ping을 보냅니다.
+// 큐가 닫히면 남은 프레임을 모두 보낸 뒤 연결을 닫습니다.
+func writeClient(client *Client, pingInterval time.Duration) {
+	defer client.fc.conn.Close()
 
-		// 에코 메시지 전송
-		conn.Write([]byte("서버: " + message + "\n"))
+	var tick <-chan time.Time
+	if pingInterval > 0 {
+		ticker := time.NewTicker(pingInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		var frame Frame
+		select {
+		case f, ok := <-client.send:
+			if !ok {
+				return
+			}
+			frame = f
+		case <-tick:
+			frame = Frame{Kind: KindPing}
+		}
+
+		// 받는 쪽이 멈춘 연결에 쓰기가 영원히 막히지 않도록 제한
+		client.fc.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if err := client.fc.WriteFrame(frame); err != nil {
+			return
+		}
 	}
 }
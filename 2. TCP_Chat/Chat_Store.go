@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// MessageStore는 방 메시지를 보관하는 저장소입니다.
+// 허브는 이 인터페이스만 사용하므로 다른 저장 방식으로 바꿔 끼울 수 있습니다.
+type MessageStore interface {
+	// Append는 방 메시지 하나를 기록합니다.
+	Append(frame Frame) error
+	// Recent는 방의 최근 메시지를 오래된 순서로 최대 n개 반환합니다.
+	Recent(room string, n int) []Frame
+	// LastID는 지금까지 기록된 가장 큰 메시지 ID를 반환합니다.
+	LastID() uint64
+	Close() error
+}
+
+// MemoryStore는 방마다 최근 메시지를 메모리에만 보관하는 저장소입니다.
+type MemoryStore struct {
+	mu     sync.Mutex
+	limit  int // 방마다 보관할 최대 메시지 수
+	rooms  map[string][]Frame
+	lastID uint64
+}
+
+// NewMemoryStore는 방마다 최대 limit개의 메시지를 보관하는 저장소를 만듭니다.
+func NewMemoryStore(limit int) *MemoryStore {
+	return &MemoryStore{limit: limit, rooms: make(map[string][]Frame)}
+}
+
+// Append는 메시지를 방의 목록에 추가하고, 한도를 넘으면 오래된 것부터 버립니다.
+func (s *MemoryStore) Append(frame Frame) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	frames := append(s.rooms[frame.Room], frame)
+	if len(frames) > s.limit {
+		frames = append([]Frame(nil), frames[len(frames)-s.limit:]...)
+	}
+	s.rooms[frame.Room] = frames
+	if id, err := strconv.ParseUint(frame.ID, 10, 64); err == nil && id > s.lastID {
+		s.lastID = id
+	}
+	return nil
+}
+
+// Recent는 방의 최근 메시지를 최대 n개 반환합니다.
+func (s *MemoryStore) Recent(room string, n int) []Frame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	frames := s.rooms[room]
+	if n < len(frames) {
+		frames = frames[len(frames)-n:]
+	}
+	return append([]Frame(nil), frames...)
+}
+
+// LastID는 가장 큰 메시지 ID를 반환합니다.
+func (s *MemoryStore) LastID() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastID
+}
+
+// Close는 메모리 저장소에서는 할 일이 없습니다.
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// FileStore는 메시지를 한 줄에 하나씩 JSON으로 덧붙여 쓰는 로그 파일 저장소입니다.
+// 파일이 maxSize를 넘으면 path.1, path.2 ... 로 돌려 쓰고(rotation),
+// keep개보다 오래된 파일은 삭제합니다. 조회는 메모리의 최근 메시지로 처리합니다.
+type FileStore struct {
+	*MemoryStore
+
+	path    string
+	maxSize int64
+	keep    int
+
+	file *os.File
+	size int64
+}
+
+// NewFileStore는 로그 파일을 열고, 기존 기록을 읽어 최근 메시지를 복원합니다.
+func NewFileStore(path string, maxSize int64, keep, limit int) (*FileStore, error) {
+	s := &FileStore{
+		MemoryStore: NewMemoryStore(limit),
+		path:        path,
+		maxSize:     maxSize,
+		keep:        keep,
+	}
+
+	// 오래된 파일부터 읽어야 방마다 최신 메시지가 남음
+	for i := keep; i >= 0; i-- {
+		if err := s.load(s.rotatedPath(i)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.openCurrent(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// openCurrent는 현재 로그 파일을 덧붙여 쓰기로 열고 크기를 읽습니다.
+func (s *FileStore) openCurrent() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// load는 로그 파일 하나를 읽어 메모리에 올립니다. 파일이 없으면 무시합니다.
+func (s *FileStore) load(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 4096), maxFrameSize)
+	for scanner.Scan() {
+		var frame Frame
+		if err := json.Unmarshal(scanner.Bytes(), &frame); err != nil {
+			fmt.Println("기록 파일의 손상된 줄을 건너뜁니다:", path)
+			continue
+		}
+		s.MemoryStore.Append(frame)
+	}
+	return scanner.Err()
+}
+
+// Append는 메시지를 파일 끝에 기록하고 메모리에도 추가합니다.
+func (s *FileStore) Append(frame Frame) error {
+	line, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	if s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.MemoryStore.Append(frame)
+}
+
+// rotate는 현재 파일을 path.1로 밀어내고 새 파일을 엽니다. s.mu를 잡은 상태에서 호출합니다.
+// 중간에 실패하면 현재 파일을 다시 열어 두므로 기록은 계속되고, 다음 Append에서 다시 돌려 씁니다.
+func (s *FileStore) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return s.reopenAfter(err)
+	}
+	os.Remove(s.rotatedPath(s.keep))
+	for i := s.keep - 1; i >= 0; i-- {
+		if err := os.Rename(s.rotatedPath(i), s.rotatedPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return s.reopenAfter(err)
+		}
+	}
+	if err := s.openCurrent(); err != nil {
+		return s.reopenAfter(err)
+	}
+	return nil
+}
+
+// reopenAfter는 돌려 쓰기에 실패했을 때 현재 파일을 다시 엽니다. 이름을 바꾸기 전에 실패했으면
+// 원래 파일에 이어 쓰고, 바꾼 뒤라면 새 파일이 만들어집니다. 원래 오류를 반환합니다.
+func (s *FileStore) reopenAfter(cause error) error {
+	if err := s.openCurrent(); err != nil {
+		return fmt.Errorf("%w (로그 파일을 다시 열지 못했습니다: %v)", cause, err)
+	}
+	return cause
+}
+
+// rotatedPath는 i번째로 오래된 돌려 쓴 파일 경로를 반환합니다. 0은 현재 파일입니다.
+func (s *FileStore) rotatedPath(i int) string {
+	if i == 0 {
+		return s.path
+	}
+	return fmt.Sprintf("%s.%d", s.path, i)
+}
+
+// Close는 로그 파일을 닫습니다.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
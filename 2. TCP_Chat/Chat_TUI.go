@@ -0,0 +1,501 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"image"
+	"strings"
+	"sync"
+
+	ui "github.com/gizak/termui/v3"
+	rw "github.com/mattn/go-runewidth"
+)
+
+const (
+	sidebarWidth = 24   // 오른쪽 방/사용자 목록의 너비
+	maxViewLines = 1000 // 방마다 화면에 보관할 최대 줄 수
+)
+
+// 닉네임마다 항상 같은 색을 쓰도록 이름의 해시로 고름
+var nickColors = []ui.Color{ui.ColorGreen, ui.ColorBlue, ui.ColorMagenta, ui.ColorCyan, ui.ColorYellow, ui.ColorRed}
+
+var (
+	styleDefault = ui.NewStyle(ui.ColorClear)
+	styleDim     = ui.NewStyle(ui.Color(8)) // 시각과 지난 기록: 회색
+	styleSystem  = ui.NewStyle(ui.ColorYellow)
+	stylePrivate = ui.NewStyle(ui.ColorMagenta)
+	styleError   = ui.NewStyle(ui.ColorRed)
+	styleFile    = ui.NewStyle(ui.ColorCyan)
+	styleCurrent = ui.NewStyle(ui.ColorYellow, ui.ColorClear, ui.ModifierBold)
+	styleCursor  = ui.NewStyle(ui.ColorClear, ui.ColorClear, ui.ModifierReverse)
+)
+
+// tuiView는 메시지 창, 방/사용자 목록, 고정된 입력 줄로 이루어진 전체 화면 UI입니다.
+// 받은 메시지는 입력 줄과 섞이지 않고 메시지 창에만 그려집니다.
+type tuiView struct {
+	mu     sync.Mutex
+	redraw chan struct{} // 다시 그려야 할 때 신호 (하나만 쌓임)
+	width  int
+	height int
+
+	nick    string
+	current string
+	rooms   []string
+	logs    map[string][][]ui.Cell // 방 이름 -> 표시할 줄 ("" 는 방에 들어가기 전 안내)
+	unread  map[string]int         // 보고 있지 않은 방에 새로 온 메시지 수
+	members map[string][]string
+	scroll  int // 메시지 창을 맨 아래에서 위로 올린 줄 수
+
+	input   []rune
+	cursor  int
+	history []string
+	histPos int    // 위/아래 화살표로 보고 있는 history 위치 (len(history)면 새 입력)
+	draft   string // 기록을 보기 전에 입력하던 내용
+}
+
+// newTUIView는 터미널을 전체 화면 모드로 바꿉니다. 끝나면 Close를 호출해야 합니다.
+func newTUIView() (*tuiView, error) {
+	if err := ui.Init(); err != nil {
+		return nil, err
+	}
+	width, height := ui.TerminalDimensions()
+	return &tuiView{
+		redraw:  make(chan struct{}, 1),
+		width:   width,
+		height:  height,
+		logs:    make(map[string][][]ui.Cell),
+		unread:  make(map[string]int),
+		members: make(map[string][]string),
+	}, nil
+}
+
+// Close는 터미널을 원래 상태로 되돌립니다.
+func (v *tuiView) Close() {
+	ui.Close()
+}
+
+// Show는 프레임을 알맞은 방의 메시지 창에 추가합니다.
+func (v *tuiView) Show(frame Frame) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	stamp := formatTime(frame.Time)
+	switch frame.Kind {
+	case KindMembers:
+		v.members[frame.Room] = frame.Users
+	case KindChat:
+		if frame.To != "" {
+			line := cells(fmt.Sprintf("%s[귓속말] %s -> %s: %s", stamp, frame.From, frame.To, frame.Text), stylePrivate)
+			v.appendLine(v.current, line)
+			break
+		}
+		if frame.History {
+			v.appendLine(frame.Room, cells(fmt.Sprintf("%s%s: %s", stamp, frame.From, frame.Text), styleDim))
+			break
+		}
+		line := cells(stamp, styleDim)
+		line = append(line, cells(frame.From, nickStyle(frame.From))...)
+		line = append(line, cells(": "+frame.Text, styleDefault)...)
+		v.appendLine(frame.Room, line)
+		if frame.Room != v.current {
+			v.unread[frame.Room]++
+		}
+	case KindSystem:
+		room := frame.Room
+		if room == "" {
+			room = v.current
+		}
+		v.appendLine(room, cells(stamp+"*** "+frame.Text, styleSystem))
+	case KindError:
+		v.appendLine(v.current, cells(stamp+"*** 오류: "+frame.Text, styleError))
+	case KindKicked:
+		v.appendLine(v.current, cells(stamp+"*** "+frame.Text, styleError))
+	default:
+		return
+	}
+	v.requestRedraw()
+}
+
+// Notice는 파일 전송 같은 로컬 안내를 현재 방의 메시지 창에 추가합니다.
+func (v *tuiView) Notice(format string, args ...any) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.appendLine(v.current, cells("*** "+fmt.Sprintf(format, args...), styleFile))
+	v.requestRedraw()
+}
+
+// SetRooms는 닉네임과 참여 중인 방 목록을 갱신합니다.
+// 현재 방이 바뀌면 그 방의 안 읽은 수를 지우고 맨 아래부터 보여 줍니다.
+func (v *tuiView) SetRooms(nick, current string, rooms []string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if current != v.current {
+		// 방에 들어가기 전에 받은 안내는 처음 들어간 방으로 옮김
+		if current != "" && len(v.logs[""]) > 0 {
+			v.logs[current] = append(v.logs[""], v.logs[current]...)
+			delete(v.logs, "")
+		}
+		v.scroll = 0
+	}
+	v.nick = nick
+	v.current = current
+	v.rooms = rooms
+	delete(v.unread, current)
+
+	joined := make(map[string]bool, len(rooms))
+	for _, room := range rooms {
+		joined[room] = true
+	}
+	for room := range v.members {
+		if !joined[room] {
+			delete(v.members, room)
+			delete(v.unread, room)
+		}
+	}
+	v.requestRedraw()
+}
+
+// Run은 키 입력을 처리하고 화면을 다시 그립니다. Ctrl+C나 "exit"를 입력하면 끝납니다.
+func (v *tuiView) Run(input func(text string)) {
+	events := ui.PollEvents()
+	v.render()
+	for {
+		select {
+		case e := <-events:
+			if e.Type == ui.ResizeEvent {
+				size := e.Payload.(ui.Resize)
+				v.mu.Lock()
+				v.width, v.height = size.Width, size.Height
+				v.mu.Unlock()
+				break
+			}
+			text, quit := v.handleKey(e.ID)
+			if quit {
+				return
+			}
+			// 세션이 화면을 갱신할 수 있도록 잠금을 놓은 뒤 입력을 넘김
+			if text != "" {
+				input(text)
+			}
+		case <-v.redraw:
+		}
+		v.render()
+	}
+}
+
+// handleKey는 키 하나를 처리합니다. 보낼 입력이 완성되면 text로 반환합니다.
+func (v *tuiView) handleKey(id string) (text string, quit bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	page := (v.height - 5) / 2
+	if page < 1 {
+		page = 1
+	}
+	switch id {
+	case "<C-c>":
+		return "", true
+	case "<Enter>":
+		text = strings.TrimSpace(string(v.input))
+		v.input, v.cursor = nil, 0
+		if text == "" {
+			return "", false
+		}
+		if text == "exit" {
+			return "", true
+		}
+		v.history = append(v.history, text)
+		v.histPos = len(v.history)
+		v.scroll = 0
+		return text, false
+	case "<Up>":
+		if v.histPos > 0 {
+			if v.histPos == len(v.history) {
+				v.draft = string(v.input)
+			}
+			v.histPos--
+			v.setInput(v.history[v.histPos])
+		}
+	case "<Down>":
+		if v.histPos < len(v.history) {
+			v.histPos++
+			if v.histPos == len(v.history) {
+				v.setInput(v.draft)
+			} else {
+				v.setInput(v.history[v.histPos])
+			}
+		}
+	case "<Left>":
+		if v.cursor > 0 {
+			v.cursor--
+		}
+	case "<Right>":
+		if v.cursor < len(v.input) {
+			v.cursor++
+		}
+	case "<Home>", "<C-a>":
+		v.cursor = 0
+	case "<End>", "<C-e>":
+		v.cursor = len(v.input)
+	case "<Backspace>", "<C-<Backspace>>":
+		if v.cursor > 0 {
+			v.input = append(v.input[:v.cursor-1], v.input[v.cursor:]...)
+			v.cursor--
+		}
+	case "<Delete>":
+		if v.cursor < len(v.input) {
+			v.input = append(v.input[:v.cursor], v.input[v.cursor+1:]...)
+		}
+	case "<C-u>":
+		v.input, v.cursor = nil, 0
+	case "<PageUp>":
+		v.scroll += page
+	case "<PageDown>":
+		v.scroll -= page
+	case "<MouseWheelUp>":
+		v.scroll += 3
+	case "<MouseWheelDown>":
+		v.scroll -= 3
+	case "<Tab>":
+		// 다음 방으로 전환 (서버의 현재 방도 함께 바뀜)
+		if next := v.nextRoom(); next != "" {
+			return "/join " + next, false
+		}
+	case "<Space>":
+		v.insert(' ')
+	default:
+		if r := []rune(id); len(r) == 1 {
+			v.insert(r[0])
+		}
+	}
+	if v.scroll < 0 {
+		v.scroll = 0
+	}
+	return "", false
+}
+
+// insert는 커서 위치에 글자 하나를 넣습니다.
+func (v *tuiView) insert(r rune) {
+	v.input = append(v.input[:v.cursor], append([]rune{r}, v.input[v.cursor:]...)...)
+	v.cursor++
+}
+
+// setInput은 입력 줄을 text로 바꾸고 커서를 끝으로 옮깁니다.
+func (v *tuiView) setInput(text string) {
+	v.input = []rune(text)
+	v.cursor = len(v.input)
+}
+
+// nextRoom은 현재 방 다음의 방 이름을 반환합니다.
+func (v *tuiView) nextRoom() string {
+	if len(v.rooms) < 2 {
+		return ""
+	}
+	for i, room := range v.rooms {
+		if room == v.current {
+			return v.rooms[(i+1)%len(v.rooms)]
+		}
+	}
+	return v.rooms[0]
+}
+
+// appendLine은 방의 메시지 창에 한 줄을 추가합니다.
+// 위로 스크롤해 읽는 중이면 보고 있던 위치가 밀리지 않도록 스크롤도 함께 늘립니다.
+func (v *tuiView) appendLine(room string, line []ui.Cell) {
+	lines := append(v.logs[room], line)
+	if len(lines) > maxViewLines {
+		lines = lines[len(lines)-maxViewLines:]
+	}
+	v.logs[room] = lines
+	if room == v.current && v.scroll > 0 {
+		v.scroll++
+	}
+}
+
+// requestRedraw는 Run 고루틴에 다시 그리기를 요청합니다. 막히지 않습니다.
+func (v *tuiView) requestRedraw() {
+	select {
+	case v.redraw <- struct{}{}:
+	default:
+	}
+}
+
+// render는 현재 상태로 화면 전체를 그립니다.
+func (v *tuiView) render() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	ui.Clear()
+	width, height := v.width, v.height
+	if width < sidebarWidth+20 || height < 8 {
+		notice := &cellBox{Block: *ui.NewBlock(), lines: [][]ui.Cell{cells("창이 너무 작습니다.", styleError)}}
+		notice.SetRect(0, 0, width, height)
+		ui.Render(notice)
+		return
+	}
+
+	// 메시지 창 (스크롤이 기록보다 커지지 않도록 제한)
+	lines := v.logs[v.current]
+	if v.scroll > len(lines)-1 {
+		v.scroll = len(lines) - 1
+	}
+	if v.scroll < 0 {
+		v.scroll = 0
+	}
+	messages := &cellBox{Block: *ui.NewBlock(), lines: lines, follow: true, scroll: v.scroll}
+	messages.Title = " 채팅 "
+	if v.current != "" {
+		messages.Title = " " + v.current + " "
+	}
+	if v.scroll > 0 {
+		messages.Title += fmt.Sprintf("(%d줄 위) ", v.scroll)
+	}
+	messages.SetRect(0, 0, width-sidebarWidth, height-3)
+
+	// 방 목록 (현재 방 강조, 안 읽은 메시지 수 표시)
+	roomLines := make([][]ui.Cell, 0, len(v.rooms))
+	for _, room := range v.rooms {
+		switch {
+		case room == v.current:
+			roomLines = append(roomLines, cells("* "+room, styleCurrent))
+		case v.unread[room] > 0:
+			roomLines = append(roomLines, cells(fmt.Sprintf("  %s (%d)", room, v.unread[room]), styleSystem))
+		default:
+			roomLines = append(roomLines, cells("  "+room, styleDefault))
+		}
+	}
+	roomsHeight := len(v.rooms) + 2
+	if roomsHeight < 4 {
+		roomsHeight = 4
+	}
+	if roomsHeight > (height-3)/2 {
+		roomsHeight = (height - 3) / 2
+	}
+	rooms := &cellBox{Block: *ui.NewBlock(), lines: roomLines}
+	rooms.Title = " 방 (Tab) "
+	rooms.SetRect(width-sidebarWidth, 0, width, roomsHeight)
+
+	// 현재 방의 사용자 목록
+	names := v.members[v.current]
+	userLines := make([][]ui.Cell, 0, len(names))
+	for _, name := range names {
+		userLines = append(userLines, cells(name, nickStyle(name)))
+	}
+	users := &cellBox{Block: *ui.NewBlock(), lines: userLines}
+	users.Title = fmt.Sprintf(" 사용자 (%d) ", len(names))
+	users.SetRect(width-sidebarWidth, roomsHeight, width, height-3)
+
+	// 입력 줄
+	prompt := &cellBox{Block: *ui.NewBlock(), lines: [][]ui.Cell{v.inputCells(width - 2)}}
+	prompt.Title = " 닉네임 없음 "
+	if v.nick != "" {
+		prompt.Title = " " + v.nick + " "
+	}
+	prompt.SetRect(0, height-3, width, height)
+
+	ui.Render(messages, rooms, users, prompt)
+}
+
+// inputCells는 입력 줄을 커서가 보이도록 잘라 그릴 칸으로 만듭니다.
+func (v *tuiView) inputCells(width int) []ui.Cell {
+	prefix := cells("> ", styleSystem)
+	avail := width - len(prefix) - 1 // 커서가 끝에 있을 때 쓸 한 칸
+
+	// 커서 앞부분이 너비를 넘으면 앞쪽을 잘라 냄
+	start := 0
+	for rw.StringWidth(string(v.input[start:v.cursor])) > avail {
+		start++
+	}
+	line := prefix
+	for i := start; i < len(v.input); i++ {
+		style := styleDefault
+		if i == v.cursor {
+			style = styleCursor
+		}
+		line = append(line, ui.Cell{Rune: v.input[i], Style: style})
+	}
+	if v.cursor == len(v.input) {
+		line = append(line, ui.Cell{Rune: ' ', Style: styleCursor})
+	}
+	return line
+}
+
+// cellBox는 미리 색을 입힌 줄들을 그리는 위젯입니다.
+// 사용자가 보낸 글자가 termui 스타일 문법으로 해석되지 않도록 칸을 직접 그립니다.
+type cellBox struct {
+	ui.Block
+	lines  [][]ui.Cell
+	follow bool // 참이면 긴 줄을 접고, 마지막 줄이 아래쪽에 붙도록 그림 (메시지 창)
+	scroll int  // follow일 때 맨 아래에서 위로 올린 줄 수
+}
+
+// Draw는 termui.Drawable 인터페이스를 구현합니다.
+func (b *cellBox) Draw(buf *ui.Buffer) {
+	b.Block.Draw(buf)
+	width, height := b.Inner.Dx(), b.Inner.Dy()
+	if width <= 0 || height <= 0 {
+		return
+	}
+
+	var rows [][]ui.Cell
+	if b.follow {
+		// 스크롤 위치의 줄부터 위로 올라가며 화면을 채움
+		for i := len(b.lines) - 1 - b.scroll; i >= 0 && len(rows) < height; i-- {
+			rows = append(wrapCells(b.lines[i], width), rows...)
+		}
+		if len(rows) > height {
+			rows = rows[len(rows)-height:]
+		}
+	} else {
+		rows = b.lines
+		if len(rows) > height {
+			rows = rows[:height]
+		}
+	}
+
+	for y, row := range rows {
+		x := 0
+		for _, cell := range row {
+			w := rw.RuneWidth(cell.Rune)
+			if x+w > width {
+				break
+			}
+			buf.SetCell(cell, image.Pt(b.Inner.Min.X+x, b.Inner.Min.Y+y))
+			x += w
+		}
+	}
+}
+
+// wrapCells는 한 줄을 화면 너비에 맞게 여러 줄로 나눕니다. 한글처럼 넓은 글자도 고려합니다.
+func wrapCells(line []ui.Cell, width int) [][]ui.Cell {
+	rows := [][]ui.Cell{nil}
+	x := 0
+	for _, cell := range line {
+		if cell.Rune == '\n' {
+			rows = append(rows, nil)
+			x = 0
+			continue
+		}
+		w := rw.RuneWidth(cell.Rune)
+		if x+w > width {
+			rows = append(rows, nil)
+			x = 0
+		}
+		rows[len(rows)-1] = append(rows[len(rows)-1], cell)
+		x += w
+	}
+	return rows
+}
+
+// cells는 문자열을 한 가지 스타일의 칸으로 바꿉니다.
+func cells(text string, style ui.Style) []ui.Cell {
+	return ui.RunesToStyledCells([]rune(text), style)
+}
+
+// nickStyle은 닉네임마다 고정된 색을 반환합니다.
+func nickStyle(nick string) ui.Style {
+	h := fnv.New32a()
+	h.Write([]byte(nick))
+	return ui.NewStyle(nickColors[h.Sum32()%uint32(len(nickColors))], ui.ColorClear, ui.ModifierBold)
+}
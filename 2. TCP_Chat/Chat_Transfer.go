@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const maxTransfers = 4 // 한 사용자가 동시에 주고받을 수 있는 파일 수
+
+// transfer는 서버가 중계 중인 파일 전송 하나입니다.
+// 서버는 파일 내용을 저장하지 않고, 조각을 받는 즉시 상대에게 넘깁니다.
+type transfer struct {
+	id       string
+	from     *Client
+	to       *Client
+	name     string
+	size     int64
+	hash     string
+	accepted bool
+	sent     int64 // 받는 쪽에 넘긴 크기
+	acked    int64 // 받는 쪽이 받았다고 알려 온 크기
+}
+
+// fileFrame은 클라이언트가 보낸 파일 전송 프레임입니다.
+type fileFrame struct {
+	client *Client
+	frame  Frame
+}
+
+// peer는 c의 상대방을 반환합니다.
+func (t *transfer) peer(c *Client) *Client {
+	if c == t.from {
+		return t.to
+	}
+	return t.from
+}
+
+// relayFile은 파일 전송 프레임을 검사한 뒤 상대에게 전달합니다.
+// 보내는 쪽은 받는 쪽이 확인한 위치보다 fileWindow개 조각 이상 앞설 수 없으므로
+// 한 사람의 전송 큐에 조각이 쌓여 다른 메시지가 밀리지 않습니다.
+func (h *Hub) relayFile(c *Client, f Frame) {
+	if c.fc.Version < 5 {
+		h.fail(c, f.ID, "파일 전송을 지원하지 않는 클라이언트입니다.")
+		return
+	}
+	if f.Kind == KindFileOffer {
+		h.offerFile(c, f)
+		return
+	}
+
+	t := h.transfers[f.Transfer]
+	if t == nil || (c != t.from && c != t.to) {
+		h.fail(c, f.ID, "알 수 없는 파일 전송입니다: "+f.Transfer)
+		return
+	}
+	peer := t.peer(c)
+
+	switch f.Kind {
+	case KindFileAccept:
+		if c != t.to || t.accepted {
+			h.fail(c, f.ID, "수락할 수 없는 파일 전송입니다.")
+			return
+		}
+		t.accepted = true
+		fmt.Printf("파일 전송 수락: %s (%s -> %s)\n", t.id, t.from.nick, t.to.nick)
+		h.deliver(peer, Frame{Kind: KindFileAccept, Transfer: t.id, From: c.nick, Time: Timestamp()})
+
+	case KindFileChunk:
+		n := int64(len(f.Data))
+		switch {
+		case c != t.from || !t.accepted:
+			h.fail(c, f.ID, "아직 수락되지 않은 파일 전송입니다.")
+		case n == 0 || n > fileChunkSize || f.Offset != t.sent || t.sent+n > t.size:
+			h.cancelTransfer(t, "잘못된 파일 조각을 받았습니다.")
+		case t.sent+n-t.acked > fileWindow*fileChunkSize:
+			h.cancelTransfer(t, "받는 쪽의 확인 없이 너무 많은 조각을 보냈습니다.")
+		default:
+			t.sent += n
+			h.deliver(peer, Frame{Kind: KindFileChunk, Transfer: t.id, Offset: f.Offset, Data: f.Data})
+		}
+
+	case KindFileProgress:
+		if c != t.to || f.Offset < t.acked || f.Offset > t.sent {
+			h.cancelTransfer(t, "잘못된 진행 상황을 받았습니다.")
+			return
+		}
+		t.acked = f.Offset
+		h.deliver(peer, Frame{Kind: KindFileProgress, Transfer: t.id, Offset: f.Offset})
+
+	case KindFileDone:
+		if c == t.from {
+			if t.sent != t.size {
+				h.cancelTransfer(t, "파일을 끝까지 보내지 않았습니다.")
+				return
+			}
+			h.deliver(peer, Frame{Kind: KindFileDone, Transfer: t.id, From: c.nick, Hash: t.hash})
+			return
+		}
+		// 받는 쪽이 SHA-256 확인을 마침
+		if t.acked != t.size {
+			h.cancelTransfer(t, "파일을 끝까지 받지 않았습니다.")
+			return
+		}
+		delete(h.transfers, t.id)
+		fmt.Printf("파일 전송 완료: %s %s (%d바이트, %s -> %s)\n", t.id, t.name, t.size, t.from.nick, t.to.nick)
+		h.deliver(peer, Frame{Kind: KindFileDone, Transfer: t.id, From: c.nick, Hash: t.hash, Time: Timestamp()})
+
+	case KindFileCancel:
+		delete(h.transfers, t.id)
+		fmt.Printf("파일 전송 취소: %s (%s) %s\n", t.id, c.nick, f.Text)
+		h.deliver(peer, Frame{Kind: KindFileCancel, Transfer: t.id, From: c.nick, Text: f.Text, Time: Timestamp()})
+	}
+}
+
+// offerFile은 새 파일 전송을 등록하고 받는 사람에게 제안을 전달합니다.
+// 보낸 사람에게는 ack의 ID로 전송 ID를 알려 줍니다.
+func (h *Hub) offerFile(c *Client, f Frame) {
+	target := h.nicks[strings.ToLower(f.To)]
+	switch {
+	case target == nil:
+		h.fail(c, f.ID, "접속하지 않은 사용자입니다: "+f.To)
+		return
+	case target == c:
+		h.fail(c, f.ID, "자기 자신에게는 파일을 보낼 수 없습니다.")
+		return
+	case target.fc.Version < 5:
+		h.fail(c, f.ID, target.nick+" 님의 클라이언트는 파일 전송을 지원하지 않습니다.")
+		return
+	case h.isMuted(c):
+		h.fail(c, f.ID, "발언이 금지된 상태입니다.")
+		return
+	case f.Name == "" || f.Size <= 0 || len(f.Hash) != 64:
+		h.fail(c, f.ID, "파일 정보가 올바르지 않습니다.")
+		return
+	case f.Size > h.maxFileSize:
+		h.fail(c, f.ID, fmt.Sprintf("파일이 너무 큽니다. (최대 %d바이트)", h.maxFileSize))
+		return
+	case h.countTransfers(c) >= maxTransfers || h.countTransfers(target) >= maxTransfers:
+		h.fail(c, f.ID, "동시에 진행할 수 있는 파일 전송 수를 넘었습니다.")
+		return
+	}
+
+	h.nextTransfer++
+	t := &transfer{
+		id:   "f" + strconv.FormatUint(h.nextTransfer, 10),
+		from: c,
+		to:   target,
+		name: f.Name,
+		size: f.Size,
+		hash: f.Hash,
+	}
+	h.transfers[t.id] = t
+	fmt.Printf("파일 전송 제안: %s %s (%d바이트, %s -> %s)\n", t.id, t.name, t.size, c.nick, target.nick)
+	h.deliver(target, Frame{
+		Kind:     KindFileOffer,
+		Transfer: t.id,
+		From:     c.nick,
+		To:       target.nick,
+		Name:     t.name,
+		Size:     t.size,
+		Hash:     t.hash,
+		Time:     Timestamp(),
+	})
+	h.ack(c, f.ID, t.id)
+}
+
+// countTransfers는 c가 보내거나 받는 중인 전송 수를 셉니다.
+func (h *Hub) countTransfers(c *Client) int {
+	count := 0
+	for _, t := range h.transfers {
+		if t.from == c || t.to == c {
+			count++
+		}
+	}
+	return count
+}
+
+// cancelTransfer는 전송을 중단하고 양쪽에 이유를 알립니다.
+func (h *Hub) cancelTransfer(t *transfer, reason string) {
+	delete(h.transfers, t.id)
+	fmt.Printf("파일 전송 중단: %s %s\n", t.id, reason)
+	frame := Frame{Kind: KindFileCancel, Transfer: t.id, Text: reason, Time: Timestamp()}
+	h.deliver(t.from, frame)
+	h.deliver(t.to, frame)
+}
+
+// dropTransfers는 연결이 끊긴 클라이언트의 전송을 모두 정리하고 상대에게 알립니다.
+func (h *Hub) dropTransfers(c *Client) {
+	for id, t := range h.transfers {
+		if t.from != c && t.to != c {
+			continue
+		}
+		delete(h.transfers, id)
+		h.deliver(t.peer(c), Frame{Kind: KindFileCancel, Transfer: id, Text: "상대방의 연결이 끊어졌습니다.", Time: Timestamp()})
+	}
+}
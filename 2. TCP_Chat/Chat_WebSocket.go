@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	_ "embed"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// chatPage는 브라우저용 채팅 화면입니다.
+//
+//go:embed Chat_Web.html
+var chatPage []byte
+
+// 다른 사이트의 페이지가 사용자의 브라우저로 접속하지 못하도록
+// 기본 설정(같은 출처만 허용)을 그대로 사용
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+// wsConn은 WebSocket 연결을 net.Conn처럼 쓰도록 감쌉니다.
+// WebSocket 메시지 하나가 프레임 한 줄에 해당하므로, 읽을 때는 메시지 끝에
+// 줄바꿈을 붙이고 쓸 때는 줄바꿈을 떼어 메시지 하나로 보냅니다.
+// 덕분에 브라우저도 TCP 클라이언트와 같은 FrameConn, 같은 허브를 사용합니다.
+type wsConn struct {
+	*websocket.Conn
+	reader io.Reader // 읽는 중인 메시지
+}
+
+// Read는 받은 메시지들을 줄 단위 스트림으로 이어서 읽습니다.
+func (c *wsConn) Read(p []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			_, r, err := c.NextReader()
+			if err != nil {
+				return 0, err
+			}
+			c.reader = io.MultiReader(r, bytes.NewReader([]byte{'\n'}))
+		}
+		n, err := c.reader.Read(p)
+		if err == io.EOF {
+			c.reader = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+// Write는 프레임 한 줄을 텍스트 메시지 하나로 보냅니다.
+// FrameConn.WriteFrame은 프레임 하나를 한 번의 Write로 씁니다.
+func (c *wsConn) Write(p []byte) (int, error) {
+	if err := c.WriteMessage(websocket.TextMessage, bytes.TrimSuffix(p, []byte{'\n'})); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// SetDeadline은 읽기와 쓰기 제한 시간을 함께 정합니다.
+func (c *wsConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+// serveWebSocket은 브라우저용 HTTP 서버를 실행합니다.
+// "/"는 채팅 화면을, "/ws"는 WebSocket으로 전환한 뒤 handle로 연결을 넘깁니다.
+func serveWebSocket(addr string, tlsConfig *tls.Config, bans *BanList, handle func(net.Conn)) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(chatPage)
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			fmt.Println("WebSocket 전환 실패:", err)
+			return
+		}
+		ws.SetReadLimit(maxFrameSize)
+
+		conn := &wsConn{Conn: ws}
+		if bans.IsAddrBanned(conn.RemoteAddr()) {
+			fmt.Println("차단된 주소의 연결을 거부했습니다:", conn.RemoteAddr())
+			conn.Close()
+			return
+		}
+		fmt.Println("브라우저 클라이언트가 연결되었습니다:", conn.RemoteAddr())
+		handle(conn)
+	})
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if tlsConfig != nil {
+		return server.ListenAndServeTLS("", "")
+	}
+	return server.ListenAndServe()
+}
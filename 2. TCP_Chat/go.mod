@@ -0,0 +1,14 @@
+module TCP_Chat
+
+go 1.24
+
+require (
+	github.com/gizak/termui/v3 v3.1.0
+	github.com/gorilla/websocket v1.5.3
+	github.com/mattn/go-runewidth v0.0.2
+)
+
+require (
+	github.com/mitchellh/go-wordwrap v0.0.0-20150314170334-ad45545899c7 // indirect
+	github.com/nsf/termbox-go v0.0.0-20190121233118-02980233997d // indirect
+)
@@ -0,0 +1,515 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	apiKeyHeader     = "X-API-Key"
+	authRealm        = `Basic realm="file server", charset="UTF-8"`
+	passwordIter     = 600000 // PBKDF2-SHA256 반복 횟수
+	passwordSaltSize = 16
+	apiKeySize       = 32
+	maxUserName      = 32
+
+	loginCacheTTL      = 5 * time.Minute // 맞은 Basic 인증 정보를 다시 계산하지 않고 믿는 시간
+	maxCachedLogins    = 1024            // 기억해 두는 인증 정보 수
+	maxAuthFailures    = 10              // authFailureWindow 동안 주소나 사용자마다 허용하는 실패 수
+	authFailureWindow  = time.Minute
+	maxTrackedFailures = 4096 // 넘으면 창이 지난 실패 기록을 정리
+)
+
+// 사용자 오류
+var (
+	ErrInvalidUser   = errors.New("사용자 이름은 영문 소문자, 숫자, '-', '_'로 된 32자 이하여야 합니다")
+	ErrUserExists    = errors.New("이미 있는 사용자입니다")
+	ErrUnknownUser   = errors.New("없는 사용자입니다")
+	ErrQuotaExceeded = errors.New("저장 용량 한도를 넘었습니다")
+	ErrUnauthorized  = errors.New("인증이 필요합니다")
+	ErrTooManyLogins = errors.New("인증 실패가 너무 많습니다. 잠시 뒤에 다시 시도하세요")
+)
+
+// dummyPasswordHash는 없는 사용자의 비밀번호를 확인할 때 쓰는 해시입니다. 있는 사용자와
+// 같은 시간이 걸리게 해, 응답 시간으로 사용자 이름을 알아낼 수 없게 합니다.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := hashPassword("")
+	return hash
+})
+
+// User는 파일 서버의 사용자 한 명입니다.
+// 비밀번호와 API 키는 원래 값 대신 해시만 저장합니다.
+type User struct {
+	Name         string   `json:"name"`
+	PasswordHash string   `json:"password_hash"` // pbkdf2-sha256$반복횟수$솔트$해시
+	APIKeys      []string `json:"api_keys"`      // API 키의 SHA-256 (16진수)
+	Quota        int64    `json:"quota"`         // 저장 용량 한도 (바이트, 0이면 제한 없음)
+}
+
+// UserStore는 사용자 목록을 파일에 저장하고 요청의 인증 정보를 확인합니다.
+type UserStore struct {
+	mu       sync.Mutex
+	path     string
+	users    map[string]*User
+	keys     map[string]*User       // API 키 해시 -> 사용자
+	loginKey []byte                 // 기억해 두는 인증 정보의 HMAC 키 (실행할 때마다 새로 만듦)
+	logins   map[string]cachedLogin // 이름과 비밀번호의 HMAC -> 확인한 사용자
+	failures *failureLimiter        // "ip:주소" 또는 "user:이름"마다의 최근 실패
+}
+
+// cachedLogin은 확인을 마친 Basic 인증 정보입니다.
+type cachedLogin struct {
+	user    *User
+	expires time.Time
+}
+
+// authFailures는 authFailureWindow 동안의 인증 실패 수입니다.
+type authFailures struct {
+	count int
+	reset time.Time // 이 시각이 지나면 다시 0부터 셈
+}
+
+// failureLimiter는 키(주소, 사용자, 공유 링크 등)마다 비밀번호 확인 실패를 세어,
+// authFailureWindow 동안 maxAuthFailures번을 넘은 키는 PBKDF2를 계산하기 전에 거절하게 합니다.
+type failureLimiter struct {
+	mu       sync.Mutex
+	failures map[string]*authFailures
+}
+
+func newFailureLimiter() *failureLimiter {
+	return &failureLimiter{failures: make(map[string]*authFailures)}
+}
+
+// begin은 keys 중 하나라도 한도에 이르렀으면 false를 반환합니다. 아니면 모든 키에 시도를
+// 하나씩 세어 둡니다. 계산하는 동안 몰려든 요청도 막도록 결과를 알기 전에 세고,
+// 맞으면 succeed로 되돌립니다.
+func (l *failureLimiter) begin(keys []string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, key := range keys {
+		if f := l.failures[key]; f != nil && now.Before(f.reset) && f.count >= maxAuthFailures {
+			return false
+		}
+	}
+	for _, key := range keys {
+		f := l.failures[key]
+		if f == nil || !now.Before(f.reset) {
+			if len(l.failures) >= maxTrackedFailures {
+				for k, old := range l.failures {
+					if !now.Before(old.reset) {
+						delete(l.failures, k)
+					}
+				}
+			}
+			f = &authFailures{reset: now.Add(authFailureWindow)}
+			l.failures[key] = f
+		}
+		f.count++
+	}
+	return true
+}
+
+// succeed는 begin에서 센 시도를 되돌립니다.
+func (l *failureLimiter) succeed(keys []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		if f := l.failures[key]; f != nil && f.count > 0 {
+			f.count--
+		}
+	}
+}
+
+// LoadUsers는 path의 사용자 목록을 읽습니다. 파일이 없으면 빈 목록으로 시작합니다.
+func LoadUsers(path string) (*UserStore, error) {
+	u := &UserStore{
+		path:     path,
+		users:    make(map[string]*User),
+		keys:     make(map[string]*User),
+		loginKey: make([]byte, 32),
+		logins:   make(map[string]cachedLogin),
+		failures: newFailureLimiter(),
+	}
+	if _, err := rand.Read(u.loginKey); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return u, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*User
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	for _, user := range list {
+		u.users[user.Name] = user
+		for _, key := range user.APIKeys {
+			u.keys[key] = user
+		}
+	}
+	return u, nil
+}
+
+// Len은 등록된 사용자 수를 반환합니다.
+func (u *UserStore) Len() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return len(u.users)
+}
+
+// Add는 새 사용자를 만들고 첫 API 키를 발급해 반환합니다.
+func (u *UserStore) Add(name, password string, quota int64) (string, error) {
+	if !validUserName(name) {
+		return "", ErrInvalidUser
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return "", err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if _, ok := u.users[name]; ok {
+		return "", ErrUserExists
+	}
+	user := &User{Name: name, PasswordHash: hash, Quota: quota}
+	u.users[name] = user
+	return u.issueKey(user)
+}
+
+// NewKey는 사용자에게 API 키를 하나 더 발급합니다.
+func (u *UserStore) NewKey(name string) (string, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	user, ok := u.users[name]
+	if !ok {
+		return "", ErrUnknownUser
+	}
+	return u.issueKey(user)
+}
+
+// issueKey는 임의의 API 키를 만들어 해시를 저장하고 키를 반환합니다. u.mu를 잡은 상태에서 호출합니다.
+func (u *UserStore) issueKey(user *User) (string, error) {
+	buf := make([]byte, apiKeySize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	key := hex.EncodeToString(buf)
+	hash := hashAPIKey(key)
+	user.APIKeys = append(user.APIKeys, hash)
+	u.keys[hash] = user
+	return key, u.save()
+}
+
+// save는 사용자 목록을 임시 파일에 쓴 뒤 바꿔치기합니다. u.mu를 잡은 상태에서 호출합니다.
+func (u *UserStore) save() error {
+	list := make([]*User, 0, len(u.users))
+	for _, user := range u.users {
+		list = append(list, user)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(u.path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(u.path+".tmp", u.path)
+}
+
+// Authenticate는 X-API-Key 헤더나 Basic 인증으로 사용자를 확인합니다.
+// 인증 정보가 없거나 틀리면 ErrUnauthorized를, 실패가 너무 잦으면 ErrTooManyLogins를 반환합니다.
+func (u *UserStore) Authenticate(r *http.Request) (*User, error) {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		user, ok := u.keys[hashAPIKey(key)]
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		return user, nil
+	}
+
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+	return u.login(name, password, remoteHost(r))
+}
+
+// login은 Basic 인증의 이름과 비밀번호를 확인합니다.
+//
+// 브라우저와 도구는 요청마다 같은 인증 정보를 보내므로, 한 번 맞은 정보는 loginCacheTTL
+// 동안 기억해 두고 PBKDF2를 다시 계산하지 않습니다. 기억해 둔 정보에 맞지 않는 시도는
+// 주소(host)와 사용자마다 세어 너무 잦으면 계산하지 않고 거절합니다(failureLimiter 참고).
+// 없는 사용자도 가짜 해시로 같은 시간을 들여 확인합니다.
+func (u *UserStore) login(name, password, host string) (*User, error) {
+	mac := hmac.New(sha256.New, u.loginKey)
+	mac.Write([]byte(name + "\x00" + password))
+	cacheKey := string(mac.Sum(nil))
+	now := time.Now()
+
+	u.mu.Lock()
+	if login, ok := u.logins[cacheKey]; ok && now.Before(login.expires) {
+		u.mu.Unlock()
+		return login.user, nil
+	}
+	user, ok := u.users[name]
+	u.mu.Unlock()
+
+	keys := []string{"ip:" + host}
+	if ok {
+		// 없는 이름까지 세면 기록이 끝없이 늘어나므로 있는 사용자만 셈
+		keys = append(keys, "user:"+name)
+	}
+	if !u.failures.begin(keys, now) {
+		return nil, ErrTooManyLogins
+	}
+
+	stored := dummyPasswordHash()
+	if ok {
+		stored = user.PasswordHash
+	}
+	if !checkPassword(stored, password) || !ok {
+		return nil, ErrUnauthorized
+	}
+
+	u.failures.succeed(keys)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if len(u.logins) >= maxCachedLogins {
+		for key, login := range u.logins {
+			if !now.Before(login.expires) {
+				delete(u.logins, key)
+			}
+		}
+		if len(u.logins) >= maxCachedLogins {
+			clear(u.logins)
+		}
+	}
+	u.logins[cacheKey] = cachedLogin{user: user, expires: now.Add(loginCacheTTL)}
+	return user, nil
+}
+
+// remoteHost는 요청을 보낸 주소에서 포트를 뺀 부분입니다.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Require는 인증된 사용자만 handler를 호출하도록 감쌉니다.
+// 브라우저는 Basic 인증 정보를 다른 사이트에서 보낸 요청에도 붙이므로,
+// 다른 출처에서 온 변경 요청은 거부합니다.
+func (u *UserStore) Require(handler func(http.ResponseWriter, *http.Request, *User)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if crossOriginWrite(r) {
+			http.Error(w, "다른 사이트에서 보낸 요청은 허용하지 않습니다.", http.StatusForbidden)
+			fmt.Printf("다른 출처의 요청 거부: %s %s (Origin: %s)\n", r.Method, r.URL.Path, r.Header.Get("Origin"))
+			return
+		}
+		user, err := u.Authenticate(r)
+		if errors.Is(err, ErrTooManyLogins) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(authFailureWindow.Seconds())))
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			fmt.Printf("인증 시도 제한: %s %s (%s)\n", r.Method, r.URL.Path, r.RemoteAddr)
+			return
+		}
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", authRealm)
+			http.Error(w, "인증이 필요합니다.", http.StatusUnauthorized)
+			fmt.Printf("인증 실패: %s %s (%s)\n", r.Method, r.URL.Path, r.RemoteAddr)
+			return
+		}
+		setLogUser(r, user.Name)
+		handler(w, r, user)
+	}
+}
+
+// crossOriginWrite는 요청이 다른 출처의 페이지에서 보낸 변경 요청인지 확인합니다.
+// curl 같은 도구는 Origin 헤더를 보내지 않으므로 영향을 받지 않습니다.
+func crossOriginWrite(r *http.Request) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	parsed, err := url.Parse(origin)
+	return err != nil || parsed.Host != r.Host
+}
+
+// hashPassword는 비밀번호를 임의의 솔트와 함께 PBKDF2로 해시합니다.
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordIter, sha256.Size)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", passwordIter, hex.EncodeToString(salt), hex.EncodeToString(key)), nil
+}
+
+// checkPassword는 password가 저장된 해시와 같은지 확인합니다.
+func checkPassword(stored, password string) bool {
+	parts := strings.Split(stored, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iter, err := strconv.Atoi(parts[1])
+	if err != nil || iter < 1 {
+		return false
+	}
+	salt, err1 := hex.DecodeString(parts[2])
+	want, err2 := hex.DecodeString(parts[3])
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	got, err := pbkdf2.Key(sha256.New, password, salt, iter, len(want))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// hashAPIKey는 API 키를 저장하고 찾을 때 쓰는 해시입니다.
+// 키 자체가 충분히 길고 임의적이므로 솔트 없는 SHA-256으로 충분합니다.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// validUserName은 사용자 이름이 허용되는 형식인지 확인합니다.
+// 이름은 색인 키의 일부로 쓰이므로 '/' 같은 문자는 허용하지 않습니다.
+func validUserName(name string) bool {
+	if name == "" || len(name) > maxUserName {
+		return false
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseSize는 "1048576", "500K", "100M", "2G" 같은 크기를 바이트로 바꿉니다.
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSuffix(strings.TrimSpace(s), "B"))
+	unit := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		unit = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		unit = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		unit = 1 << 30
+	case strings.HasSuffix(s, "T"):
+		unit = 1 << 40
+	}
+	if unit > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("올바르지 않은 크기: %q", s)
+	}
+	if n > math.MaxInt64/unit {
+		return 0, fmt.Errorf("크기가 너무 큽니다: %q", s)
+	}
+	return n * unit, nil
+}
+
+// runUserCommand는 사용자 관리 명령을 실행합니다.
+//
+//	user add <이름> [용량 한도]   사용자 추가 (비밀번호는 표준 입력에서 읽음)
+//	user key <이름>               API 키 추가 발급
+//	user list                     사용자 목록
+func runUserCommand(users *UserStore, args []string) error {
+	if len(args) == 0 {
+		return errors.New("사용법: user add <이름> [용량 한도] | user key <이름> | user list")
+	}
+
+	switch {
+	case args[0] == "add" && (len(args) == 2 || len(args) == 3):
+		var quota int64
+		if len(args) == 3 {
+			q, err := parseSize(args[2])
+			if err != nil {
+				return err
+			}
+			quota = q
+		}
+		fmt.Print("비밀번호: ")
+		password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		password = strings.TrimRight(password, "\r\n")
+		if password == "" {
+			if err != nil {
+				return err
+			}
+			return errors.New("비밀번호가 비어 있습니다")
+		}
+		key, err := users.Add(args[1], password, quota)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("사용자 %s를 추가했습니다.\nAPI 키: %s\n(키는 다시 보여주지 않으니 안전한 곳에 보관하세요)\n", args[1], key)
+	case args[0] == "key" && len(args) == 2:
+		key, err := users.NewKey(args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("API 키: %s\n", key)
+	case args[0] == "list" && len(args) == 1:
+		users.mu.Lock()
+		defer users.mu.Unlock()
+		names := make([]string, 0, len(users.users))
+		for name := range users.users {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			user := users.users[name]
+			quota := "제한 없음"
+			if user.Quota > 0 {
+				quota = fmt.Sprintf("%d 바이트", user.Quota)
+			}
+			fmt.Printf("%s\t키 %d개\t용량 한도: %s\n", user.Name, len(user.APIKeys), quota)
+		}
+	default:
+		return errors.New("사용법: user add <이름> [용량 한도] | user key <이름> | user list")
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// quickHash는 테스트가 느려지지 않도록 반복 횟수를 줄인 비밀번호 해시입니다.
+func quickHash(t *testing.T, password string) string {
+	t.Helper()
+	salt := []byte("0123456789abcdef")
+	key, err := pbkdf2.Key(sha256.New, password, salt, 1, sha256.Size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprintf("pbkdf2-sha256$1$%s$%s", hex.EncodeToString(salt), hex.EncodeToString(key))
+}
+
+func TestAuthenticateBasic(t *testing.T) {
+	u, err := LoadUsers(filepath.Join(t.TempDir(), "users.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"alice", "bob"} {
+		u.users[name] = &User{Name: name, PasswordHash: quickHash(t, name+"-pw")}
+	}
+	login := func(name, password, remote string) error {
+		r := httptest.NewRequest("GET", "/files", nil)
+		r.SetBasicAuth(name, password)
+		r.RemoteAddr = remote
+		_, err := u.Authenticate(r)
+		return err
+	}
+
+	if err := login("alice", "alice-pw", "10.0.0.1:1000"); err != nil {
+		t.Fatalf("valid login: %v", err)
+	}
+	// 맞은 인증 정보는 기억해 두므로 해시를 다시 계산하지 않음
+	u.users["alice"].PasswordHash = "broken"
+	if err := login("alice", "alice-pw", "10.0.0.1:1001"); err != nil {
+		t.Errorf("cached login: %v", err)
+	}
+	if err := login("alice", "wrong", "10.0.0.1:1002"); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("wrong password after cached login: %v", err)
+	}
+	if err := login("nobody", "x", "10.0.0.3:1000"); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("unknown user: %v", err)
+	}
+	if _, ok := u.failures.failures["user:nobody"]; ok {
+		t.Error("failures recorded for unknown user")
+	}
+
+	for i := 0; i < maxAuthFailures; i++ {
+		if err := login("bob", "wrong", "10.0.0.2:1000"); !errors.Is(err, ErrUnauthorized) {
+			t.Fatalf("attempt %d: %v", i, err)
+		}
+	}
+	tests := []struct {
+		name, user, password, remote string
+		want                         error
+	}{
+		{"same address", "bob", "bob-pw", "10.0.0.2:2000", ErrTooManyLogins},
+		{"same user from another address", "bob", "bob-pw", "10.0.0.9:1000", ErrTooManyLogins},
+		{"cached login from limited address", "alice", "alice-pw", "10.0.0.2:3000", nil},
+	}
+	for _, tt := range tests {
+		if err := login(tt.user, tt.password, tt.remote); !errors.Is(err, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// 창이 지나면 다시 시도할 수 있음
+	for _, f := range u.failures.failures {
+		f.reset = f.reset.Add(-authFailureWindow)
+	}
+	if err := login("bob", "bob-pw", "10.0.0.2:4000"); err != nil {
+		t.Errorf("login after window: %v", err)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+		ok   bool
+	}{
+		{"0", 0, true},
+		{"1048576", 1 << 20, true},
+		{"500K", 500 << 10, true},
+		{"100m", 100 << 20, true},
+		{"2GB", 2 << 30, true},
+		{"8388607T", 8388607 << 40, true},
+		{"8388608T", 0, false}, // 2^63을 넘음
+		{"9000000T", 0, false},
+		{"9223372036854775807", math.MaxInt64, true},
+		{"9223372036854775808", 0, false},
+		{"-1", 0, false},
+		{"", 0, false},
+		{"1.5G", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v; want %d, ok %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Backend는 파일 내용과 색인이 실제로 저장되는 곳입니다.
+// 키는 "objects/ab/abcd..."처럼 '/'로 구분된 경로이며, Storage만 키를 만듭니다.
+type Backend interface {
+	// PutFile은 로컬 파일 path의 내용을 key에 저장합니다. 성공한 뒤 path는 남아 있지 않을 수 있습니다.
+	PutFile(key, path string) error
+	// Put은 작은 데이터(색인 등)를 key에 저장합니다.
+	Put(key string, data []byte) error
+	// Open은 key의 내용을 읽을 수 있도록 엽니다. 없으면 ErrNotFound를 반환합니다.
+	Open(key string) (io.ReadSeekCloser, error)
+	// Delete는 key를 지웁니다. 이미 없으면 성공으로 봅니다.
+	Delete(key string) error
+}
+
+// LocalBackend는 로컬 디렉토리에 저장합니다.
+type LocalBackend struct {
+	root string
+}
+
+// NewLocalBackend는 root 디렉토리를 쓰는 백엔드를 만듭니다.
+func NewLocalBackend(root string) (*LocalBackend, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &LocalBackend{root: root}, nil
+}
+
+// PutFile은 같은 파일 시스템이면 파일을 복사하지 않고 옮깁니다.
+func (b *LocalBackend) PutFile(key, path string) error {
+	dest := b.path(key)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	return os.Rename(path, dest)
+}
+
+// Put은 임시 파일에 쓴 뒤 바꿔치기해, 중간에 멈춰도 기존 내용이 깨지지 않게 합니다.
+func (b *LocalBackend) Put(key string, data []byte) error {
+	dest := b.path(key)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(dest+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(dest+".tmp", dest)
+}
+
+func (b *LocalBackend) Open(key string) (io.ReadSeekCloser, error) {
+	file, err := os.Open(b.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+func (b *LocalBackend) Delete(key string) error {
+	if err := os.Remove(b.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// path는 key에 해당하는 로컬 경로입니다.
+func (b *LocalBackend) path(key string) string {
+	return filepath.Join(b.root, filepath.FromSlash(key))
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// 저장할 때 쓸 수 있는 압축 방식. 값은 그대로 Content-Encoding 헤더에 씁니다.
+const (
+	encodingGzip = "gzip"
+	encodingZstd = "zstd"
+)
+
+// compressibleTypes는 압축해서 저장할 MIME 형식입니다. 이미지, 동영상, 압축 파일처럼
+// 이미 압축된 형식은 다시 압축해도 줄지 않으므로 넣지 않습니다.
+var compressibleTypes = map[string]bool{
+	"application/json":       true,
+	"application/xml":        true,
+	"application/javascript": true,
+	"application/x-tar":      true,
+	"application/wasm":       true,
+	"application/pdf":        true,
+	"image/svg+xml":          true,
+	"image/bmp":              true,
+}
+
+// validEncoding은 enc가 지원하는 압축 방식인지 확인합니다. ""는 압축하지 않음을 뜻합니다.
+func validEncoding(enc string) bool {
+	return enc == "" || enc == encodingGzip || enc == encodingZstd
+}
+
+// compressible은 mimeType의 파일을 압축해서 저장할 가치가 있는지 판단합니다.
+func compressible(mimeType string) bool {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") || compressibleTypes[mediaType]
+}
+
+// newEncoder는 w에 enc 방식으로 압축해 쓰는 Writer를 만듭니다. 다 쓰면 Close해야 합니다.
+func newEncoder(w io.Writer, enc string) (io.WriteCloser, error) {
+	switch enc {
+	case encodingGzip:
+		return gzip.NewWriter(w), nil
+	case encodingZstd:
+		return zstd.NewWriter(w)
+	}
+	return nil, fmt.Errorf("지원하지 않는 압축 방식: %q", enc)
+}
+
+// newDecoder는 enc 방식으로 압축된 r을 풀어 읽는 Reader를 만듭니다.
+func newDecoder(r io.Reader, enc string) (io.ReadCloser, error) {
+	switch enc {
+	case encodingGzip:
+		return gzip.NewReader(r)
+	case encodingZstd:
+		dec, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("지원하지 않는 압축 방식: %q", enc)
+}
+
+// decodedFile은 압축된 파일을 원래 내용처럼 읽고 이동할 수 있게 합니다.
+// 원래 크기를 알고 있으므로 끝으로 이동은 바로 되고, 앞으로 이동하면 처음부터
+// 다시 풀고, 뒤로 이동하면 그만큼 풀어서 버립니다. http.ServeContent가 범위 요청을
+// 처리할 때 쓰기 위한 것입니다.
+type decodedFile struct {
+	file     io.ReadSeeker
+	encoding string
+	size     int64         // 압축을 푼 크기
+	pos      int64         // 다음에 읽을 위치
+	dec      io.ReadCloser // 압축을 푸는 중인 Reader
+	decPos   int64         // dec가 다음에 돌려줄 위치
+}
+
+func newDecodedFile(file io.ReadSeeker, enc string, size int64) *decodedFile {
+	return &decodedFile{file: file, encoding: enc, size: size}
+}
+
+func (d *decodedFile) Read(p []byte) (int, error) {
+	if d.pos >= d.size {
+		return 0, io.EOF
+	}
+	if d.dec == nil || d.decPos > d.pos {
+		if err := d.rewind(); err != nil {
+			return 0, err
+		}
+	}
+	if d.decPos < d.pos {
+		skipped, err := io.CopyN(io.Discard, d.dec, d.pos-d.decPos)
+		d.decPos += skipped
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := d.dec.Read(p)
+	d.pos += int64(n)
+	d.decPos += int64(n)
+	return n, err
+}
+
+func (d *decodedFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += d.pos
+	case io.SeekEnd:
+		offset += d.size
+	default:
+		return 0, errors.New("잘못된 whence: " + strconv.Itoa(whence))
+	}
+	if offset < 0 {
+		return 0, errors.New("음수 위치로 이동할 수 없습니다")
+	}
+	d.pos = offset
+	return offset, nil
+}
+
+// Close는 압축을 푸는 Reader만 닫습니다. 파일은 연 쪽에서 닫습니다.
+func (d *decodedFile) Close() error {
+	if d.dec == nil {
+		return nil
+	}
+	return d.dec.Close()
+}
+
+// rewind는 파일의 처음부터 다시 압축을 풀기 시작합니다.
+func (d *decodedFile) rewind() error {
+	if d.dec != nil {
+		d.dec.Close()
+		d.dec = nil
+	}
+	if _, err := d.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	dec, err := newDecoder(d.file, d.encoding)
+	if err != nil {
+		return err
+	}
+	d.dec = dec
+	d.decPos = 0
+	return nil
+}
+
+// acceptsEncoding은 Accept-Encoding 헤더가 enc를 받아들이는지 확인합니다.
+// "gzip;q=0"처럼 품질 값이 0이면 받지 않는 것으로 봅니다.
+func acceptsEncoding(header, enc string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), enc) && strings.TrimSpace(name) != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
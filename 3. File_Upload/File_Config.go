@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Config는 서버 설정입니다. 설정 파일(JSON)과 명령줄 플래그로 정하며,
+// 둘 다 있으면 명령줄에 직접 준 값이 이깁니다.
+//
+//	{
+//	  "listen": ":8443",
+//	  "dir": "/var/lib/fileup",
+//	  "max_upload": "2G",
+//	  "deny_types": "application/x-msdownload",
+//	  "tls_cert": "cert.pem",
+//	  "tls_key": "key.pem"
+//	}
+//
+// S3 접근 키는 파일에 남지 않도록 설정에 넣지 않고 환경 변수로만 받습니다.
+//
+// storage를 s3로 해도 버킷에는 파일 내용과 색인만 저장합니다. 사용자 목록(users.json),
+// 공유 링크(share.key, shares.json), 이어받기 세션(sessions/)과 임시 파일은 언제나
+// dir의 로컬 디스크에 남으므로, 서버를 옮기거나 여러 대가 같은 버킷을 쓸 때는 함께
+// 옮기거나 나눠 써야 합니다.
+type Config struct {
+	Listen          string   `json:"listen"`           // 요청을 받을 주소
+	Dir             string   `json:"dir"`              // 임시 파일, 세션, 사용자 목록, 공유 링크를 두는 로컬 디렉토리
+	Users           string   `json:"users"`            // 사용자 목록 파일 (기본값: <dir>/users.json)
+	Storage         string   `json:"storage"`          // 파일을 저장할 곳 (local, s3)
+	S3Endpoint      string   `json:"s3_endpoint"`      // S3 호환 서버 주소
+	S3Bucket        string   `json:"s3_bucket"`        // S3 버킷 이름
+	S3Region        string   `json:"s3_region"`        // S3 리전
+	Compress        string   `json:"compress"`         // 저장할 때 쓸 압축 방식 ("", gzip, zstd)
+	SessionTTL      Duration `json:"session_ttl"`      // 이어받기 세션을 유지하는 시간
+	MaxUpload       string   `json:"max_upload"`       // 파일 하나의 최대 크기 ("0"이면 제한 없음)
+	AllowTypes      string   `json:"allow_types"`      // 받을 MIME 형식 (쉼표로 구분)
+	DenyTypes       string   `json:"deny_types"`       // 받지 않을 MIME 형식 (쉼표로 구분)
+	ScanCommand     string   `json:"scan_cmd"`         // 업로드마다 실행할 검사 명령
+	ScanTimeout     Duration `json:"scan_timeout"`     // 검사 명령을 기다리는 최대 시간
+	TLSCert         string   `json:"tls_cert"`         // TLS 인증서 파일 (비우면 HTTP)
+	TLSKey          string   `json:"tls_key"`          // TLS 개인 키 파일
+	AccessLog       string   `json:"access_log"`       // 접근 기록을 남길 파일 (기본값: <dir>/access.log, "-"이면 표준 출력)
+	ShutdownTimeout Duration `json:"shutdown_timeout"` // 종료할 때 받는 중인 요청을 기다리는 시간
+}
+
+// Duration은 설정 파일에 "24h"처럼 쓰는 시간 간격입니다. 명령줄 플래그로도 쓸 수 있습니다.
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("올바르지 않은 시간 간격: %q", s)
+	}
+	d.Duration = v
+	return nil
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("시간 간격은 \"30s\"처럼 문자열로 씁니다: %s", data)
+	}
+	return d.Set(s)
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// defaultConfig는 설정 파일이나 플래그로 바꾸지 않았을 때의 값입니다.
+func defaultConfig() *Config {
+	return &Config{
+		Listen:          defaultListen,
+		Dir:             defaultUploadDir,
+		Storage:         "local",
+		S3Region:        "us-east-1",
+		SessionTTL:      Duration{defaultSessionTTL},
+		MaxUpload:       defaultMaxUpload,
+		ScanTimeout:     Duration{defaultScanTimeout},
+		ShutdownTimeout: Duration{defaultShutdownTimeout},
+	}
+}
+
+// loadConfig는 명령줄을 읽어 설정을 만듭니다. -config로 설정 파일을 주면 그 내용을
+// 먼저 적용하고, 명령줄에 직접 준 플래그로 다시 덮어씁니다.
+func loadConfig() (*Config, error) {
+	cfg := defaultConfig()
+	configPath := flag.String("config", "", "설정 파일 (JSON)")
+	flag.StringVar(&cfg.Listen, "listen", cfg.Listen, "요청을 받을 주소")
+	flag.StringVar(&cfg.Dir, "dir", cfg.Dir, "임시 파일, 세션, 사용자 목록, 공유 링크를 두는 로컬 디렉토리 (local 저장소면 파일도 여기에 저장)")
+	flag.StringVar(&cfg.Users, "users", cfg.Users, "사용자 목록 파일 (기본값: <dir>/users.json)")
+	flag.StringVar(&cfg.Storage, "storage", cfg.Storage, "파일을 저장할 곳 (local 또는 s3)")
+	flag.StringVar(&cfg.S3Endpoint, "s3-endpoint", cfg.S3Endpoint, "S3 호환 서버 주소 (예: http://localhost:9000)")
+	flag.StringVar(&cfg.S3Bucket, "s3-bucket", cfg.S3Bucket, "S3 버킷 이름")
+	flag.StringVar(&cfg.S3Region, "s3-region", cfg.S3Region, "S3 리전")
+	flag.StringVar(&cfg.Compress, "compress", cfg.Compress, "텍스트 같은 파일을 저장할 때 쓸 압축 방식 (gzip 또는 zstd, 비우면 압축하지 않음)")
+	flag.Var(&cfg.SessionTTL, "session-ttl", "이어받기 업로드 세션을 더 받지 않으면 정리하기까지의 시간")
+	flag.StringVar(&cfg.MaxUpload, "max-upload", cfg.MaxUpload, "파일 하나의 최대 크기 (예: 500M, 0이면 제한 없음)")
+	flag.StringVar(&cfg.AllowTypes, "allow-types", cfg.AllowTypes, "받을 MIME 형식 (쉼표로 구분, 예: image/*,application/pdf, 비우면 모두)")
+	flag.StringVar(&cfg.DenyTypes, "deny-types", cfg.DenyTypes, "받지 않을 MIME 형식 (쉼표로 구분, 허용 목록보다 먼저 적용)")
+	flag.StringVar(&cfg.ScanCommand, "scan-cmd", cfg.ScanCommand, "업로드마다 실행할 검사 명령 (파일 경로를 끝에 붙임, 종료 코드 1이면 거부)")
+	flag.Var(&cfg.ScanTimeout, "scan-timeout", "검사 명령을 기다리는 최대 시간")
+	flag.StringVar(&cfg.TLSCert, "tls-cert", cfg.TLSCert, "TLS 인증서 파일 (주면 HTTPS로 받음)")
+	flag.StringVar(&cfg.TLSKey, "tls-key", cfg.TLSKey, "TLS 개인 키 파일")
+	flag.StringVar(&cfg.AccessLog, "access-log", cfg.AccessLog, "접근 기록을 남길 파일 (기본값: <dir>/access.log, -이면 진행 상황과 함께 표준 출력)")
+	flag.Var(&cfg.ShutdownTimeout, "shutdown-timeout", "종료할 때 받는 중인 요청이 끝나기를 기다리는 최대 시간")
+	flag.Parse()
+
+	if *configPath != "" {
+		// 파일 내용이 명령줄 값을 덮어쓰므로, 직접 준 플래그를 기억했다가 다시 적용
+		given := make(map[string]string)
+		flag.Visit(func(f *flag.Flag) {
+			given[f.Name] = f.Value.String()
+		})
+		if err := readConfigFile(*configPath, cfg); err != nil {
+			return nil, err
+		}
+		for name, value := range given {
+			flag.Set(name, value)
+		}
+	}
+
+	if cfg.Users == "" {
+		cfg.Users = filepath.Join(cfg.Dir, "users.json")
+	}
+	if cfg.AccessLog == "" {
+		cfg.AccessLog = filepath.Join(cfg.Dir, "access.log")
+	}
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return nil, errors.New("TLS 인증서와 개인 키는 함께 지정해야 합니다")
+	}
+	return cfg, nil
+}
+
+// readConfigFile은 path의 설정을 cfg에 덮어씁니다. 파일에 없는 항목은 그대로 둡니다.
+// 항목 이름을 잘못 쓰면 조용히 무시되지 않도록 오류로 처리합니다.
+func readConfigFile(path string, cfg *Config) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	dec := json.NewDecoder(file)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return fmt.Errorf("설정 파일 %s를 읽을 수 없습니다: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultListLimit = 100  // limit을 주지 않았을 때 한 번에 돌려주는 파일 수
+	maxListLimit     = 1000 // limit의 최대값
+)
+
+// listQuery는 파일 목록 요청의 조건입니다.
+//
+//	prefix  이름이 이 문자열로 시작하는 파일만
+//	sort    name, size, type, time(기본값) 중 하나
+//	order   asc(기본값) 또는 desc
+//	offset  앞에서 건너뛸 개수
+//	limit   돌려줄 최대 개수
+type listQuery struct {
+	Prefix string
+	Sort   string
+	Desc   bool
+	Offset int
+	Limit  int
+}
+
+// listPage는 JSON 목록 응답입니다. Total은 페이지로 나누기 전의 개수입니다.
+type listPage struct {
+	Total  int        `json:"total"`
+	Offset int        `json:"offset"`
+	Limit  int        `json:"limit"`
+	Files  []FileMeta `json:"files"`
+}
+
+// parseListQuery는 URL 쿼리에서 목록 조건을 읽습니다.
+func parseListQuery(values url.Values) (listQuery, error) {
+	q := listQuery{
+		Prefix: values.Get("prefix"),
+		Sort:   values.Get("sort"),
+		Limit:  defaultListLimit,
+	}
+
+	switch q.Sort {
+	case "":
+		q.Sort = "time"
+	case "name", "size", "type", "time":
+	default:
+		return q, errors.New("sort는 name, size, type, time 중 하나여야 합니다")
+	}
+
+	switch values.Get("order") {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return q, errors.New("order는 asc 또는 desc여야 합니다")
+	}
+
+	if s := values.Get("offset"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return q, errors.New("offset이 올바르지 않습니다")
+		}
+		q.Offset = n
+	}
+	if s := values.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxListLimit {
+			return q, errors.New("limit은 1에서 1000 사이여야 합니다")
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+// apply는 files를 거르고 정렬한 뒤 요청한 페이지를 잘라 반환합니다.
+func (q listQuery) apply(files []FileMeta) listPage {
+	matched := files[:0]
+	for _, meta := range files {
+		if strings.HasPrefix(meta.Name, q.Prefix) {
+			matched = append(matched, meta)
+		}
+	}
+
+	// 같은 값끼리는 ID 순서로 정렬해 페이지를 넘겨도 순서가 흔들리지 않게 함
+	less := func(a, b FileMeta) bool {
+		switch q.Sort {
+		case "name":
+			if a.Name != b.Name {
+				return a.Name < b.Name
+			}
+		case "size":
+			if a.Size != b.Size {
+				return a.Size < b.Size
+			}
+		case "type":
+			if a.MIMEType != b.MIMEType {
+				return a.MIMEType < b.MIMEType
+			}
+		default:
+			if !a.UploadedAt.Equal(b.UploadedAt) {
+				return a.UploadedAt.Before(b.UploadedAt)
+			}
+		}
+		return a.ID < b.ID
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if q.Desc {
+			return less(matched[j], matched[i])
+		}
+		return less(matched[i], matched[j])
+	})
+
+	page := listPage{Total: len(matched), Offset: q.Offset, Limit: q.Limit, Files: []FileMeta{}}
+	if q.Offset < len(matched) {
+		end := min(q.Offset+q.Limit, len(matched))
+		page.Files = matched[q.Offset:end]
+	}
+	return page
+}
+
+// wantsJSON은 요청이 JSON 응답을 원하는지 확인합니다.
+// ?format=json 이나 Accept: application/json 으로 요청할 수 있습니다.
+func wantsJSON(values url.Values, accept string) bool {
+	if format := values.Get("format"); format != "" {
+		return format == "json"
+	}
+	return strings.Contains(accept, "application/json")
+}
@@ -0,0 +1,495 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 이어받기 업로드는 tus(https://tus.io) 프로토콜의 방식을 따릅니다.
+//
+//	POST   /uploads/       세션 생성 (Upload-Length, Upload-Metadata: filename <base64>)
+//	HEAD   /uploads/<id>   지금까지 받은 크기 조회 (Upload-Offset)
+//	PATCH  /uploads/<id>   Upload-Offset 위치부터 이어 쓰기 (PUT도 허용)
+//	POST   /uploads/<id>   완료 처리 (Upload-Checksum: sha256 <base64 또는 16진수>)
+//	DELETE /uploads/<id>   세션 취소
+const (
+	tusVersion          = "1.0.0"
+	sessionIDLength     = 16             // 세션 ID 바이트 수 (16진수로 32자)
+	sessionSweepPeriod  = time.Minute    // 만료된 세션을 정리하는 주기
+	defaultSessionTTL   = 24 * time.Hour // 마지막으로 받은 뒤 세션이 유지되는 시간
+	statusChecksumError = 460            // tus의 "Checksum Mismatch" 상태 코드
+	maxUploadLength     = int64(1) << 40 // 한 세션에서 받을 수 있는 최대 크기
+	maxUserSessions     = 16             // 사용자 한 명이 동시에 열어 둘 수 있는 세션 수
+	sessionDirName      = "sessions"     // 세션 정보와 받는 중인 파일을 두는 디렉토리
+)
+
+// 이어받기 세션 오류
+var (
+	ErrOffsetMismatch = errors.New("업로드 위치가 맞지 않습니다")
+	ErrUploadTooLarge = errors.New("세션에 정한 크기를 넘었습니다")
+	ErrIncomplete     = errors.New("아직 업로드가 끝나지 않았습니다")
+	ErrTooManyUploads = errors.New("진행 중인 업로드 세션이 너무 많습니다")
+)
+
+// uploadSession은 받는 중인 파일 하나입니다.
+// 받은 내용은 <id>.part에, 이름과 전체 크기는 <id>.json에 저장되므로
+// 서버가 다시 시작되어도 이어서 받을 수 있습니다.
+type uploadSession struct {
+	mu      sync.Mutex
+	ID      string    `json:"id"`
+	Owner   string    `json:"owner"`
+	Name    string    `json:"name"`
+	Length  int64     `json:"length"` // 전체 크기
+	Created time.Time `json:"created"`
+	offset  int64     // 지금까지 받은 크기 (.part 파일 크기)
+	expires time.Time // 이 시각까지 더 받지 못하면 정리됨
+	done    bool      // 완료 또는 취소되어 더는 쓸 수 없음
+}
+
+// SessionStore는 이어받기 세션을 관리하고 오래된 세션을 정리합니다.
+type SessionStore struct {
+	mu       sync.Mutex
+	dir      string
+	ttl      time.Duration
+	sessions map[string]*uploadSession
+}
+
+// OpenSessionStore는 dir에 남아 있는 세션을 불러옵니다.
+// 받은 크기는 .part 파일의 크기로, 만료 시각은 마지막으로 쓴 시각으로 정합니다.
+func OpenSessionStore(dir string, ttl time.Duration) (*SessionStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	m := &SessionStore{dir: dir, ttl: ttl, sessions: make(map[string]*uploadSession)}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || !validSessionID(id) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		sess := &uploadSession{}
+		if err := json.Unmarshal(data, sess); err != nil || sess.ID != id {
+			fmt.Printf("세션 정보가 손상되어 버립니다: %s\n", id)
+			m.removeFiles(id)
+			continue
+		}
+		info, err := os.Stat(m.partPath(id))
+		if err != nil {
+			fmt.Printf("받던 파일이 없어 세션을 버립니다: %s\n", id)
+			m.removeFiles(id)
+			continue
+		}
+		sess.offset = info.Size()
+		sess.expires = info.ModTime().Add(ttl)
+		m.sessions[id] = sess
+	}
+	return m, nil
+}
+
+// Create는 owner의 새 세션을 만듭니다. 세션은 다 받기 전부터 정한 크기만큼 용량을
+// 차지하는 것으로 보므로, 저장소 사용량에 진행 중인 세션들의 크기를 더해 quota를
+// 넘으면 ErrQuotaExceeded를, 이미 maxUserSessions개를 열어 두었으면 ErrTooManyUploads를
+// 반환합니다. 확인과 등록 사이에 다른 세션이 끼어들지 않도록 m.mu를 잡은 채로 만듭니다.
+func (m *SessionStore) Create(owner, name string, length int64, storage *Storage, quota int64) (*uploadSession, error) {
+	name, err := sanitizeName(name)
+	if err != nil {
+		return nil, err
+	}
+	if length < 0 || length > maxUploadLength {
+		return nil, ErrUploadTooLarge
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count, reserved := m.reserved(owner)
+	if count >= maxUserSessions {
+		return nil, ErrTooManyUploads
+	}
+	if quota > 0 && storage.Usage(owner)+reserved+length > quota {
+		return nil, ErrQuotaExceeded
+	}
+
+	buf := make([]byte, sessionIDLength)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	sess := &uploadSession{
+		ID:      hex.EncodeToString(buf),
+		Owner:   owner,
+		Name:    name,
+		Length:  length,
+		Created: time.Now().UTC(),
+		expires: time.Now().Add(m.ttl),
+	}
+
+	part, err := os.OpenFile(m.partPath(sess.ID), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+	part.Close()
+
+	data, err := json.Marshal(sess)
+	if err != nil {
+		m.removeFiles(sess.ID)
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(m.dir, sess.ID+".json"), data, 0644); err != nil {
+		m.removeFiles(sess.ID)
+		return nil, err
+	}
+
+	m.sessions[sess.ID] = sess
+	return sess, nil
+}
+
+// reserved는 owner가 열어 둔 세션 수와 그 세션들에 정한 크기의 합을 반환합니다.
+// m.mu를 잡은 상태에서 호출합니다.
+func (m *SessionStore) reserved(owner string) (int, int64) {
+	var count int
+	var total int64
+	for _, sess := range m.sessions {
+		if sess.Owner == owner {
+			count++
+			total += sess.Length
+		}
+	}
+	return count, total
+}
+
+// Get은 owner의 진행 중인 세션을 찾습니다. 다른 사용자의 세션은 없는 것으로 취급합니다.
+func (m *SessionStore) Get(owner, id string) (*uploadSession, error) {
+	if !validSessionID(id) {
+		return nil, ErrInvalidID
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sess, ok := m.sessions[id]
+	if !ok || sess.Owner != owner {
+		return nil, ErrNotFound
+	}
+	return sess, nil
+}
+
+// Append는 offset 위치부터 r의 내용을 이어 씁니다. offset이 지금까지 받은
+// 크기와 다르면 ErrOffsetMismatch를 반환합니다. 중간에 연결이 끊겨도 그때까지
+// 받은 부분은 남겨 두므로, 클라이언트는 HEAD로 위치를 다시 물어 이어 보내면 됩니다.
+func (m *SessionStore) Append(sess *uploadSession, offset int64, r io.Reader) (int64, error) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if sess.done {
+		return 0, ErrNotFound
+	}
+	if offset != sess.offset {
+		return sess.offset, ErrOffsetMismatch
+	}
+
+	part, err := os.OpenFile(m.partPath(sess.ID), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return sess.offset, err
+	}
+	defer part.Close()
+
+	// 정한 크기보다 1바이트 더 읽어 보고 넘치면 거부
+	remaining := sess.Length - sess.offset
+	written, err := io.Copy(part, io.LimitReader(r, remaining+1))
+	if written > remaining {
+		part.Truncate(sess.Length)
+		written = remaining
+		err = ErrUploadTooLarge
+	}
+	sess.offset += written
+	sess.expires = time.Now().Add(m.ttl)
+	return sess.offset, err
+}
+
+// Finish는 다 받은 파일의 체크섬을 확인하고 저장소로 옮긴 뒤 세션을 지웁니다.
+// 체크섬이 다르면 받은 내용을 되돌릴 방법이 없으므로 세션도 함께 버립니다.
+// 용량 한도를 넘으면 세션을 남겨 두므로, 다른 파일을 지운 뒤 다시 완료할 수 있습니다.
+func (m *SessionStore) Finish(sess *uploadSession, storage *Storage, checksum string, quota int64) (FileMeta, error) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if sess.done {
+		return FileMeta{}, ErrNotFound
+	}
+	if sess.offset != sess.Length {
+		return FileMeta{}, ErrIncomplete
+	}
+
+	meta, err := storage.Import(sess.Owner, sess.Name, m.partPath(sess.ID), checksum, quota)
+	if err != nil && !errors.Is(err, ErrChecksum) {
+		return FileMeta{}, err
+	}
+	m.remove(sess)
+	return meta, err
+}
+
+// Cancel은 세션과 받던 내용을 지웁니다.
+func (m *SessionStore) Cancel(sess *uploadSession) error {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if sess.done {
+		return ErrNotFound
+	}
+	m.remove(sess)
+	return nil
+}
+
+// Sweep은 만료된 세션을 정리합니다. 받는 중이라 잠겨 있는 세션은 건너뜁니다.
+func (m *SessionStore) Sweep() {
+	now := time.Now()
+	for _, sess := range m.snapshot() {
+		if !sess.mu.TryLock() {
+			continue
+		}
+		if !sess.done && now.After(sess.expires) {
+			fmt.Printf("만료된 업로드 세션을 정리했습니다: %s (%s, %d/%d 바이트)\n",
+				sess.ID, sess.Name, sess.offset, sess.Length)
+			m.remove(sess)
+		}
+		sess.mu.Unlock()
+	}
+}
+
+// RunSweeper는 주기적으로 Sweep을 실행합니다. 고루틴으로 실행합니다.
+func (m *SessionStore) RunSweeper() {
+	ticker := time.NewTicker(sessionSweepPeriod)
+	defer ticker.Stop()
+	for range ticker.C {
+		m.Sweep()
+	}
+}
+
+// snapshot은 지금 있는 세션 목록을 복사해 반환합니다.
+func (m *SessionStore) snapshot() []*uploadSession {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := make([]*uploadSession, 0, len(m.sessions))
+	for _, sess := range m.sessions {
+		list = append(list, sess)
+	}
+	return list
+}
+
+// remove는 세션을 목록과 디스크에서 지웁니다. sess.mu를 잡은 상태에서 호출합니다.
+func (m *SessionStore) remove(sess *uploadSession) {
+	sess.done = true
+	m.mu.Lock()
+	delete(m.sessions, sess.ID)
+	m.mu.Unlock()
+	m.removeFiles(sess.ID)
+}
+
+// removeFiles는 세션의 파일들을 지웁니다. 이미 저장소로 옮겨진 .part는 없어도 됩니다.
+func (m *SessionStore) removeFiles(id string) {
+	os.Remove(m.partPath(id))
+	os.Remove(filepath.Join(m.dir, id+".json"))
+}
+
+// partPath는 받는 중인 내용이 쓰이는 경로입니다.
+func (m *SessionStore) partPath(id string) string {
+	return filepath.Join(m.dir, id+".part")
+}
+
+// validSessionID는 id가 세션 ID 형식(16진수 32자)인지 확인합니다.
+func validSessionID(id string) bool {
+	if len(id) != sessionIDLength*2 {
+		return false
+	}
+	for _, c := range id {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// 이어받기 업로드 핸들러
+func handleResumable(w http.ResponseWriter, r *http.Request, user *User) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	id := strings.TrimPrefix(r.URL.Path, "/uploads/")
+
+	if id == "" {
+		switch r.Method {
+		case http.MethodOptions:
+			w.Header().Set("Tus-Version", tusVersion)
+			w.Header().Set("Tus-Extension", "creation,expiration,checksum,termination")
+			w.Header().Set("Tus-Checksum-Algorithm", "sha256")
+			w.Header().Set("Tus-Max-Size", strconv.FormatInt(maxSessionLength(), 10))
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodPost:
+			createSession(w, r, user)
+		default:
+			http.Error(w, "POST 요청만 가능합니다.", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	sess, err := sessions.Get(user.Name, id)
+	if err != nil {
+		storageError(w, err, "업로드 세션 조회")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead:
+		sess.mu.Lock()
+		offset, expires := sess.offset, sess.expires
+		sess.mu.Unlock()
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(sess.Length, 10))
+		w.Header().Set("Upload-Expires", expires.UTC().Format(http.TimeFormat))
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPatch, http.MethodPut:
+		appendChunk(w, r, sess)
+	case http.MethodPost:
+		finishSession(w, r, sess, user)
+	case http.MethodDelete:
+		if err := sessions.Cancel(sess); err != nil {
+			storageError(w, err, "업로드 취소")
+			return
+		}
+		fmt.Printf("업로드 세션 취소: %s (%s)\n", sess.ID, sess.Name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "지원하지 않는 요청입니다.", http.StatusMethodNotAllowed)
+	}
+}
+
+// createSession은 Upload-Length와 Upload-Metadata로 새 세션을 만듭니다.
+func createSession(w http.ResponseWriter, r *http.Request, user *User) {
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil {
+		http.Error(w, "Upload-Length 헤더가 올바르지 않습니다.", http.StatusBadRequest)
+		return
+	}
+	metadata := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	name := metadata["filename"]
+	if name == "" {
+		name = metadata["name"]
+	}
+
+	if length > maxSessionLength() {
+		storageError(w, ErrFileTooLarge, "업로드 세션 생성")
+		return
+	}
+
+	// 다 받아도 한도를 넘을 것이 확실하면 처음부터 거절
+	sess, err := sessions.Create(user.Name, name, length, storage, user.Quota)
+	if err != nil {
+		storageError(w, err, "업로드 세션 생성")
+		return
+	}
+
+	fmt.Printf("업로드 세션 생성: %s (%s, %d 바이트)\n", sess.ID, sess.Name, sess.Length)
+	w.Header().Set("Location", "/uploads/"+sess.ID)
+	w.Header().Set("Upload-Expires", sess.expires.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// appendChunk는 Upload-Offset 위치부터 요청 본문을 이어 씁니다.
+func appendChunk(w http.ResponseWriter, r *http.Request, sess *uploadSession) {
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		http.Error(w, "Upload-Offset 헤더가 올바르지 않습니다.", http.StatusBadRequest)
+		return
+	}
+
+	newOffset, err := sessions.Append(sess, offset, r.Body)
+	w.Header().Set("Upload-Offset", strconv.FormatInt(newOffset, 10))
+	if err != nil {
+		storageError(w, err, "조각 저장")
+		return
+	}
+	w.Header().Set("Upload-Expires", time.Now().Add(sessions.ttl).UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// finishSession은 Upload-Checksum을 확인하고 파일을 저장소에 등록합니다.
+func finishSession(w http.ResponseWriter, r *http.Request, sess *uploadSession, user *User) {
+	checksum, err := parseUploadChecksum(r.Header.Get("Upload-Checksum"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	meta, err := sessions.Finish(sess, storage, checksum, user.Quota)
+	if err != nil {
+		storageError(w, err, "업로드 완료")
+		return
+	}
+
+	fmt.Printf("이어받기 업로드 성공: %s (%s)\n", meta.Name, meta.ID)
+	w.Header().Set("Location", "/download/"+meta.ID)
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, "파일 업로드 성공: %s\nID: %s\n", meta.Name, meta.ID)
+}
+
+// parseUploadMetadata는 "키 base64값,키 base64값" 형식의 Upload-Metadata 헤더를 풉니다.
+// 잘못된 항목은 무시합니다.
+func parseUploadMetadata(header string) map[string]string {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			continue
+		}
+		metadata[key] = string(decoded)
+	}
+	return metadata
+}
+
+// parseUploadChecksum은 "sha256 <값>" 형식의 Upload-Checksum 헤더에서
+// SHA-256 값을 16진수로 꺼냅니다. 값은 tus처럼 base64로, 또는 16진수로 줄 수 있습니다.
+func parseUploadChecksum(header string) (string, error) {
+	algorithm, value, _ := strings.Cut(strings.TrimSpace(header), " ")
+	if algorithm != "sha256" {
+		return "", errors.New("Upload-Checksum 헤더에 sha256 체크섬이 필요합니다.")
+	}
+	value = strings.TrimSpace(value)
+	if sum, err := base64.StdEncoding.DecodeString(value); err == nil && len(sum) == 32 {
+		return hex.EncodeToString(sum), nil
+	}
+	if sum, err := hex.DecodeString(value); err == nil && len(sum) == 32 {
+		return strings.ToLower(value), nil
+	}
+	return "", errors.New("Upload-Checksum 값이 올바르지 않습니다.")
+}
+
+// maxSessionLength는 세션 하나로 받을 수 있는 최대 크기입니다. 파일 하나의 최대 크기를 따릅니다.
+func maxSessionLength() int64 {
+	if maxUploadSize > 0 && maxUploadSize < maxUploadLength {
+		return maxUploadSize
+	}
+	return maxUploadLength
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSessionCreateLimits(t *testing.T) {
+	st := openTestStorage(t)
+	if _, err := st.Save("alice", "a.txt", strings.NewReader(strings.Repeat("a", 40)), 0); err != nil {
+		t.Fatal(err)
+	}
+	m, err := OpenSessionStore(filepath.Join(t.TempDir(), sessionDirName), defaultSessionTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 저장된 40바이트와 열어 둔 세션의 크기를 합쳐 한도 100바이트와 비교함
+	if _, err := m.Create("alice", "b.bin", 50, st, 100); err != nil {
+		t.Fatalf("first session: %v", err)
+	}
+	if _, err := m.Create("alice", "c.bin", 11, st, 100); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("session over quota: %v, want %v", err, ErrQuotaExceeded)
+	}
+	sess, err := m.Create("alice", "c.bin", 10, st, 100)
+	if err != nil {
+		t.Fatalf("session filling quota: %v", err)
+	}
+	// 취소한 세션의 크기는 다시 쓸 수 있음
+	if err := m.Cancel(sess); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Create("alice", "c.bin", 10, st, 100); err != nil {
+		t.Errorf("session after cancel: %v", err)
+	}
+
+	// 한도가 없어도 열어 둘 수 있는 세션 수는 정해져 있고, 다른 사용자와는 따로 셈
+	for i := 0; i < maxUserSessions; i++ {
+		if _, err := m.Create("bob", "d.bin", 1, st, 0); err != nil {
+			t.Fatalf("session %d: %v", i, err)
+		}
+	}
+	if _, err := m.Create("bob", "d.bin", 1, st, 0); !errors.Is(err, ErrTooManyUploads) {
+		t.Errorf("session over limit: %v, want %v", err, ErrTooManyUploads)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3 서버를 기다리는 시간. 큰 파일을 주고받는 데 걸리는 시간은 정할 수 없으므로 요청 전체가
+// 아니라 단계마다 제한해, 응답하지 않는 서버 때문에 핸들러와 종료 처리가 멈추지 않게 합니다.
+const (
+	s3DialTimeout           = 10 * time.Second // 연결을 맺는 시간
+	s3TLSHandshakeTimeout   = 10 * time.Second
+	s3ResponseHeaderTimeout = 30 * time.Second // 요청을 다 보낸 뒤 응답 헤더가 올 때까지
+	s3ReadTimeout           = 30 * time.Second // 내려받는 본문에서 한 번 읽을 때까지
+	s3IdleConnTimeout       = 90 * time.Second
+)
+
+// S3Backend는 S3 호환 서버(AWS S3, MinIO 등)의 버킷 하나에 저장합니다.
+// 외부 SDK 없이 필요한 요청(PUT, GET, HEAD, DELETE)만 AWS 서명 버전 4로 직접 보냅니다.
+// 주소는 항상 경로 형식(<엔드포인트>/<버킷>/<키>)을 씁니다.
+type S3Backend struct {
+	endpoint  *url.URL
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+// NewS3Backend는 endpoint(예: http://localhost:9000)의 bucket을 쓰는 백엔드를 만듭니다.
+func NewS3Backend(endpoint, bucket, region, accessKey, secretKey string) (*S3Backend, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("S3 엔드포인트가 올바르지 않습니다: %q", endpoint)
+	}
+	if bucket == "" {
+		return nil, errors.New("S3 버킷 이름이 필요합니다")
+	}
+	if accessKey == "" || secretKey == "" {
+		return nil, errors.New("S3 접근 키가 필요합니다 (AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY)")
+	}
+	return &S3Backend{
+		endpoint:  u,
+		bucket:    bucket,
+		region:    region,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				DialContext:           (&net.Dialer{Timeout: s3DialTimeout, KeepAlive: 30 * time.Second}).DialContext,
+				TLSHandshakeTimeout:   s3TLSHandshakeTimeout,
+				ResponseHeaderTimeout: s3ResponseHeaderTimeout,
+				IdleConnTimeout:       s3IdleConnTimeout,
+				MaxIdleConnsPerHost:   16,
+			},
+		},
+	}, nil
+}
+
+// PutFile은 파일을 올린 뒤 로컬 파일을 지웁니다.
+func (b *S3Backend) PutFile(key, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// 큰 파일을 두 번 읽지 않도록 본문 해시는 서명하지 않음
+	req, err := b.newRequest(http.MethodPut, key, file, info.Size(), "UNSIGNED-PAYLOAD")
+	if err != nil {
+		return err
+	}
+	if _, err := b.do(req, http.StatusOK); err != nil {
+		return err
+	}
+	file.Close()
+	return os.Remove(path)
+}
+
+func (b *S3Backend) Put(key string, data []byte) error {
+	sum := sha256.Sum256(data)
+	req, err := b.newRequest(http.MethodPut, key, bytes.NewReader(data), int64(len(data)), hex.EncodeToString(sum[:]))
+	if err != nil {
+		return err
+	}
+	_, err = b.do(req, http.StatusOK)
+	return err
+}
+
+// Open은 HEAD로 크기만 확인하고, 실제 내용은 읽을 때 필요한 범위만 받아 옵니다.
+func (b *S3Backend) Open(key string) (io.ReadSeekCloser, error) {
+	req, err := b.newRequest(http.MethodHead, key, nil, 0, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.do(req, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Object{backend: b, key: key, size: resp.ContentLength}, nil
+}
+
+func (b *S3Backend) Delete(key string) error {
+	req, err := b.newRequest(http.MethodDelete, key, nil, 0, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	// 없는 키를 지워도 S3는 204를 돌려줌
+	_, err = b.do(req, http.StatusNoContent, http.StatusOK, http.StatusNotFound)
+	return err
+}
+
+// 빈 본문의 SHA-256
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// newRequest는 서명된 요청을 만듭니다.
+func (b *S3Backend) newRequest(method, key string, body io.Reader, size int64, payloadHash string) (*http.Request, error) {
+	u := *b.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + b.bucket + "/" + key
+	// 본문이 있는데 길이가 0이면 net/http는 길이를 모르는 것으로 보고 chunked로 보내는데,
+	// S3는 Content-Length가 없는 PUT을 받지 않으므로 빈 파일은 본문 없이 보냄
+	if size == 0 {
+		body = http.NoBody
+	}
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	b.sign(req, payloadHash, time.Now().UTC())
+	return req, nil
+}
+
+// do는 요청을 보내고 상태 코드가 ok 중 하나가 아니면 오류를 반환합니다.
+// GET이 아닌 요청의 본문은 읽어서 닫습니다.
+func (b *S3Backend) do(req *http.Request, ok ...int) (*http.Response, error) {
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range ok {
+		if resp.StatusCode == status {
+			if req.Method != http.MethodGet {
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+			return resp, nil
+		}
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	return nil, fmt.Errorf("S3 %s %s 실패: %s %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// sign은 요청에 AWS 서명 버전 4의 Authorization 헤더를 붙입니다.
+// 서명하는 헤더는 host, x-amz-content-sha256, x-amz-date 세 가지입니다.
+func (b *S3Backend) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + b.region + "/s3/aws4_request"
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := hmacSHA256([]byte("AWS4"+b.secretKey), date)
+	key = hmacSHA256(key, b.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		b.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Object는 S3 객체를 io.ReadSeekCloser로 읽습니다. 위치를 옮기면 다음 Read에서
+// 그 위치부터 Range 요청을 새로 보내므로, 동영상 탐색이나 범위 요청에도 필요한 만큼만 받습니다.
+type s3Object struct {
+	backend *S3Backend
+	key     string
+	size    int64
+	pos     int64
+	body    io.ReadCloser // pos부터 읽는 중인 응답 본문
+}
+
+func (o *s3Object) Read(p []byte) (int, error) {
+	if o.pos >= o.size {
+		return 0, io.EOF
+	}
+	if o.body == nil {
+		req, err := o.backend.newRequest(http.MethodGet, o.key, nil, 0, emptyPayloadHash)
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(o.pos, 10)+"-")
+		resp, err := o.backend.do(req, http.StatusPartialContent, http.StatusOK)
+		if err != nil {
+			return 0, err
+		}
+		// Range를 무시하고 처음부터 보낸 경우 앞부분을 버림
+		if resp.StatusCode == http.StatusOK && o.pos > 0 {
+			if _, err := io.CopyN(io.Discard, resp.Body, o.pos); err != nil {
+				resp.Body.Close()
+				return 0, err
+			}
+		}
+		o.body = resp.Body
+	}
+	// 내용을 보내다 멈춘 서버를 끝없이 기다리지 않도록 읽을 때마다 시간을 제한
+	body := o.body
+	timer := time.AfterFunc(s3ReadTimeout, func() { body.Close() })
+	n, err := body.Read(p)
+	timer.Stop()
+	o.pos += int64(n)
+	return n, err
+}
+
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += o.pos
+	case io.SeekEnd:
+		offset += o.size
+	default:
+		return 0, errors.New("잘못된 whence: " + strconv.Itoa(whence))
+	}
+	if offset < 0 {
+		return 0, errors.New("음수 위치로 이동할 수 없습니다")
+	}
+	if offset != o.pos && o.body != nil {
+		o.body.Close()
+		o.body = nil
+	}
+	o.pos = offset
+	return offset, nil
+}
+
+func (o *s3Object) Close() error {
+	if o.body == nil {
+		return nil
+	}
+	return o.body.Close()
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// s3Stub은 버킷 하나를 메모리에 두는 S3 흉내입니다. 실제 S3처럼 길이를 모르는 PUT은
+// 411로 거절하고, GET의 Range는 ServeContent로 처리합니다.
+type s3Stub struct {
+	t       *testing.T
+	mu      sync.Mutex
+	objects map[string][]byte
+	ranges  []string // 받은 GET 요청의 Range 헤더
+}
+
+func newS3Stub(t *testing.T) (*s3Stub, *S3Backend) {
+	t.Helper()
+	stub := &s3Stub{t: t, objects: make(map[string][]byte)}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	backend, err := NewS3Backend(server.URL, "bucket", "us-east-1", "access", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stub, backend
+}
+
+func (s *s3Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=access/") || r.Header.Get("X-Amz-Date") == "" {
+		s.t.Errorf("%s %s: unsigned request: %q", r.Method, r.URL.Path, auth)
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/bucket/")
+	if !ok {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		if r.ContentLength < 0 {
+			http.Error(w, "MissingContentLength", http.StatusLengthRequired)
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if hash := r.Header.Get("X-Amz-Content-Sha256"); hash != "UNSIGNED-PAYLOAD" {
+			sum := sha256.Sum256(data)
+			if hash != hex.EncodeToString(sum[:]) {
+				http.Error(w, "XAmzContentSHA256Mismatch", http.StatusBadRequest)
+				return
+			}
+		}
+		s.objects[key] = data
+	case http.MethodGet, http.MethodHead:
+		data, ok := s.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodGet {
+			s.ranges = append(s.ranges, r.Header.Get("Range"))
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func TestS3Backend(t *testing.T) {
+	stub, backend := newS3Stub(t)
+	dir := t.TempDir()
+
+	t.Run("put and get", func(t *testing.T) {
+		if err := backend.Put("index.json", []byte(`{"a":1}`)); err != nil {
+			t.Fatal(err)
+		}
+		file, err := backend.Open("index.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		data, err := io.ReadAll(file)
+		if err != nil || string(data) != `{"a":1}` {
+			t.Errorf("read %q, %v", data, err)
+		}
+	})
+
+	for _, content := range []string{"file content", ""} {
+		t.Run("put file of "+strconv.Itoa(len(content))+" bytes", func(t *testing.T) {
+			path := filepath.Join(dir, "upload")
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := backend.PutFile("objects/file", path); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("local file left after PutFile: %v", err)
+			}
+			stub.mu.Lock()
+			stored, ok := stub.objects["objects/file"]
+			stub.mu.Unlock()
+			if !ok || string(stored) != content {
+				t.Errorf("stored %q, %v", stored, ok)
+			}
+		})
+	}
+
+	t.Run("range", func(t *testing.T) {
+		if err := backend.Put("objects/range", []byte("0123456789")); err != nil {
+			t.Fatal(err)
+		}
+		file, err := backend.Open("objects/range")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		stub.ranges = nil
+
+		tests := []struct {
+			offset int64
+			whence int
+			n      int
+			want   string
+		}{
+			{5, io.SeekStart, 3, "567"},
+			{0, io.SeekCurrent, 2, "89"}, // 이어 읽으면 요청을 새로 보내지 않음
+			{-4, io.SeekEnd, 4, "6789"},
+			{1, io.SeekStart, 2, "12"},
+		}
+		for _, tt := range tests {
+			if _, err := file.Seek(tt.offset, tt.whence); err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, tt.n)
+			if _, err := io.ReadFull(file, buf); err != nil || string(buf) != tt.want {
+				t.Errorf("Seek(%d, %d): read %q, %v; want %q", tt.offset, tt.whence, buf, err, tt.want)
+			}
+		}
+		want := []string{"bytes=5-", "bytes=6-", "bytes=1-"}
+		if strings.Join(stub.ranges, ",") != strings.Join(want, ",") {
+			t.Errorf("ranges requested: %q, want %q", stub.ranges, want)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if err := backend.Put("objects/gone", []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+		if err := backend.Delete("objects/gone"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := backend.Open("objects/gone"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("open after delete: %v", err)
+		}
+		if err := backend.Delete("objects/gone"); err != nil {
+			t.Errorf("delete missing key: %v", err)
+		}
+	})
+}
+
+func TestStorageOnS3(t *testing.T) {
+	_, backend := newS3Stub(t)
+	s, err := OpenStorage(t.TempDir(), backend, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := s.Save("alice", "empty.txt", strings.NewReader(""), 0)
+	if err != nil {
+		t.Fatalf("save empty file: %v", err)
+	}
+	file, _, err := s.Open("alice", meta.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil || len(data) != 0 {
+		t.Errorf("read %q, %v", data, err)
+	}
+
+	// 색인도 버킷에 있으므로 다시 열면 같은 파일이 보임
+	reopened, err := OpenStorage(t.TempDir(), backend, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Stat("alice", meta.ID); err != nil {
+		t.Errorf("stat after reopen: %v", err)
+	}
+	if _, err := reopened.Delete("alice", meta.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.Open(blobKey(meta.ID)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("blob left after delete: %v", err)
+	}
+}
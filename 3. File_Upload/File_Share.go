@@ -0,0 +1,493 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	shareKeyFile    = "share.key"   // 링크 서명에 쓰는 비밀 키
+	shareFile       = "shares.json" // 횟수 제한이나 비밀번호가 있는 링크 목록
+	defaultShareTTL = 24 * time.Hour
+	maxShareTTL     = 30 * 24 * time.Hour
+	shareRealm      = `Basic realm="shared file", charset="UTF-8"`
+	shareGrantTTL   = time.Hour // 횟수를 센 뒤 같은 링크의 이어받기·범위 요청을 더 세지 않는 시간
+	maxShareUnlocks = 1024      // 기억해 두는 맞은 비밀번호 수
+)
+
+// 공유 링크 오류
+var (
+	ErrInvalidShare   = errors.New("올바르지 않은 공유 링크입니다")
+	ErrShareExpired   = errors.New("만료된 공유 링크입니다")
+	ErrShareExhausted = errors.New("공유 링크의 다운로드 횟수를 모두 사용했습니다")
+	ErrSharePassword  = errors.New("공유 링크의 비밀번호가 필요합니다")
+)
+
+// shareLink는 다운로드 횟수 제한이나 비밀번호가 걸린 공유 링크의 상태입니다.
+// 둘 다 없는 링크는 서명만으로 확인하므로 서버에 저장하지 않습니다.
+type shareLink struct {
+	ID           string    `json:"id"`
+	Owner        string    `json:"owner"`
+	FileID       string    `json:"file_id"`
+	Expires      time.Time `json:"expires"`
+	MaxDownloads int       `json:"max_downloads"` // 0이면 제한 없음
+	Downloads    int       `json:"downloads"`
+	PasswordHash string    `json:"password_hash,omitempty"`
+}
+
+// ShareStore는 만료 시각이 있는 공유 링크를 만들고 확인합니다.
+//
+// 링크는 /download/<파일 ID>?owner=..&expires=..&share=..&sig=.. 형식이며,
+// sig는 소유자, 파일 ID, 만료 시각, 링크 ID에 대한 HMAC-SHA256입니다.
+// 같은 쿼리를 /stream/<파일 ID>에 붙이면 미디어로 재생할 수 있습니다.
+//
+// 횟수 제한이나 비밀번호가 있는 링크로 내용을 받기 시작하면 다운로드 하나를 세고, 서명한
+// 쿠키(grant)를 shareGrantTTL 동안 줍니다. 쿠키가 있는 요청은 비밀번호와 횟수를 다시
+// 확인하지 않으므로, 동영상 탐색이나 이어받기처럼 범위 요청이 이어져도 한 번만 셉니다.
+type ShareStore struct {
+	mu       sync.Mutex
+	path     string
+	key      []byte
+	links    map[string]*shareLink
+	unlocked map[string]time.Time // 링크 ID와 비밀번호의 HMAC -> 확인한 결과를 믿는 시각
+	failures *failureLimiter      // "share-ip:주소"와 "share:링크 ID"마다 틀린 비밀번호 수
+}
+
+// OpenShareStore는 dir의 서명 키와 링크 목록을 읽습니다. 키가 없으면 새로 만듭니다.
+func OpenShareStore(dir string) (*ShareStore, error) {
+	keyPath := filepath.Join(dir, shareKeyFile)
+	key, err := os.ReadFile(keyPath)
+	if os.IsNotExist(err) {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(keyPath, key, 0600); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	s := &ShareStore{
+		path:     filepath.Join(dir, shareFile),
+		key:      key,
+		links:    make(map[string]*shareLink),
+		unlocked: make(map[string]time.Time),
+		failures: newFailureLimiter(),
+	}
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.links); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Create는 owner의 파일 fileID를 ttl 동안 내려받을 수 있는 링크의 쿼리를 만듭니다.
+func (s *ShareStore) Create(owner, fileID string, ttl time.Duration, maxDownloads int, password string) (url.Values, time.Time, error) {
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	query := url.Values{}
+	query.Set("owner", owner)
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+
+	if maxDownloads > 0 || password != "" {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, time.Time{}, err
+		}
+		link := &shareLink{
+			ID:           hex.EncodeToString(buf),
+			Owner:        owner,
+			FileID:       fileID,
+			Expires:      expires,
+			MaxDownloads: maxDownloads,
+		}
+		if password != "" {
+			hash, err := hashPassword(password)
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+			link.PasswordHash = hash
+		}
+
+		s.mu.Lock()
+		s.links[link.ID] = link
+		err := s.save()
+		s.mu.Unlock()
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		query.Set("share", link.ID)
+	}
+
+	query.Set("sig", s.sign(owner, fileID, query.Get("expires"), query.Get("share")))
+	return query, expires, nil
+}
+
+// Check는 fileID에 대한 링크의 서명, 만료 시각, 비밀번호를 확인하고
+// 파일 소유자를 반환합니다. 다운로드 횟수는 Consume에서 셉니다.
+// granted가 참이면(Granted 참고) 이미 센 다운로드의 이어지는 요청이므로
+// 비밀번호와 남은 횟수는 확인하지 않습니다. host는 요청을 보낸 주소로, 틀린 비밀번호를
+// 세는 데 씁니다.
+func (s *ShareStore) Check(fileID string, query url.Values, password, host string, granted bool) (string, error) {
+	owner, expires, shareID := query.Get("owner"), query.Get("expires"), query.Get("share")
+	want := s.sign(owner, fileID, expires, shareID)
+	if !hmac.Equal([]byte(want), []byte(query.Get("sig"))) {
+		return "", ErrInvalidShare
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return "", ErrInvalidShare
+	}
+	if time.Now().After(time.Unix(unix, 0)) {
+		return "", ErrShareExpired
+	}
+	if shareID == "" {
+		return owner, nil
+	}
+
+	s.mu.Lock()
+	link, ok := s.links[shareID]
+	var linkCopy shareLink
+	if ok {
+		linkCopy = *link
+	}
+	s.mu.Unlock()
+	if !ok {
+		return "", ErrShareExpired
+	}
+	if granted {
+		return owner, nil
+	}
+	if linkCopy.PasswordHash != "" {
+		if err := s.checkPassword(&linkCopy, password, host); err != nil {
+			return "", err
+		}
+	}
+	if linkCopy.MaxDownloads > 0 && linkCopy.Downloads >= linkCopy.MaxDownloads {
+		return "", ErrShareExhausted
+	}
+	return owner, nil
+}
+
+// checkPassword는 link의 비밀번호를 확인합니다. 맞은 비밀번호는 shareGrantTTL 동안
+// 기억해, 쿠키를 쓰지 않는 도구가 범위 요청마다 PBKDF2를 다시 계산하지 않게 합니다.
+// 로그인 없이 누구나 시도할 수 있으므로 틀린 비밀번호는 주소와 링크마다 세어, 너무 잦으면
+// 계산하지 않고 ErrTooManyLogins를 반환합니다.
+func (s *ShareStore) checkPassword(link *shareLink, password, host string) error {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte("password\n" + link.ID + "\n" + password))
+	key := string(mac.Sum(nil))
+	now := time.Now()
+
+	s.mu.Lock()
+	until, ok := s.unlocked[key]
+	s.mu.Unlock()
+	if ok && now.Before(until) {
+		return nil
+	}
+	keys := []string{"share-ip:" + host, "share:" + link.ID}
+	if !s.failures.begin(keys, now) {
+		return ErrTooManyLogins
+	}
+	if !checkPassword(link.PasswordHash, password) {
+		return ErrSharePassword
+	}
+	s.failures.succeed(keys)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.unlocked) >= maxShareUnlocks {
+		for k, until := range s.unlocked {
+			if !now.Before(until) {
+				delete(s.unlocked, k)
+			}
+		}
+		if len(s.unlocked) >= maxShareUnlocks {
+			clear(s.unlocked)
+		}
+	}
+	s.unlocked[key] = now.Add(shareGrantTTL)
+	return nil
+}
+
+// Granted는 r에 shareID 링크로 이미 다운로드를 센 뒤 받은 쿠키가 있는지 확인합니다.
+func (s *ShareStore) Granted(r *http.Request, shareID string) bool {
+	if shareID == "" {
+		return false
+	}
+	cookie, err := r.Cookie(grantCookieName(shareID))
+	if err != nil {
+		return false
+	}
+	expires, sig, ok := strings.Cut(cookie.Value, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.grantSig(shareID, expires))) {
+		return false
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	return err == nil && time.Now().Before(time.Unix(unix, 0))
+}
+
+// setGrant는 shareID 링크의 다운로드를 센 응답에 쿠키를 붙입니다.
+// 쿠키는 링크보다 오래 유효하지 않습니다.
+func (s *ShareStore) setGrant(w http.ResponseWriter, r *http.Request, shareID string) {
+	expires := time.Now().Add(shareGrantTTL).Truncate(time.Second)
+	s.mu.Lock()
+	if link, ok := s.links[shareID]; ok && link.Expires.Before(expires) {
+		expires = link.Expires
+	}
+	s.mu.Unlock()
+
+	value := strconv.FormatInt(expires.Unix(), 10)
+	http.SetCookie(w, &http.Cookie{
+		Name:     grantCookieName(shareID),
+		Value:    value + "." + s.grantSig(shareID, value),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// grantSig는 쿠키의 서명을 계산합니다. 링크 서명과 섞이지 않도록 앞에 "grant"를 붙입니다.
+func (s *ShareStore) grantSig(shareID, expires string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte("grant\n" + shareID + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// grantCookieName은 링크마다 다른 쿠키 이름입니다.
+func grantCookieName(shareID string) string {
+	return "share_" + shareID
+}
+
+// Consume은 링크의 다운로드 횟수를 하나 늘립니다. 이미 다 쓴 링크면 ErrShareExhausted를 반환합니다.
+func (s *ShareStore) Consume(shareID string) error {
+	if shareID == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, ok := s.links[shareID]
+	if !ok {
+		return ErrShareExpired
+	}
+	if link.MaxDownloads > 0 && link.Downloads >= link.MaxDownloads {
+		return ErrShareExhausted
+	}
+	link.Downloads++
+	return s.save()
+}
+
+// Allow는 서명이 붙은 /download/, /stream/ 요청은 공유 링크로 처리하고, 나머지는 next로 넘깁니다.
+func (s *ShareStore) Allow(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("sig") {
+			handleSharedDownload(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// sign은 링크의 서명을 계산합니다.
+func (s *ShareStore) sign(owner, fileID, expires, shareID string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(owner + "\n" + fileID + "\n" + expires + "\n" + shareID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// save는 만료된 링크를 정리한 뒤 목록을 저장합니다. s.mu를 잡은 상태에서 호출합니다.
+func (s *ShareStore) save() error {
+	now := time.Now()
+	for id, link := range s.links {
+		if now.After(link.Expires) {
+			delete(s.links, id)
+		}
+	}
+
+	data, err := json.MarshalIndent(s.links, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(s.path+".tmp", s.path)
+}
+
+// 공유 링크 생성 핸들러: POST /share/<파일 ID>
+// 폼 값 ttl(예: 24h), max_downloads, password는 모두 생략할 수 있습니다.
+func handleShare(w http.ResponseWriter, r *http.Request, user *User) {
+	id := strings.TrimPrefix(r.URL.Path, "/share/")
+
+	fmt.Printf("공유 링크 생성 요청: %s (%s)\n", id, user.Name)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST 요청만 가능합니다.", http.StatusMethodNotAllowed)
+		return
+	}
+	meta, err := storage.Stat(user.Name, id)
+	if err != nil {
+		storageError(w, err, "공유 링크 생성")
+		return
+	}
+
+	ttl := defaultShareTTL
+	if s := r.FormValue("ttl"); s != "" {
+		ttl, err = time.ParseDuration(s)
+		if err != nil || ttl <= 0 || ttl > maxShareTTL {
+			http.Error(w, "ttl은 0보다 크고 720h 이하인 시간이어야 합니다.", http.StatusBadRequest)
+			return
+		}
+	}
+	var maxDownloads int
+	if s := r.FormValue("max_downloads"); s != "" {
+		maxDownloads, err = strconv.Atoi(s)
+		if err != nil || maxDownloads < 0 {
+			http.Error(w, "max_downloads가 올바르지 않습니다.", http.StatusBadRequest)
+			return
+		}
+	}
+
+	query, expires, err := shares.Create(user.Name, meta.ID, ttl, maxDownloads, r.FormValue("password"))
+	if err != nil {
+		storageError(w, err, "공유 링크 생성")
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	link := fmt.Sprintf("%s://%s/download/%s?%s", scheme, r.Host, meta.ID, query.Encode())
+
+	fmt.Printf("공유 링크 생성: %s (%s, %s까지)\n", meta.Name, user.Name, expires.Format(time.RFC3339))
+	if wantsJSON(r.URL.Query(), r.Header.Get("Accept")) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"url":           link,
+			"expires":       expires.UTC(),
+			"max_downloads": maxDownloads,
+		})
+		return
+	}
+	fmt.Fprintf(w, "공유 링크: %s\n만료: %s\n", link, expires.Format(time.RFC3339))
+}
+
+// 공유 링크로 들어온 다운로드 핸들러
+// 비밀번호는 Basic 인증의 비밀번호(사용자 이름은 무시)나 X-Share-Password 헤더로 받습니다.
+func handleSharedDownload(w http.ResponseWriter, r *http.Request) {
+	id, stream := strings.CutPrefix(r.URL.Path, "/stream/")
+	if !stream {
+		id = strings.TrimPrefix(r.URL.Path, "/download/")
+	}
+
+	fmt.Printf("공유 링크 다운로드 요청: %s\n", id)
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "GET 또는 HEAD 요청만 가능합니다.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	password := r.Header.Get("X-Share-Password")
+	if _, p, ok := r.BasicAuth(); ok && password == "" {
+		password = p
+	}
+	query := r.URL.Query()
+	shareID := query.Get("share")
+	granted := shares.Granted(r, shareID)
+	owner, err := shares.Check(id, query, password, remoteHost(r), granted)
+	if err != nil {
+		storageError(w, err, "공유 링크 확인")
+		return
+	}
+	// 로그인한 사용자가 아니므로 접근 기록에는 링크를 만든 사용자를 구분해 남김
+	setLogUser(r, "share:"+owner)
+
+	file, meta, err := storage.Open(owner, id)
+	if err != nil {
+		storageError(w, err, "파일 다운로드")
+		return
+	}
+	defer file.Close()
+
+	// HEAD 요청과 쿠키를 받은 뒤의 요청은 횟수에 넣지 않음
+	if r.Method == http.MethodGet && shareID != "" && !granted {
+		w = &shareCounter{ResponseWriter: w, r: r, shareID: shareID}
+	}
+	if stream {
+		serveStream(w, r, file, meta)
+		return
+	}
+	serveFile(w, r, file, meta)
+}
+
+// shareCounter는 공유 링크로 내용을 보내기 시작할 때(200, 206) 다운로드를 하나 세고
+// 쿠키를 붙입니다. 304나 412처럼 내용을 보내지 않는 응답은 세지 않습니다.
+// 그 사이에 횟수를 다 썼다면 내용 대신 오류를 보냅니다.
+type shareCounter struct {
+	http.ResponseWriter
+	r       *http.Request
+	shareID string
+	counted bool  // 응답 상태를 정했음
+	err     error // 횟수를 세지 못해 내용을 보내지 않음
+}
+
+func (c *shareCounter) WriteHeader(status int) {
+	if !c.counted {
+		c.counted = true
+		if status == http.StatusOK || status == http.StatusPartialContent {
+			if err := shares.Consume(c.shareID); err != nil {
+				c.err = err
+				header := c.Header()
+				for _, key := range []string{"Content-Encoding", "Content-Range", "Content-Disposition", "ETag"} {
+					header.Del(key)
+				}
+				storageError(c.ResponseWriter, err, "공유 링크 확인")
+				return
+			}
+			shares.setGrant(c.ResponseWriter, c.r, c.shareID)
+		}
+	}
+	if c.err == nil {
+		c.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (c *shareCounter) Write(p []byte) (int, error) {
+	if !c.counted {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.ResponseWriter.Write(p)
+}
+
+// Unwrap은 http.ResponseController가 원래 ResponseWriter의 기능을 쓸 수 있게 합니다.
+func (c *shareCounter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestShares(t *testing.T) *ShareStore {
+	t.Helper()
+	s, err := OpenShareStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestShareCheck(t *testing.T) {
+	s := openTestShares(t)
+	fileID := strings.Repeat("ab", 32)
+	plain, _, err := s.Create("alice", fileID, time.Hour, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limited, _, err := s.Create("alice", fileID, time.Hour, 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, _, err := s.Create("alice", fileID, -time.Minute, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain.Has("share") || !limited.Has("share") {
+		t.Fatalf("share IDs: plain %q, limited %q", plain.Get("share"), limited.Get("share"))
+	}
+
+	with := func(query url.Values, key, value string) url.Values {
+		copied := url.Values{}
+		for k, v := range query {
+			copied[k] = append([]string{}, v...)
+		}
+		copied.Set(key, value)
+		return copied
+	}
+	later := strconv.FormatInt(time.Now().Add(48*time.Hour).Unix(), 10)
+
+	tests := []struct {
+		name   string
+		fileID string
+		query  url.Values
+		want   error
+	}{
+		{"plain", fileID, plain, nil},
+		{"limited", fileID, limited, nil},
+		{"other file", strings.Repeat("cd", 32), plain, ErrInvalidShare},
+		{"other owner", fileID, with(plain, "owner", "bob"), ErrInvalidShare},
+		{"extended expiry", fileID, with(plain, "expires", later), ErrInvalidShare},
+		{"limit removed", fileID, with(limited, "share", ""), ErrInvalidShare},
+		{"signature changed", fileID, with(plain, "sig", strings.Repeat("0", 64)), ErrInvalidShare},
+		{"no signature", fileID, with(plain, "sig", ""), ErrInvalidShare},
+		{"expired", fileID, expired, ErrShareExpired},
+	}
+	for _, tt := range tests {
+		owner, err := s.Check(tt.fileID, tt.query, "", "10.0.0.1", false)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: Check = %v, want %v", tt.name, err, tt.want)
+		} else if err == nil && owner != "alice" {
+			t.Errorf("%s: owner = %q", tt.name, owner)
+		}
+	}
+
+	// 횟수를 다 쓰면 쿠키를 받은 요청만 통과
+	if err := s.Consume(limited.Get("share")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Check(fileID, limited, "", "10.0.0.1", false); !errors.Is(err, ErrShareExhausted) {
+		t.Errorf("exhausted: Check = %v", err)
+	}
+	if _, err := s.Check(fileID, limited, "", "10.0.0.1", true); err != nil {
+		t.Errorf("exhausted with grant: Check = %v", err)
+	}
+	if err := s.Consume(limited.Get("share")); !errors.Is(err, ErrShareExhausted) {
+		t.Errorf("exhausted: Consume = %v", err)
+	}
+}
+
+func TestShareCheckPassword(t *testing.T) {
+	s := openTestShares(t)
+	fileID := strings.Repeat("ab", 32)
+	query, _, err := s.Create("alice", fileID, time.Hour, 0, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		password string
+		want     error
+	}{
+		{"", ErrSharePassword},
+		{"wrong", ErrSharePassword},
+		{"secret", nil},
+		{"secret", nil}, // 기억해 둔 결과로 확인
+		{"Secret", ErrSharePassword},
+	} {
+		if _, err := s.Check(fileID, query, tt.password, "10.0.0.1", false); !errors.Is(err, tt.want) {
+			t.Errorf("Check(%q) = %v, want %v", tt.password, err, tt.want)
+		}
+	}
+	if _, err := s.Check(fileID, query, "", "10.0.0.1", true); err != nil {
+		t.Errorf("Check with grant = %v", err)
+	}
+}
+
+func TestSharePasswordLimit(t *testing.T) {
+	s := openTestShares(t)
+	fileID := strings.Repeat("ab", 32)
+	create := func() url.Values {
+		query, _, err := s.Create("alice", fileID, time.Hour, 0, "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 테스트가 느려지지 않도록 반복 횟수를 줄인 해시로 바꿈
+		s.links[query.Get("share")].PasswordHash = quickHash(t, "secret")
+		return query
+	}
+	target, other := create(), create()
+
+	for i := 0; i < maxAuthFailures; i++ {
+		if _, err := s.Check(fileID, target, "guess", "10.0.0.1", false); !errors.Is(err, ErrSharePassword) {
+			t.Fatalf("guess %d: %v", i, err)
+		}
+	}
+	// 한도에 이른 뒤에는 해시를 확인하지 않으므로, 해시가 맞는 비밀번호로 바뀌어도 거절됨
+	s.links[target.Get("share")].PasswordHash = quickHash(t, "guess")
+
+	tests := []struct {
+		name     string
+		query    url.Values
+		password string
+		host     string
+		want     error
+	}{
+		{"next guess", target, "guess", "10.0.0.1", ErrTooManyLogins},
+		{"same link from another address", target, "guess", "10.0.0.2", ErrTooManyLogins},
+		{"another link from same address", other, "secret", "10.0.0.1", ErrTooManyLogins},
+		{"another link from another address", other, "secret", "10.0.0.2", nil},
+	}
+	for _, tt := range tests {
+		if _, err := s.Check(fileID, tt.query, tt.password, tt.host, false); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Check = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	storageError(rec, ErrTooManyLogins, "공유 링크 확인")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("storageError: status %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
+
+func TestShareGrant(t *testing.T) {
+	s := openTestShares(t)
+	query, _, err := s.Create("alice", strings.Repeat("ab", 32), time.Hour, 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shareID := query.Get("share")
+
+	rec := httptest.NewRecorder()
+	s.setGrant(rec, httptest.NewRequest("GET", "/", nil), shareID)
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("cookies: %v", cookies)
+	}
+	request := func(c *http.Cookie) *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(c)
+		return r
+	}
+
+	valid := cookies[0]
+	forged := *valid
+	forged.Value = strconv.FormatInt(time.Now().Add(24*time.Hour).Unix(), 10) + valid.Value[strings.Index(valid.Value, "."):]
+	renamed := *valid
+	renamed.Name = grantCookieName(strings.Repeat("0", 32))
+	tests := []struct {
+		name    string
+		r       *http.Request
+		shareID string
+		want    bool
+	}{
+		{"valid", request(valid), shareID, true},
+		{"other link", request(&renamed), strings.Repeat("0", 32), false},
+		{"expiry changed", request(&forged), shareID, false},
+		{"no cookie", httptest.NewRequest("GET", "/", nil), shareID, false},
+		{"link without ID", request(valid), "", false},
+	}
+	for _, tt := range tests {
+		if got := s.Granted(tt.r, tt.shareID); got != tt.want {
+			t.Errorf("%s: Granted = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSharedDownloadCounting(t *testing.T) {
+	storage = openTestStorage(t)
+	shares = openTestShares(t)
+	meta, err := storage.Save("alice", "a.txt", strings.NewReader("hello, shared world"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, _, err := shares.Create("alice", meta.ID, time.Hour, 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shareID := query.Get("share")
+	target := "/download/" + meta.ID + "?" + query.Encode()
+
+	get := func(header http.Header, cookies ...*http.Cookie) *http.Response {
+		r := httptest.NewRequest("GET", target, nil)
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		handleSharedDownload(rec, r)
+		return rec.Result()
+	}
+	downloads := func() int {
+		shares.mu.Lock()
+		defer shares.mu.Unlock()
+		return shares.links[shareID].Downloads
+	}
+
+	// 내용을 보내지 않는 조건부 요청은 세지 않음
+	resp := get(http.Header{"If-None-Match": {`"` + meta.SHA256 + `"`}})
+	if resp.StatusCode != http.StatusNotModified || downloads() != 0 {
+		t.Fatalf("conditional: status %d, downloads %d", resp.StatusCode, downloads())
+	}
+
+	resp = get(http.Header{"Range": {"bytes=0-4"}})
+	if resp.StatusCode != http.StatusPartialContent || downloads() != 1 {
+		t.Fatalf("first range: status %d, downloads %d", resp.StatusCode, downloads())
+	}
+	cookies := resp.Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("grant cookies: %v", cookies)
+	}
+
+	// 쿠키가 있으면 이어지는 요청은 세지 않음
+	for _, header := range []http.Header{{"Range": {"bytes=5-"}}, {}} {
+		resp = get(header, cookies[0])
+		if resp.StatusCode/100 != 2 || downloads() != 1 {
+			t.Errorf("granted %v: status %d, downloads %d", header, resp.StatusCode, downloads())
+		}
+	}
+
+	resp = get(nil)
+	if resp.StatusCode != http.StatusGone {
+		t.Errorf("without grant after limit: status %d", resp.StatusCode)
+	}
+}
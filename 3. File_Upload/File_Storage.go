@@ -0,0 +1,558 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	indexFileName = "index.json" // 메타데이터 색인 파일
+	maxNameLength = 255          // 파일 이름의 최대 길이 (바이트)
+)
+
+// 저장소 오류. 핸들러는 이 값으로 HTTP 상태 코드를 정합니다.
+var (
+	ErrInvalidName = errors.New("허용되지 않는 파일 이름입니다")
+	ErrInvalidID   = errors.New("올바르지 않은 파일 ID입니다")
+	ErrNotFound    = errors.New("파일이 존재하지 않습니다")
+	ErrChecksum    = errors.New("체크섬이 일치하지 않습니다")
+)
+
+// FileMeta는 저장된 파일 하나의 정보입니다.
+type FileMeta struct {
+	ID         string    `json:"id"`    // 저장 ID (내용의 SHA-256)
+	Owner      string    `json:"owner"` // 업로드한 사용자
+	Name       string    `json:"name"`  // 업로드할 때의 원래 파일 이름
+	Size       int64     `json:"size"`
+	MIMEType   string    `json:"mime_type"`
+	UploadedAt time.Time `json:"uploaded_at"`
+	SHA256     string    `json:"sha256"`
+	Encoding   string    `json:"encoding,omitempty"` // 디스크에 압축해 둔 방식 (gzip, zstd)
+}
+
+// Storage는 업로드된 파일을 내용의 해시로 저장하고 메타데이터 색인을 관리합니다.
+// 파일 내용은 백엔드의 objects/<해시 앞 2자리>/<해시> 키에 저장되므로, 사용자가 보낸
+// 이름이 경로에 쓰이는 일은 없습니다. 받는 중인 내용만 로컬 dir/tmp에 둡니다.
+//
+// 사용자마다 따로 색인되므로 다른 사용자의 파일은 보이지 않습니다. 같은 내용은
+// 누가 몇 번 올리든 내용 파일 하나만 두고 참조 수를 세며, 마지막 참조가 지워질 때
+// 내용 파일도 지웁니다.
+//
+// 백엔드에는 내용과 색인만 둡니다. 사용자 목록, 공유 링크, 이어받기 세션은 백엔드와
+// 상관없이 로컬 디렉토리에 저장됩니다(Config.Dir 참고).
+type Storage struct {
+	mu          sync.Mutex
+	dir         string                   // 임시 파일을 두는 로컬 디렉토리
+	backend     Backend                  // 파일 내용과 색인을 저장하는 곳
+	compression string                   // 압축할 수 있는 형식을 저장할 때 쓸 방식 ("", gzip, zstd)
+	index       map[string]FileMeta      // "소유자/파일 ID" -> 메타데이터
+	blobs       map[string]*blobInfo     // 파일 ID -> 내용 파일 정보
+	uploads     map[string]chan struct{} // 백엔드에 올리는 중인 파일 ID -> 끝나면 닫히는 채널
+	hooks       []UploadHook             // 등록하기 전에 업로드를 검사하는 순서
+}
+
+// blobInfo는 내용 파일 하나의 정보입니다. 색인에서 다시 계산할 수 있으므로 따로 저장하지 않습니다.
+type blobInfo struct {
+	refs     int    // 이 내용을 가리키는 색인 항목 수
+	encoding string // 압축 방식
+}
+
+// OpenStorage는 backend에 있는 저장소를 엽니다. 색인이 없으면 빈 저장소로 시작합니다.
+// dir는 임시 파일을 둘 로컬 디렉토리입니다.
+// compression이 비어 있지 않으면 새로 저장하는 텍스트 같은 파일을 그 방식으로 압축합니다.
+func OpenStorage(dir string, backend Backend, compression string) (*Storage, error) {
+	if !validEncoding(compression) {
+		return nil, fmt.Errorf("지원하지 않는 압축 방식: %q", compression)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "tmp"), 0755); err != nil {
+		return nil, err
+	}
+
+	s := &Storage{
+		dir:         dir,
+		backend:     backend,
+		compression: compression,
+		index:       make(map[string]FileMeta),
+		blobs:       make(map[string]*blobInfo),
+		uploads:     make(map[string]chan struct{}),
+	}
+	file, err := backend.Open(indexFileName)
+	if errors.Is(err, ErrNotFound) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		return nil, err
+	}
+	var saved map[string]FileMeta
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, err
+	}
+	// 소유자가 없던 예전 색인도 읽을 수 있도록 키를 다시 만듦
+	for _, meta := range saved {
+		s.index[indexKey(meta.Owner, meta.ID)] = meta
+		if s.blobs[meta.ID] == nil {
+			s.blobs[meta.ID] = &blobInfo{encoding: meta.Encoding}
+		}
+		s.blobs[meta.ID].refs++
+	}
+	return s, nil
+}
+
+// AddHook은 업로드를 등록하기 전에 실행할 검사를 추가합니다. 추가한 순서대로 실행되며,
+// 하나라도 오류를 반환하면 파일은 등록되지 않습니다. 서버를 시작하기 전에만 호출합니다.
+func (s *Storage) AddHook(hook UploadHook) {
+	s.hooks = append(s.hooks, hook)
+}
+
+// Save는 r의 내용을 owner의 파일로 저장하고 메타데이터를 색인에 기록합니다.
+// 내용은 임시 파일에 쓰면서 해시를 계산한 뒤, 검사를 거쳐 제자리로 옮깁니다.
+// quota가 0보다 크고 저장한 뒤 owner의 사용량이 quota를 넘으면 ErrQuotaExceeded를 반환합니다.
+// 같은 파일을 다시 올리면 사용량이 늘지 않으므로, 늘어나는 크기는 해시를 계산한 뒤에 셉니다.
+func (s *Storage) Save(owner, name string, r io.Reader, quota int64) (FileMeta, error) {
+	name, err := sanitizeName(name)
+	if err != nil {
+		return FileMeta{}, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(s.dir, "tmp"), "upload-*")
+	if err != nil {
+		return FileMeta{}, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// 한도보다 큰 내용은 어떻게 해도 들어갈 수 없으므로 한도보다 1바이트만 더 읽음.
+	// 남은 용량으로 자르면 이미 올린 파일을 다시 올릴 때 해시가 달라져 거절되므로,
+	// 남은 용량은 commit에서 확인함
+	if quota > 0 {
+		r = io.LimitReader(r, quota+1)
+	}
+
+	// MIME 형식 판별에 쓸 앞부분을 먼저 읽음
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return FileMeta{}, err
+	}
+	head = head[:n]
+
+	hasher := sha256.New()
+	w := io.MultiWriter(tmp, hasher)
+	if _, err := w.Write(head); err != nil {
+		return FileMeta{}, err
+	}
+	size, err := io.Copy(w, r)
+	if err != nil {
+		return FileMeta{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return FileMeta{}, err
+	}
+
+	sum := hex.EncodeToString(hasher.Sum(nil))
+	meta := FileMeta{ID: sum, Owner: owner, Name: name, Size: int64(n) + size, MIMEType: detectMIMEType(name, head), SHA256: sum}
+	return s.store(tmp.Name(), meta, quota)
+}
+
+// Import는 이미 디스크에 다 받아 둔 파일(이어받기 업로드)을 저장소로 옮깁니다.
+// checksum(SHA-256 16진수)이 주어지면 내용과 비교해 다르면 ErrChecksum을 반환합니다.
+// 성공하면 path의 파일은 저장소 안으로 옮겨져 사라집니다.
+func (s *Storage) Import(owner, name, path, checksum string, quota int64) (FileMeta, error) {
+	name, err := sanitizeName(name)
+	if err != nil {
+		return FileMeta{}, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return FileMeta{}, err
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return FileMeta{}, err
+	}
+	head = head[:n]
+
+	hasher := sha256.New()
+	hasher.Write(head)
+	size, err := io.Copy(hasher, file)
+	if err != nil {
+		return FileMeta{}, err
+	}
+	file.Close()
+
+	sum := hex.EncodeToString(hasher.Sum(nil))
+	if checksum != "" && checksum != sum {
+		return FileMeta{}, ErrChecksum
+	}
+	meta := FileMeta{ID: sum, Owner: owner, Name: name, Size: int64(n) + size, MIMEType: detectMIMEType(name, head), SHA256: sum}
+	return s.store(path, meta, quota)
+}
+
+// store는 원래 내용 그대로 받아 둔 path를 검사한 뒤, 필요하면 압축해서 등록합니다.
+// 검사 훅이 원래 내용을 읽을 수 있도록 압축은 검사를 통과한 다음에 합니다.
+// 성공하면 path의 파일은 남아 있지 않습니다.
+func (s *Storage) store(path string, meta FileMeta, quota int64) (FileMeta, error) {
+	upload := Upload{Owner: meta.Owner, Name: meta.Name, Size: meta.Size, MIMEType: meta.MIMEType, SHA256: meta.SHA256, Path: path}
+	for _, hook := range s.hooks {
+		if err := hook.Check(upload); err != nil {
+			return FileMeta{}, err
+		}
+	}
+
+	// 이미 있는 내용이거나 압축하지 않는 형식이면 받은 파일을 그대로 옮김
+	encoding := s.encodingFor(meta.MIMEType)
+	if encoding == "" || s.hasBlob(meta.ID) {
+		return s.commit(path, meta, "", quota)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return FileMeta{}, err
+	}
+	defer file.Close()
+
+	tmp, err := os.CreateTemp(filepath.Join(s.dir, "tmp"), "upload-*")
+	if err != nil {
+		return FileMeta{}, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	enc, err := newEncoder(tmp, encoding)
+	if err != nil {
+		return FileMeta{}, err
+	}
+	if _, err := io.Copy(enc, file); err != nil {
+		return FileMeta{}, err
+	}
+	if err := enc.Close(); err != nil {
+		return FileMeta{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return FileMeta{}, err
+	}
+
+	meta, err = s.commit(tmp.Name(), meta, encoding, quota)
+	if err != nil {
+		return FileMeta{}, err
+	}
+	file.Close()
+	os.Remove(path)
+	return meta, nil
+}
+
+// CleanTemp는 임시 디렉토리에 남은 파일을 지우고 지운 개수를 반환합니다.
+// 받다가 끊기거나 서버가 멈춰 등록되지 못한 업로드의 내용입니다. 받는 중인 업로드가
+// 없을 때(서버를 시작하기 전이나 종료한 뒤)만 호출합니다.
+func (s *Storage) CleanTemp() (int, error) {
+	tmpDir := filepath.Join(s.dir, "tmp")
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(tmpDir, entry.Name())); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// commit은 다 받은 임시 파일을 백엔드의 내용 해시 위치로 옮기고 색인에 기록합니다.
+// 같은 내용이 이미 있으면 임시 파일은 버리고 참조 수만 늘립니다.
+// encoding은 임시 파일을 압축한 방식입니다.
+//
+// 원격 백엔드에 올리는 동안 다른 요청이 멈추지 않도록 내용은 잠금 밖에서 올립니다.
+// 올리기 전에 잠근 상태에서 ID를 s.uploads에 맡아 두므로, 그동안 같은 내용을 올리려는
+// 요청은 끝나기를 기다렸다가 다시 확인하고, Delete는 그 내용을 지우지 않습니다.
+// 다 올린 뒤에는 잠금을 풀지 않고 등록까지 마쳐, 다른 요청이 끼어들 틈을 두지 않습니다.
+func (s *Storage) commit(tmpPath string, meta FileMeta, encoding string, quota int64) (FileMeta, error) {
+	meta.UploadedAt = time.Now().UTC()
+	key := indexKey(meta.Owner, meta.ID)
+	uploaded := false
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		// 같은 파일을 다시 올리면 기존 항목을 바꾸는 것이므로 그만큼은 빼고 계산
+		old, replacing := s.index[key]
+		if quota > 0 && s.usage(meta.Owner)-old.Size+meta.Size > quota {
+			// 올리는 동안 한도를 넘었으면 아무도 가리키지 않는 내용을 남기지 않음
+			if uploaded && s.blobs[meta.ID] == nil {
+				s.backend.Delete(blobKey(meta.ID))
+			}
+			return FileMeta{}, ErrQuotaExceeded
+		}
+
+		blob := s.blobs[meta.ID]
+		if blob == nil && !uploaded {
+			if done, busy := s.uploads[meta.ID]; busy {
+				s.mu.Unlock()
+				<-done
+				s.mu.Lock()
+				continue
+			}
+			done := make(chan struct{})
+			s.uploads[meta.ID] = done
+			s.mu.Unlock()
+			err := s.backend.PutFile(blobKey(meta.ID), tmpPath)
+			s.mu.Lock()
+			delete(s.uploads, meta.ID)
+			close(done)
+			if err != nil {
+				return FileMeta{}, err
+			}
+			uploaded = true
+			continue
+		}
+		if blob == nil {
+			blob = &blobInfo{encoding: encoding}
+			s.blobs[meta.ID] = blob
+		}
+		if !uploaded {
+			os.Remove(tmpPath)
+		}
+		if !replacing {
+			blob.refs++
+		}
+
+		meta.Encoding = blob.encoding
+		s.index[key] = meta
+		if err := s.saveIndex(); err != nil {
+			// 색인을 저장하지 못했으면 목록과 사용량에 남지 않도록 메모리도 되돌림
+			if replacing {
+				s.index[key] = old
+			} else {
+				delete(s.index, key)
+				blob.refs--
+			}
+			if blob.refs == 0 {
+				delete(s.blobs, meta.ID)
+				s.backend.Delete(blobKey(meta.ID))
+			}
+			return FileMeta{}, err
+		}
+		return meta, nil
+	}
+}
+
+// encodingFor는 mimeType의 파일을 저장할 때 쓸 압축 방식을 정합니다.
+func (s *Storage) encodingFor(mimeType string) string {
+	if s.compression == "" || !compressible(mimeType) {
+		return ""
+	}
+	return s.compression
+}
+
+// hasBlob은 같은 내용이 이미 저장되어 있는지 확인합니다.
+func (s *Storage) hasBlob(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.blobs[id] != nil
+}
+
+// Open은 owner의 파일 내용을 읽을 수 있도록 엽니다. 호출한 쪽에서 닫아야 합니다.
+// meta.Encoding이 비어 있지 않으면 파일은 그 방식으로 압축되어 있습니다.
+func (s *Storage) Open(owner, id string) (io.ReadSeekCloser, FileMeta, error) {
+	if !validID(id) {
+		return nil, FileMeta{}, ErrInvalidID
+	}
+
+	s.mu.Lock()
+	meta, ok := s.index[indexKey(owner, id)]
+	s.mu.Unlock()
+	if !ok {
+		return nil, FileMeta{}, ErrNotFound
+	}
+
+	file, err := s.backend.Open(blobKey(id))
+	if err != nil {
+		return nil, FileMeta{}, err
+	}
+	return file, meta, nil
+}
+
+// Stat은 owner의 파일 메타데이터를 반환합니다.
+func (s *Storage) Stat(owner, id string) (FileMeta, error) {
+	if !validID(id) {
+		return FileMeta{}, ErrInvalidID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	meta, ok := s.index[indexKey(owner, id)]
+	if !ok {
+		return FileMeta{}, ErrNotFound
+	}
+	return meta, nil
+}
+
+// Delete는 owner의 파일 메타데이터를 지웁니다.
+// 같은 내용을 가리키는 항목이 더 없고, 같은 내용을 올리는 중인 요청도 없을 때만
+// 내용 파일도 지웁니다.
+func (s *Storage) Delete(owner, id string) (FileMeta, error) {
+	if !validID(id) {
+		return FileMeta{}, ErrInvalidID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := indexKey(owner, id)
+	meta, ok := s.index[key]
+	if !ok {
+		return FileMeta{}, ErrNotFound
+	}
+	delete(s.index, key)
+	if err := s.saveIndex(); err != nil {
+		// 저장된 색인에는 남아 있으므로 메모리도 그대로 둠
+		s.index[key] = meta
+		return FileMeta{}, err
+	}
+
+	blob := s.blobs[id]
+	if blob.refs--; blob.refs > 0 {
+		return meta, nil
+	}
+	delete(s.blobs, id)
+	if _, busy := s.uploads[id]; busy {
+		return meta, nil
+	}
+	if err := s.backend.Delete(blobKey(id)); err != nil {
+		return FileMeta{}, err
+	}
+	return meta, nil
+}
+
+// List는 owner의 파일 메타데이터를 업로드 순서대로 반환합니다.
+func (s *Storage) List(owner string) []FileMeta {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files := make([]FileMeta, 0)
+	for _, meta := range s.index {
+		if meta.Owner == owner {
+			files = append(files, meta)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].UploadedAt.Before(files[j].UploadedAt)
+	})
+	return files
+}
+
+// Usage는 owner가 저장한 파일 크기의 합입니다.
+func (s *Storage) Usage(owner string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usage(owner)
+}
+
+// usage는 Usage와 같지만 s.mu를 잡은 상태에서 호출합니다.
+func (s *Storage) usage(owner string) int64 {
+	var total int64
+	for _, meta := range s.index {
+		if meta.Owner == owner {
+			total += meta.Size
+		}
+	}
+	return total
+}
+
+// indexKey는 색인에서 owner의 파일 id를 찾을 때 쓰는 키입니다.
+func indexKey(owner, id string) string {
+	return owner + "/" + id
+}
+
+// blobKey는 파일 ID의 내용이 저장되는 백엔드 키입니다. id는 validID로 검사한 값이어야 합니다.
+func blobKey(id string) string {
+	return "objects/" + id[:2] + "/" + id
+}
+
+// saveIndex는 색인을 백엔드에 저장합니다. s.mu를 잡은 상태에서 호출합니다.
+func (s *Storage) saveIndex() error {
+	data, err := json.MarshalIndent(s.index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.backend.Put(indexFileName, data)
+}
+
+// sanitizeName은 업로드된 파일 이름을 normalizeName으로 맞춘 뒤 검사합니다.
+// 경로 구분자, 상위 디렉토리, 제어 문자처럼 의심스러운 이름은 고치지 않고 거부합니다.
+func sanitizeName(name string) (string, error) {
+	if !utf8.ValidString(name) {
+		return "", ErrInvalidName
+	}
+	name = normalizeName(name)
+	if name == "" || name == "." || name == ".." || len(name) > maxNameLength {
+		return "", ErrInvalidName
+	}
+	if strings.ContainsAny(name, `/\`) {
+		return "", ErrInvalidName
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return "", ErrInvalidName
+		}
+	}
+	return name, nil
+}
+
+// validID는 id가 SHA-256 16진수 문자열인지 확인합니다.
+func validID(id string) bool {
+	if len(id) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range id {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// detectMIMEType은 내용의 앞부분으로 MIME 형식을 판별하고,
+// 판별할 수 없으면 확장자로 추측합니다.
+// 미디어 파일은 sniffMedia로 더 자세히 판별합니다. 텍스트 같은 다른 형식이 미디어로
+// 잘못 판별되지 않도록, DetectContentType이 모르거나 미디어라고 한 경우에만 씁니다.
+func detectMIMEType(name string, head []byte) string {
+	detected := http.DetectContentType(head)
+	if detected == "application/octet-stream" || isMedia(detected) {
+		if media := sniffMedia(head); media != "" {
+			return media
+		}
+	}
+	if detected != "application/octet-stream" {
+		return detected
+	}
+	if byExt := mime.TypeByExtension(filepath.Ext(name)); byExt != "" {
+		return byExt
+	}
+	return detected
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// openTestStorage는 임시 디렉토리에 로컬 백엔드를 쓰는 빈 저장소를 엽니다.
+func openTestStorage(t *testing.T) *Storage {
+	t.Helper()
+	dir := t.TempDir()
+	backend, err := NewLocalBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := OpenStorage(dir, backend, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		err  error
+	}{
+		{"report.pdf", "report.pdf", nil},
+		{"사진 모음.zip", "사진 모음.zip", nil},
+		{"\u1100\u1161.txt", "\uac00.txt", nil}, // 풀어 쓴 자모는 NFC로 합침
+		{"  two   spaces  .txt", "two spaces .txt", nil},
+		{"\u3000wide space", "wide space", nil},
+		{"photo\u202egpj.exe", "photogpj.exe", nil},
+		{"zero\u200bwidth", "zerowidth", nil},
+		{"family\u200d.png", "family\u200d.png", nil},
+		{"trailing dots...", "trailing dots", nil},
+		{"trailing space. . ", "trailing space", nil},
+		{".hidden", ".hidden", nil},
+		{strings.Repeat("a", maxNameLength), strings.Repeat("a", maxNameLength), nil},
+
+		{"", "", ErrInvalidName},
+		{"   ", "", ErrInvalidName},
+		{".", "", ErrInvalidName},
+		{"..", "", ErrInvalidName},
+		{"...", "", ErrInvalidName},
+		{"\u200b", "", ErrInvalidName},
+		{"../etc/passwd", "", ErrInvalidName},
+		{"dir/file", "", ErrInvalidName},
+		{`dir\file`, "", ErrInvalidName},
+		{"new\nline", "", ErrInvalidName},
+		{"nul\x00byte", "", ErrInvalidName},
+		{"del\x7f", "", ErrInvalidName},
+		{"bad\xffutf8", "", ErrInvalidName},
+		{strings.Repeat("a", maxNameLength+1), "", ErrInvalidName},
+		{strings.Repeat("가", 86), "", ErrInvalidName}, // 글자 수가 아니라 바이트로 셈
+	}
+	for _, tt := range tests {
+		got, err := sanitizeName(tt.name)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("sanitizeName(%q) = %q, %v; want %q, %v", tt.name, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestSaveQuota(t *testing.T) {
+	s := openTestStorage(t)
+	const quota = 100
+	content := strings.Repeat("a", 60)
+
+	tests := []struct {
+		name    string
+		owner   string
+		content string
+		want    error
+		usage   int64
+	}{
+		{"first upload", "alice", content, nil, 60},
+		// 남은 용량(40)보다 크지만 같은 내용이므로 사용량이 늘지 않음
+		{"same content again", "alice", content, nil, 60},
+		{"new content over quota", "alice", strings.Repeat("b", 41), ErrQuotaExceeded, 60},
+		{"new content filling quota", "alice", strings.Repeat("b", 40), nil, 100},
+		{"larger than quota", "bob", strings.Repeat("c", quota+1), ErrQuotaExceeded, 0},
+		// 다른 사용자가 올린 같은 내용은 그 사용자의 용량으로 셈
+		{"content shared with other owner", "bob", content, nil, 60},
+	}
+	for _, tt := range tests {
+		_, err := s.Save(tt.owner, "file.txt", strings.NewReader(tt.content), quota)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: Save = %v, want %v", tt.name, err, tt.want)
+		}
+		if got := s.Usage(tt.owner); got != tt.usage {
+			t.Errorf("%s: usage = %d, want %d", tt.name, got, tt.usage)
+		}
+	}
+}
+
+// blockingBackend는 PutFile이 release가 닫힐 때까지 끝나지 않게 하고 호출 수를 셉니다.
+type blockingBackend struct {
+	*LocalBackend
+	started chan struct{}
+	release chan struct{}
+	puts    atomic.Int32
+}
+
+func (b *blockingBackend) PutFile(key, path string) error {
+	b.puts.Add(1)
+	b.started <- struct{}{}
+	<-b.release
+	return b.LocalBackend.PutFile(key, path)
+}
+
+func TestCommitWhileUploading(t *testing.T) {
+	dir := t.TempDir()
+	local, err := NewLocalBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := &blockingBackend{LocalBackend: local, started: make(chan struct{}, 2), release: make(chan struct{})}
+	s, err := OpenStorage(dir, backend, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := "same content from two users"
+	results := make(chan error, 2)
+	for _, owner := range []string{"alice", "bob"} {
+		go func() {
+			_, err := s.Save(owner, "file.txt", strings.NewReader(content), 0)
+			results <- err
+		}()
+	}
+	// 먼저 올리기 시작한 요청이 끝날 때까지 다른 요청은 같은 내용을 올리지 않고 기다림
+	<-backend.started
+	select {
+	case <-backend.started:
+		t.Fatal("second upload of the same content started")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(backend.release)
+	for range 2 {
+		if err := <-results; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := backend.puts.Load(); n != 1 {
+		t.Errorf("PutFile called %d times, want 1", n)
+	}
+
+	// 한 사용자가 지워도 다른 사용자의 내용은 남음
+	id := s.List("alice")[0].ID
+	if _, err := s.Delete("alice", id); err != nil {
+		t.Fatal(err)
+	}
+	file, _, err := s.Open("bob", id)
+	if err != nil {
+		t.Fatalf("open after other owner deleted: %v", err)
+	}
+	file.Close()
+	if _, err := s.Delete("bob", id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := local.Open(blobKey(id)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("blob left after last delete: %v", err)
+	}
+}
+
+// failingBackend는 failIndex가 참이면 색인 저장에 실패합니다.
+type failingBackend struct {
+	*LocalBackend
+	failIndex bool
+}
+
+func (b *failingBackend) Put(key string, data []byte) error {
+	if b.failIndex && key == indexFileName {
+		return errors.New("index write failed")
+	}
+	return b.LocalBackend.Put(key, data)
+}
+
+func TestIndexSaveFailure(t *testing.T) {
+	dir := t.TempDir()
+	local, err := NewLocalBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := &failingBackend{LocalBackend: local}
+	s, err := OpenStorage(dir, backend, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := s.Save("alice", "kept.txt", strings.NewReader("kept content"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend.failIndex = true
+	for _, tt := range []struct{ name, content string }{
+		{"new content", "lost content"},
+		{"same content again", "kept content"},
+	} {
+		if _, err := s.Save("alice", tt.name+".txt", strings.NewReader(tt.content), 0); err == nil {
+			t.Fatalf("%s: save succeeded without index", tt.name)
+		}
+		if files := s.List("alice"); len(files) != 1 || files[0].Name != "kept.txt" {
+			t.Errorf("%s: files after failed save: %+v", tt.name, files)
+		}
+		if got := s.Usage("alice"); got != kept.Size {
+			t.Errorf("%s: usage = %d, want %d", tt.name, got, kept.Size)
+		}
+	}
+	if s.blobs[kept.ID].refs != 1 {
+		t.Errorf("refs = %d, want 1", s.blobs[kept.ID].refs)
+	}
+	lost := sha256.Sum256([]byte("lost content"))
+	if _, err := local.Open(blobKey(hex.EncodeToString(lost[:]))); !errors.Is(err, ErrNotFound) {
+		t.Errorf("content of failed save left in backend: %v", err)
+	}
+
+	if _, err := s.Delete("alice", kept.ID); err == nil {
+		t.Fatal("delete succeeded without index")
+	}
+	if _, err := s.Stat("alice", kept.ID); err != nil {
+		t.Errorf("entry gone after failed delete: %v", err)
+	}
+
+	backend.failIndex = false
+	if _, err := s.Delete("alice", kept.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := local.Open(blobKey(kept.ID)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("blob left after delete: %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// 미디어 스트리밍 핸들러: GET /stream/<파일 ID>
+// 오디오와 동영상을 브라우저에서 바로 재생하고 탐색할 수 있도록 inline으로 내려줍니다.
+func handleStream(w http.ResponseWriter, r *http.Request, user *User) {
+	id := strings.TrimPrefix(r.URL.Path, "/stream/")
+
+	fmt.Printf("스트리밍 요청: %s (%s)\n", id, user.Name)
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "GET 또는 HEAD 요청만 가능합니다.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	file, meta, err := storage.Open(user.Name, id)
+	if err != nil {
+		storageError(w, err, "스트리밍")
+		return
+	}
+	defer file.Close()
+
+	serveStream(w, r, file, meta)
+}
+
+// serveStream은 파일을 미디어로 내려줍니다. 형식은 저장된 값이 아니라 내용의 앞부분을
+// 다시 판별해 정하므로, 확장자가 틀리거나 예전에 잘못 판별된 파일도 올바르게 재생됩니다.
+// 범위 요청(여러 범위 포함)과 조건부 요청은 ServeContent가 처리합니다.
+func serveStream(w http.ResponseWriter, r *http.Request, file io.ReadSeeker, meta FileMeta) {
+	// 탐색하려면 원래 내용 기준의 범위가 필요하므로 압축된 파일은 항상 풀어서 보냄
+	var content io.ReadSeeker = file
+	if meta.Encoding != "" {
+		decoded := newDecodedFile(file, meta.Encoding, meta.Size)
+		defer decoded.Close()
+		content = decoded
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(content, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		storageError(w, err, "스트리밍")
+		return
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		storageError(w, err, "스트리밍")
+		return
+	}
+
+	mediaType := detectMIMEType(meta.Name, head[:n])
+	if !isMedia(mediaType) {
+		http.Error(w, fmt.Sprintf("오디오나 동영상 파일이 아닙니다: %s", mediaType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	w.Header().Set("ETag", `"`+meta.SHA256+`"`)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": meta.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, meta.Name, meta.UploadedAt, content)
+	fmt.Printf("스트리밍 완료: %s (%s, %s)\n", meta.Name, meta.ID, mediaType)
+}
+
+// isMedia는 브라우저가 재생할 수 있는 오디오나 동영상 형식인지 확인합니다.
+func isMedia(mimeType string) bool {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "audio/") || strings.HasPrefix(mediaType, "video/") || mediaType == "application/ogg"
+}
+
+// sniffMedia는 http.DetectContentType이 알아보지 못하거나 뭉뚱그려 판별하는 미디어 형식을
+// 내용의 앞부분으로 판별합니다. 알 수 없으면 ""를 반환합니다.
+func sniffMedia(head []byte) string {
+	switch {
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		return sniffISOBaseMedia(head)
+	case bytes.HasPrefix(head, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		// EBML 헤더의 DocType으로 WebM과 Matroska를 구분
+		if bytes.Contains(head, []byte("webm")) {
+			return "video/webm"
+		}
+		return "video/x-matroska"
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return "audio/flac"
+	case bytes.HasPrefix(head, []byte("OggS")):
+		switch {
+		case bytes.Contains(head, []byte("OpusHead")):
+			return "audio/ogg; codecs=opus"
+		case bytes.Contains(head, []byte("\x01vorbis")):
+			return "audio/ogg"
+		case bytes.Contains(head, []byte("\x80theora")):
+			return "video/ogg"
+		}
+		return "application/ogg"
+	case bytes.HasPrefix(head, []byte("ID3")):
+		return "audio/mpeg"
+	case len(head) >= 2 && head[0] == 0xFF && head[1]&0xF6 == 0xF0:
+		// ADTS 프레임 (MPEG-4 또는 MPEG-2 AAC, 레이어 비트 00)
+		return "audio/aac"
+	case len(head) >= 2 && head[0] == 0xFF && head[1]&0xE0 == 0xE0 && head[1]&0x06 != 0:
+		// ID3 태그 없이 바로 시작하는 MPEG 오디오 프레임
+		return "audio/mpeg"
+	case len(head) > 188 && head[0] == 0x47 && head[188] == 0x47:
+		// 188바이트마다 동기 바이트가 오는 MPEG-TS
+		return "video/mp2t"
+	}
+	return ""
+}
+
+// sniffISOBaseMedia는 MP4 계열 파일의 ftyp 상자에 있는 브랜드로 형식을 판별합니다.
+func sniffISOBaseMedia(head []byte) string {
+	size := int(binary.BigEndian.Uint32(head[:4]))
+	if size < 16 || size > len(head) {
+		size = min(len(head), 64)
+	}
+
+	brands := []string{string(head[8:12])}
+	for i := 16; i+4 <= size; i += 4 {
+		brands = append(brands, string(head[i:i+4]))
+	}
+	for _, brand := range brands {
+		switch brand {
+		case "qt  ":
+			return "video/quicktime"
+		case "M4A ", "M4B ", "M4P ":
+			return "audio/mp4"
+		case "3gp4", "3gp5", "3gp6", "3g2a":
+			return "video/3gpp"
+		case "avif", "avis", "heic", "heix", "mif1", "msf1":
+			// 이미지 형식은 DetectContentType과 확장자에 맡김
+			return ""
+		}
+	}
+	return "video/mp4"
+}
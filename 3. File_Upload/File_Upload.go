@@ -1,139 +1,449 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 )
 
-const uploadDir = "./uploads"
+const (
+	defaultListen          = ":8080"
+	defaultUploadDir       = "./uploads"
+	defaultMaxUpload       = "1G"             // 파일 하나의 기본 최대 크기
+	defaultScanTimeout     = 2 * time.Minute  // 검사 명령을 기다리는 기본 시간
+	defaultShutdownTimeout = 5 * time.Minute  // 종료할 때 받는 중인 업로드를 기다리는 기본 시간
+	readHeaderTimeout      = 30 * time.Second // 요청 헤더를 다 받을 때까지 기다리는 시간
+	multipartOverhead      = 64 << 10         // multipart 요청에서 파일 내용 외의 부분으로 허용하는 크기
+)
+
+// 모든 핸들러는 이 저장소를 통해서만 파일에 접근
+var storage *Storage
+
+// 받는 중인 이어받기 업로드 세션
+var sessions *SessionStore
+
+// 등록된 사용자. 모든 요청은 이 목록으로 인증
+var users *UserStore
+
+// 로그인 없이 쓸 수 있는 공유 링크
+var shares *ShareStore
+
+// 파일 하나의 최대 크기. 0이면 제한하지 않음
+var maxUploadSize int64
 
 func main() {
-	// 업로드 디렉토리 생성
-	if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
-		err := os.Mkdir(uploadDir, os.ModePerm)
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("설정 오류: %v\n", err)
+		os.Exit(2)
+	}
+
+	u, err := LoadUsers(cfg.Users)
+	if err != nil {
+		fmt.Printf("사용자 목록을 읽는 중 오류 발생: %v\n", err)
+		return
+	}
+	users = u
+
+	// 사용자 관리 명령: go run . user add <이름> [용량 한도]
+	if flag.Arg(0) == "user" {
+		if err := os.MkdirAll(filepath.Dir(cfg.Users), 0755); err != nil {
+			fmt.Printf("사용자 목록 디렉토리를 만들 수 없습니다: %v\n", err)
+			os.Exit(1)
+		}
+		if err := runUserCommand(users, flag.Args()[1:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if users.Len() == 0 {
+		fmt.Println("등록된 사용자가 없습니다. 'go run . user add <이름>'으로 사용자를 먼저 추가하세요.")
+	}
+
+	// 저장 백엔드와 저장소 준비. S3 접근 키는 명령줄에 남지 않도록 환경 변수로만 받음
+	var backend Backend
+	switch cfg.Storage {
+	case "local":
+		backend, err = NewLocalBackend(cfg.Dir)
+	case "s3":
+		backend, err = NewS3Backend(cfg.S3Endpoint, cfg.S3Bucket, cfg.S3Region,
+			os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"))
+	default:
+		err = fmt.Errorf("알 수 없는 저장소 종류: %q", cfg.Storage)
+	}
+	if err != nil {
+		fmt.Printf("저장소 준비 중 오류 발생: %v\n", err)
+		return
+	}
+	s, err := OpenStorage(cfg.Dir, backend, cfg.Compress)
+	if err != nil {
+		fmt.Printf("저장소 준비 중 오류 발생: %v\n", err)
+		return
+	}
+	storage = s
+	cleanTemp("지난번에 끝나지 못한")
+
+	// 업로드 검사: 크기는 요청을 받을 때, 형식과 검사 명령은 등록하기 직전에 확인
+	if maxUploadSize, err = parseSize(cfg.MaxUpload); err != nil {
+		fmt.Printf("최대 크기 설정 오류: %v\n", err)
+		return
+	}
+	filter, err := NewTypeFilter(cfg.AllowTypes, cfg.DenyTypes)
+	if err != nil {
+		fmt.Printf("형식 목록 설정 오류: %v\n", err)
+		return
+	}
+	storage.AddHook(filter)
+	if cfg.ScanCommand != "" {
+		scanner, err := NewCommandScanner(cfg.ScanCommand, cfg.ScanTimeout.Duration)
+		if err != nil {
+			fmt.Printf("검사 명령 설정 오류: %v\n", err)
+			return
+		}
+		storage.AddHook(scanner)
+		fmt.Printf("업로드 검사 명령: %s\n", cfg.ScanCommand)
+	}
+
+	sessions, err = OpenSessionStore(filepath.Join(cfg.Dir, sessionDirName), cfg.SessionTTL.Duration)
+	if err != nil {
+		fmt.Printf("업로드 세션 준비 중 오류 발생: %v\n", err)
+		return
+	}
+	go sessions.RunSweeper()
+
+	shares, err = OpenShareStore(cfg.Dir)
+	if err != nil {
+		fmt.Printf("공유 링크 준비 중 오류 발생: %v\n", err)
+		return
+	}
+
+	// 접근 기록은 진행 상황 출력과 섞이지 않도록 기본으로 파일에 남김
+	var accessOut io.Writer = os.Stdout
+	if cfg.AccessLog != "-" {
+		file, err := os.OpenFile(cfg.AccessLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
 		if err != nil {
-			fmt.Printf("업로드 디렉토리 생성 중 오류 발생: %v\n", err)
+			fmt.Printf("접근 기록 파일을 열 수 없습니다: %v\n", err)
 			return
 		}
-		fmt.Println("업로드 디렉토리가 생성되었습니다.")
+		defer file.Close()
+		accessOut = file
+		fmt.Printf("접근 기록 파일: %s\n", cfg.AccessLog)
 	}
 
-	// HTTP 핸들러 설정
-	http.HandleFunc("/upload", handleUpload)
-	http.HandleFunc("/files", handleListFiles)
-	http.HandleFunc("/download/", handleDownload)
-	http.HandleFunc("/delete/", handleDelete)
+	// HTTP 핸들러 설정. 공유 링크로 받는 다운로드 외에는 로그인한 사용자만 사용할 수 있음
+	mux := http.NewServeMux()
+	mux.HandleFunc("/upload", users.Require(handleUpload))
+	mux.HandleFunc("/files", users.Require(handleListFiles))
+	mux.HandleFunc("/download/", shares.Allow(users.Require(handleDownload)))
+	mux.HandleFunc("/stream/", shares.Allow(users.Require(handleStream)))
+	mux.HandleFunc("/delete/", users.Require(handleDelete))
+	mux.HandleFunc("/uploads/", users.Require(handleResumable))
+	mux.HandleFunc("/share/", users.Require(handleShare))
+	mux.HandleFunc("/", users.Require(handleIndex))
 
-	// 서버 시작
-	fmt.Println("파일 서버가 시작되었습니다. http://localhost:8080")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
+	server := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           newAccessLogger(accessOut).Wrap(mux),
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+	if err := serve(server, cfg); err != nil {
 		fmt.Printf("서버 시작 실패: %v\n", err)
+		return
+	}
+	cleanTemp("종료하면서 받다가 만")
+	fmt.Println("파일 서버를 종료했습니다.")
+}
+
+// serve는 SIGINT나 SIGTERM을 받을 때까지 요청을 받습니다. 신호를 받으면 새 연결은 받지 않고
+// 처리 중인 요청(받는 중인 업로드 포함)이 끝나기를 cfg.ShutdownTimeout까지 기다린 뒤,
+// 그래도 남은 연결은 끊습니다. 이어받기 세션은 다시 시작한 뒤 이어 받을 수 있으므로 남겨 둡니다.
+func serve(server *http.Server, cfg *Config) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	scheme := "http"
+	errc := make(chan error, 1)
+	go func() {
+		if cfg.TLSCert != "" {
+			errc <- server.ListenAndServeTLS(cfg.TLSCert, cfg.TLSKey)
+		} else {
+			errc <- server.ListenAndServe()
+		}
+	}()
+	if cfg.TLSCert != "" {
+		scheme = "https"
+	}
+	fmt.Printf("파일 서버가 시작되었습니다. %s://%s\n", scheme, displayAddr(cfg.Listen))
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	// 다시 Ctrl+C를 누르면 기다리지 않고 바로 끝나도록 신호 처리를 되돌림
+	stop()
+
+	fmt.Printf("종료 신호를 받았습니다. 처리 중인 요청을 최대 %s 기다립니다.\n", cfg.ShutdownTimeout.Duration)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout.Duration)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		fmt.Printf("기다리는 시간이 지나 남은 연결을 끊습니다: %v\n", err)
+		server.Close()
+	}
+	return nil
+}
+
+// displayAddr는 ":8080"처럼 호스트가 빠진 주소를 브라우저에서 열 수 있는 형태로 바꿉니다.
+func displayAddr(addr string) string {
+	if strings.HasPrefix(addr, ":") {
+		return "localhost" + addr
+	}
+	return addr
+}
+
+// cleanTemp는 등록되지 못하고 남은 임시 파일을 지우고 결과를 출력합니다.
+func cleanTemp(when string) {
+	n, err := storage.CleanTemp()
+	if err != nil {
+		fmt.Printf("임시 파일 정리 중 오류 발생: %v\n", err)
+		return
+	}
+	if n > 0 {
+		fmt.Printf("%s 업로드의 임시 파일 %d개를 지웠습니다.\n", when, n)
 	}
 }
 
 // 파일 업로드 핸들러
-func handleUpload(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("파일 업로드 요청을 받았습니다.")
+func handleUpload(w http.ResponseWriter, r *http.Request, user *User) {
+	fmt.Printf("파일 업로드 요청을 받았습니다. (%s)\n", user.Name)
 
 	if r.Method != http.MethodPost {
 		http.Error(w, "POST 요청만 가능합니다.", http.StatusMethodNotAllowed)
 		return
 	}
 
-	file, header, err := r.FormFile("file")
+	// 요청 크기만으로 한도를 넘는 것이 확실하면 본문을 받기 전에 거절. 이미 올린 파일을
+	// 다시 올리면 사용량이 늘지 않으므로 지금 사용량이 아니라 한도 자체와 비교함
+	if user.Quota > 0 && r.ContentLength > user.Quota+multipartOverhead {
+		storageError(w, ErrQuotaExceeded, "파일 저장")
+		return
+	}
+
+	// 최대 크기를 넘는 본문은 끝까지 읽지 않음
+	if maxUploadSize > 0 {
+		if r.ContentLength > maxUploadSize+multipartOverhead {
+			storageError(w, ErrFileTooLarge, "파일 저장")
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize+multipartOverhead)
+	}
+
+	// multipart 본문을 미리 다 받아 두지 않고 "file" 필드를 바로 저장소로 흘려 보냄.
+	// 받다가 끊기거나 서버가 종료되면 남는 것은 저장소의 임시 파일뿐
+	reader, err := r.MultipartReader()
 	if err != nil {
 		http.Error(w, fmt.Sprintf("파일을 읽는 중 오류 발생: %v", err), http.StatusBadRequest)
 		fmt.Printf("파일 읽기 오류: %v\n", err)
 		return
 	}
-	defer file.Close()
-
-	// 파일 저장
-	dst, err := os.Create(filepath.Join(uploadDir, header.Filename))
+	var part *multipart.Part
+	for {
+		part, err = reader.NextPart()
+		if err != nil || (part.FormName() == "file" && part.FileName() != "") {
+			break
+		}
+	}
+	if err == io.EOF {
+		http.Error(w, "file 필드가 없습니다.", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
-		http.Error(w, fmt.Sprintf("파일 저장 중 오류 발생: %v", err), http.StatusInternalServerError)
-		fmt.Printf("파일 저장 오류: %v\n", err)
+		storageError(w, err, "파일 읽기")
 		return
 	}
-	defer dst.Close()
+	defer part.Close()
 
-	// 파일 복사
-	if _, err := io.Copy(dst, file); err != nil {
-		http.Error(w, fmt.Sprintf("파일 복사 중 오류 발생: %v", err), http.StatusInternalServerError)
-		fmt.Printf("파일 복사 오류: %v\n", err)
+	var file io.Reader = part
+	if maxUploadSize > 0 {
+		file = &sizeLimitReader{r: part, n: maxUploadSize}
+	}
+
+	// 저장소에 저장 (이름 검사, 해시 계산, 색인 기록)
+	meta, err := storage.Save(user.Name, uploadedName(part.FileName(), part.Header.Get("Content-Disposition")), file, user.Quota)
+	if err != nil {
+		storageError(w, err, "파일 저장")
 		return
 	}
 
-	fmt.Printf("파일 업로드 성공: %s\n", header.Filename)
-	fmt.Fprintf(w, "파일 업로드 성공: %s\n", header.Filename)
+	fmt.Printf("파일 업로드 성공: %s (%s)\n", meta.Name, meta.ID)
+	fmt.Fprintf(w, "파일 업로드 성공: %s\nID: %s\n", meta.Name, meta.ID)
 }
 
 // 파일 목록 핸들러
-func handleListFiles(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("파일 목록 조회 요청을 받았습니다.")
+func handleListFiles(w http.ResponseWriter, r *http.Request, user *User) {
+	fmt.Printf("파일 목록 조회 요청을 받았습니다. (%s)\n", user.Name)
 
-	files, err := os.ReadDir(uploadDir)
+	query, err := parseListQuery(r.URL.Query())
 	if err != nil {
-		http.Error(w, fmt.Sprintf("파일 목록을 읽는 중 오류 발생: %v", err), http.StatusInternalServerError)
-		fmt.Printf("파일 목록 읽기 오류: %v\n", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	page := query.apply(storage.List(user.Name))
 
-	var fileList []string
-	for _, file := range files {
-		if !file.IsDir() {
-			fileList = append(fileList, file.Name())
+	if wantsJSON(r.URL.Query(), r.Header.Get("Accept")) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(page); err != nil {
+			fmt.Printf("파일 목록 전송 오류: %v\n", err)
+			return
 		}
+		fmt.Println("파일 목록 조회 완료")
+		return
 	}
 
-	w.Header().Set("Content-Type", "text/plain")
+	// 한 줄에 파일 하나: ID, 이름, 크기, MIME 형식, 업로드 시각 (탭으로 구분)
+	var fileList []string
+	for _, meta := range page.Files {
+		fileList = append(fileList, fmt.Sprintf("%s\t%s\t%d\t%s\t%s",
+			meta.ID, meta.Name, meta.Size, meta.MIMEType, meta.UploadedAt.Format(time.RFC3339)))
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.Write([]byte(strings.Join(fileList, "\n")))
 	fmt.Println("파일 목록 조회 완료")
 }
 
 // 파일 다운로드 핸들러
-func handleDownload(w http.ResponseWriter, r *http.Request) {
-	filename := strings.TrimPrefix(r.URL.Path, "/download/")
-	filePath := filepath.Join(uploadDir, filename)
+func handleDownload(w http.ResponseWriter, r *http.Request, user *User) {
+	id := strings.TrimPrefix(r.URL.Path, "/download/")
+
+	fmt.Printf("파일 다운로드 요청: %s\n", id)
 
-	fmt.Printf("파일 다운로드 요청: %s\n", filename)
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "GET 또는 HEAD 요청만 가능합니다.", http.StatusMethodNotAllowed)
+		return
+	}
 
-	// 파일 존재 여부 확인
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		http.Error(w, fmt.Sprintf("파일이 존재하지 않습니다: %s", filename), http.StatusNotFound)
-		fmt.Printf("파일 존재하지 않음: %s\n", filename)
+	file, meta, err := storage.Open(user.Name, id)
+	if err != nil {
+		storageError(w, err, "파일 다운로드")
 		return
 	}
+	defer file.Close()
 
-	http.ServeFile(w, r, filePath)
-	fmt.Printf("파일 다운로드 완료: %s\n", filename)
+	serveFile(w, r, file, meta)
+}
+
+// serveFile은 저장할 때의 이름과 형식으로 파일을 내려줍니다. ID가 내용의 해시이므로 그대로
+// ETag로 씁니다. Accept-Ranges, 범위 요청(여러 범위면 multipart/byteranges), If-Match,
+// If-None-Match, If-Modified-Since, If-Unmodified-Since, If-Range와 HEAD 처리는
+// ServeContent에 맡깁니다.
+//
+// 압축해 저장한 파일은 클라이언트가 그 방식을 받아들이면 압축된 그대로 Content-Encoding을
+// 붙여 보내고, 아니면 풀어서 보냅니다. 범위 요청은 항상 원래 내용을 기준으로 합니다.
+func serveFile(w http.ResponseWriter, r *http.Request, file io.ReadSeeker, meta FileMeta) {
+	etag := `"` + meta.SHA256 + `"`
+	var content io.ReadSeeker = file
+	if meta.Encoding != "" {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Header.Get("Range") == "" && acceptsEncoding(r.Header.Get("Accept-Encoding"), meta.Encoding) {
+			w.Header().Set("Content-Encoding", meta.Encoding)
+			etag = `"` + meta.SHA256 + "-" + meta.Encoding + `"`
+		} else {
+			decoded := newDecodedFile(file, meta.Encoding, meta.Size)
+			defer decoded.Close()
+			content = decoded
+		}
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Type", meta.MIMEType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": meta.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, meta.Name, meta.UploadedAt, content)
+	fmt.Printf("파일 다운로드 완료: %s (%s)\n", meta.Name, meta.ID)
 }
 
 // 파일 삭제 핸들러
-func handleDelete(w http.ResponseWriter, r *http.Request) {
-	filename := strings.TrimPrefix(r.URL.Path, "/delete/")
-	filePath := filepath.Join(uploadDir, filename)
+func handleDelete(w http.ResponseWriter, r *http.Request, user *User) {
+	id := strings.TrimPrefix(r.URL.Path, "/delete/")
 
-	fmt.Printf("파일 삭제 요청: %s\n", filename)
+	fmt.Printf("파일 삭제 요청: %s\n", id)
 
-	// 파일 존재 여부 확인
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		http.Error(w, fmt.Sprintf("파일이 존재하지 않습니다: %s", filename), http.StatusNotFound)
-		fmt.Printf("파일 존재하지 않음: %s\n", filename)
+	// 링크나 이미지 태그만으로 지워지지 않도록 GET은 받지 않음
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "POST 또는 DELETE 요청만 가능합니다.", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// 파일 삭제
-	if err := os.Remove(filePath); err != nil {
-		http.Error(w, fmt.Sprintf("파일 삭제 중 오류 발생: %v", err), http.StatusInternalServerError)
-		fmt.Printf("파일 삭제 오류: %v\n", err)
+	meta, err := storage.Delete(user.Name, id)
+	if err != nil {
+		storageError(w, err, "파일 삭제")
 		return
 	}
 
-	fmt.Printf("파일 삭제 성공: %s\n", filename)
-	fmt.Fprintf(w, "파일 삭제 성공: %s\n", filename)
+	fmt.Printf("파일 삭제 성공: %s (%s)\n", meta.Name, meta.ID)
+	fmt.Fprintf(w, "파일 삭제 성공: %s\n", meta.Name)
+}
+
+// uploadedName은 업로드 요청에 담긴 원래 파일 이름을 반환합니다.
+// multipart 패키지는 이름에서 디렉토리 부분을 미리 떼어 내므로, "../" 같은
+// 의심스러운 이름을 거부할 수 있도록 Content-Disposition의 값을 그대로 사용합니다.
+func uploadedName(filename, disposition string) string {
+	if _, params, err := mime.ParseMediaType(disposition); err == nil && params["filename"] != "" {
+		return params["filename"]
+	}
+	return filename
+}
+
+// storageError는 저장소 오류를 알맞은 HTTP 상태 코드로 응답합니다.
+func storageError(w http.ResponseWriter, err error, action string) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrInvalidName), errors.Is(err, ErrInvalidID):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrOffsetMismatch), errors.Is(err, ErrIncomplete):
+		status = http.StatusConflict
+	case errors.Is(err, ErrUploadTooLarge), errors.Is(err, ErrQuotaExceeded), errors.Is(err, ErrFileTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.As(err, new(*http.MaxBytesError)):
+		err = ErrFileTooLarge
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrTooManyUploads):
+		status = http.StatusTooManyRequests
+	case errors.Is(err, ErrTooManyLogins):
+		w.Header().Set("Retry-After", strconv.Itoa(int(authFailureWindow.Seconds())))
+		status = http.StatusTooManyRequests
+	case errors.Is(err, ErrTypeNotAllowed):
+		status = http.StatusUnsupportedMediaType
+	case errors.Is(err, ErrFileRejected):
+		status = http.StatusUnprocessableEntity
+	case errors.Is(err, ErrChecksum):
+		status = statusChecksumError
+	case errors.Is(err, ErrInvalidShare):
+		status = http.StatusForbidden
+	case errors.Is(err, ErrShareExpired), errors.Is(err, ErrShareExhausted):
+		status = http.StatusGone
+	case errors.Is(err, ErrSharePassword):
+		w.Header().Set("WWW-Authenticate", shareRealm)
+		status = http.StatusUnauthorized
+	}
+	http.Error(w, fmt.Sprintf("%s 중 오류 발생: %v", action, err), status)
+	fmt.Printf("%s 오류: %v\n", action, err)
 }
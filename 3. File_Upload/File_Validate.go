@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// 업로드 검사 오류
+var (
+	ErrFileTooLarge   = errors.New("허용된 최대 크기를 넘는 파일입니다")
+	ErrTypeNotAllowed = errors.New("허용되지 않는 파일 형식입니다")
+	ErrFileRejected   = errors.New("검사에서 거부된 파일입니다")
+)
+
+// Upload는 저장소에 등록하기 직전의 업로드 하나입니다.
+// Path는 원래 내용 그대로(압축하기 전) 받아 둔 로컬 임시 파일입니다.
+type Upload struct {
+	Owner    string
+	Name     string
+	Size     int64
+	MIMEType string
+	SHA256   string
+	Path     string
+}
+
+// UploadHook은 업로드를 저장소에 등록하기 전에 검사합니다.
+// 오류를 반환하면 파일은 등록되지 않고 버려지며, 오류는 그대로 클라이언트에 전달됩니다.
+// 여러 요청에서 동시에 호출될 수 있습니다.
+type UploadHook interface {
+	Check(u Upload) error
+}
+
+// TypeFilter는 판별한 MIME 형식으로 업로드를 거릅니다.
+// 형식은 "image/png"처럼 정확히 쓰거나 "image/*"처럼 종류 전체를 쓸 수 있습니다.
+// 거부 목록이 먼저 적용되고, 허용 목록이 비어 있으면 거부되지 않은 형식은 모두 받습니다.
+type TypeFilter struct {
+	allow []string
+	deny  []string
+}
+
+// NewTypeFilter는 쉼표로 구분한 허용 목록과 거부 목록으로 필터를 만듭니다.
+func NewTypeFilter(allow, deny string) (*TypeFilter, error) {
+	f := &TypeFilter{}
+	var err error
+	if f.allow, err = parseTypeList(allow); err != nil {
+		return nil, err
+	}
+	if f.deny, err = parseTypeList(deny); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *TypeFilter) Check(u Upload) error {
+	mediaType, _, err := mime.ParseMediaType(u.MIMEType)
+	if err != nil {
+		mediaType = "application/octet-stream"
+	}
+	if matchType(f.deny, mediaType) || (len(f.allow) > 0 && !matchType(f.allow, mediaType)) {
+		return fmt.Errorf("%w: %s", ErrTypeNotAllowed, mediaType)
+	}
+	return nil
+}
+
+// parseTypeList는 "image/*, text/plain" 같은 목록을 읽습니다.
+func parseTypeList(list string) ([]string, error) {
+	var types []string
+	for _, t := range strings.Split(list, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" {
+			continue
+		}
+		major, minor, ok := strings.Cut(t, "/")
+		if !ok || major == "" || minor == "" || (major == "*" && minor != "*") {
+			return nil, fmt.Errorf("올바르지 않은 MIME 형식: %q", t)
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+// matchType은 mediaType이 patterns 중 하나에 해당하는지 확인합니다.
+func matchType(patterns []string, mediaType string) bool {
+	major, _, _ := strings.Cut(mediaType, "/")
+	for _, p := range patterns {
+		if p == mediaType || p == "*/*" || p == major+"/*" {
+			return true
+		}
+	}
+	return false
+}
+
+// CommandScanner는 외부 명령(바이러스 검사기 등)으로 업로드를 검사합니다.
+// 명령 끝에 검사할 파일 경로를 붙여 실행하며, clamscan과 같은 종료 코드를 따릅니다.
+//
+//	0     문제 없음
+//	1     거부 (출력의 첫 줄을 이유로 씀)
+//	그 외  검사 실패. 검사하지 못한 파일은 받지 않습니다.
+type CommandScanner struct {
+	args    []string
+	timeout time.Duration
+}
+
+// NewCommandScanner는 command("clamscan --no-summary"처럼 공백으로 구분)를 실행하는 검사기를 만듭니다.
+// timeout이 지나도 끝나지 않으면 명령을 멈추고 검사 실패로 봅니다.
+func NewCommandScanner(command string, timeout time.Duration) (*CommandScanner, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, errors.New("검사 명령이 비어 있습니다")
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return nil, fmt.Errorf("검사 명령을 찾을 수 없습니다: %w", err)
+	}
+	return &CommandScanner{args: args, timeout: timeout}, nil
+}
+
+func (c *CommandScanner) Check(u Upload) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, c.args[0], append(c.args[1:], u.Path)...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() != nil:
+		return fmt.Errorf("파일 검사 시간 초과 (%s)", c.timeout)
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		reason, _, _ := strings.Cut(strings.TrimSpace(out.String()), "\n")
+		// 검사기는 보통 임시 파일 경로를 함께 출력하므로 원래 이름으로 바꿔 보여 줌
+		reason = strings.ReplaceAll(reason, u.Path, u.Name)
+		fmt.Printf("검사기가 파일을 거부했습니다: %s (%s): %s\n", u.Name, u.Owner, reason)
+		return fmt.Errorf("%w: %s", ErrFileRejected, reason)
+	}
+	return fmt.Errorf("파일 검사 실패: %v: %s", err, strings.TrimSpace(out.String()))
+}
+
+// sizeLimitReader는 r에서 n바이트까지만 읽고, 그보다 많으면 ErrFileTooLarge를 반환합니다.
+// http.MaxBytesReader는 multipart 본문 전체의 크기를 제한하므로, 파일 하나의 크기는 이것으로 정확히 확인합니다.
+type sizeLimitReader struct {
+	r io.Reader
+	n int64 // 더 읽을 수 있는 크기
+}
+
+func (l *sizeLimitReader) Read(p []byte) (int, error) {
+	// 넘었는지 알 수 있도록 한도보다 1바이트까지 더 읽음
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, ErrFileTooLarge
+	}
+	return n, err
+}
+
+// normalizeName은 파일 이름을 저장할 형태로 맞춥니다.
+//   - 유니코드 NFC로 합쳐, macOS처럼 자모를 풀어 보내는 곳에서 온 이름도 같은 이름이 되게 함
+//   - 보이지 않는 서식 문자(방향 전환, 폭 없는 공백 등)를 지움. "photo\u202Egpj.exe"가
+//     "photoexe.jpg"로 보이는 것처럼 확장자를 속이는 데 쓰일 수 있기 때문. 이모지에 쓰이는
+//     결합 문자(ZWJ, ZWNJ)는 남김
+//   - 연속된 공백은 하나로 줄이고 앞뒤 공백과 끝의 점을 지움 (Windows에서 쓸 수 없는 이름)
+//
+// 제어 문자는 고치지 않고 남겨 sanitizeName에서 거부되게 합니다.
+func normalizeName(name string) string {
+	name = norm.NFC.String(name)
+
+	var b strings.Builder
+	space := false
+	for _, r := range name {
+		switch {
+		case unicode.Is(unicode.Cf, r) && r != '\u200c' && r != '\u200d':
+			continue
+		case unicode.Is(unicode.Zs, r):
+			space = true
+			continue
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	return strings.TrimRight(b.String(), ". ")
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// indexPage는 브라우저용 파일 관리 화면입니다.
+//
+//go:embed File_Web.html
+var indexPage []byte
+
+// 웹 화면 핸들러
+func handleIndex(w http.ResponseWriter, r *http.Request, user *User) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(indexPage)
+}
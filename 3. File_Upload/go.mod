@@ -0,0 +1,8 @@
+module File_Upload
+
+go 1.24
+
+require (
+	github.com/klauspost/compress v1.18.0
+	golang.org/x/text v0.25.0
+)
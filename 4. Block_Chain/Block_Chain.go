@@ -2,13 +2,16 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"html/template"
 	"io"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"os"
 	"strconv"
@@ -19,28 +22,38 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-// 블록 구조체 정의
+// 블록 헤더 정의. 거래 목록 대신 거래들의 머클 루트를 담으므로 블록 해시는 헤더만으로 계산됩니다.
+type BlockHeader struct {
+	Index      int    `json:"index"`       // 블록 번호
+	Timestamp  string `json:"timestamp"`   // 블록 생성 시간
+	MerkleRoot string `json:"merkle_root"` // 거래 목록의 머클 루트
+	PrevHash   string `json:"prev_hash"`   // 이전 블록의 해시
+	Hash       string `json:"hash"`        // 현재 블록의 해시
+	Nonce      int    `json:"nonce"`       // 작업 증명에 사용된 논스
+	Difficulty int    `json:"difficulty"`  // 작업 증명의 난이도 (해시 앞에 0인 비트 수)
+}
+
+// 블록 구조체 정의. JSON에서는 헤더 필드와 거래 목록이 한 객체에 나란히 들어갑니다.
 type Block struct {
-	Index        int           `json:"index"`        // 블록 번호
-	Timestamp    string        `json:"timestamp"`    // 블록 생성 시간
+	BlockHeader
 	Transactions []Transaction `json:"transactions"` // 거래 목록
-	PrevHash     string        `json:"prev_hash"`    // 이전 블록의 해시
-	Hash         string        `json:"hash"`         // 현재 블록의 해시
-	Nonce        int           `json:"nonce"`        // 작업 증명에 사용된 논스
 }
 
-// 거래 구조체 정의
+// 거래 구조체 정의. 보내는 쪽이 개인 키로 서명하며, 채굴 보상 거래만 보내는 쪽과 서명이 없습니다.
 type Transaction struct {
-	Sender    string `json:"sender"`
-	Recipient string `json:"recipient"`
-	Amount    int    `json:"amount"`
+	Sender    string `json:"sender"`               // 보내는 주소
+	Recipient string `json:"recipient"`            // 받는 주소
+	Amount    int    `json:"amount"`               // 금액
+	Nonce     uint64 `json:"nonce"`                // 보내는 주소의 거래 순번 (0부터, 채굴 보상은 블록 번호)
+	PublicKey string `json:"public_key,omitempty"` // 보내는 쪽의 ed25519 공개 키 (16진수)
+	Signature string `json:"signature,omitempty"`  // 서명 (16진수)
 }
 
 // 블록체인 정의 (전역 변수)
 var Blockchain []Block
-var mutex = &sync.Mutex{} // 동시성 제어를 위한 뮤텍스
-
-const difficulty = 4 // 작업 증명의 난이도 (해시 앞에 0의 개수)
+var chainState = NewState()               // Blockchain을 모두 적용한 잔액과 순번
+var txIndex = make(map[string]txLocation) // 거래 ID -> Blockchain 안의 위치
+var mutex = &sync.Mutex{}                 // 동시성 제어를 위한 뮤텍스
 
 // P2P 네트워킹을 위한 피어 목록
 var peers []string
@@ -55,86 +68,193 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-// 해시 계산 함수
-func calculateHash(block Block) string {
-	record := fmt.Sprintf("%d%s%v%s%d", block.Index, block.Timestamp, block.Transactions, block.PrevHash, block.Nonce)
-	hash := sha256.Sum256([]byte(record))
+// 해시 계산 함수. 헤더를 정규 이진 형식으로 인코딩해 해시하며, 거래는 머클 루트로만 들어갑니다.
+func calculateHash(header BlockHeader) string {
+	hash := sha256.Sum256(encodeHeader(header))
 	return hex.EncodeToString(hash[:])
 }
 
-// 작업 증명 함수 (Proof-of-Work)
-func proofOfWork(block Block) Block {
-	for {
-		hash := calculateHash(block)
-		if strings.HasPrefix(hash, strings.Repeat("0", difficulty)) {
-			block.Hash = hash
-			return block
-		}
-		block.Nonce++
+// 새로운 블록 생성 함수. 작업 증명은 채굴기가 합니다.
+func generateBlock(prevBlock Block, transactions []Transaction, difficulty int) Block {
+	// 시각이 이전 블록보다 앞서지 않도록 함 (피어의 시계가 빠를 수 있음)
+	timestamp := time.Now()
+	if prevTime, err := time.Parse(time.RFC3339, prevBlock.Timestamp); err == nil && timestamp.Before(prevTime) {
+		timestamp = prevTime
+	}
+	return Block{
+		BlockHeader: BlockHeader{
+			Index:      prevBlock.Index + 1,
+			Timestamp:  timestamp.Format(time.RFC3339),
+			MerkleRoot: merkleRoot(transactions),
+			PrevHash:   prevBlock.Hash,
+			Nonce:      0,
+			Hash:       "",
+			Difficulty: difficulty,
+		},
+		Transactions: transactions,
 	}
 }
 
-// 새로운 블록 생성 함수
-func generateBlock(prevBlock Block, transactions []Transaction) Block {
-	newBlock := Block{
-		Index:        prevBlock.Index + 1,
-		Timestamp:    time.Now().Format(time.RFC3339),
-		Transactions: transactions,
-		PrevHash:     prevBlock.Hash,
-		Nonce:        0,
-		Hash:         "",
+// 헤더 유효성 검사 함수. chain은 header 바로 앞 블록까지의 체인이며, 헤더만 있어도 됩니다.
+// 난이도는 체인에서 계산한 값과 같아야 하므로 블록을 만든 쪽이 마음대로 낮출 수 없고,
+// 난이도 조정에 쓰는 시각도 앞 블록보다 앞서거나 현재보다 너무 늦을 수 없습니다.
+func isHeaderValid(header BlockHeader, chain []Block) bool {
+	prevBlock := chain[len(chain)-1]
+	if prevBlock.Index+1 != header.Index {
+		return false
+	}
+	if prevBlock.Hash != header.PrevHash {
+		return false
+	}
+	if header.Difficulty != nextDifficulty(chain) {
+		return false
+	}
+	newTime, err := time.Parse(time.RFC3339, header.Timestamp)
+	if err != nil || newTime.After(time.Now().Add(maxFutureDrift)) {
+		return false
+	}
+	if prevTime, err := time.Parse(time.RFC3339, prevBlock.Timestamp); err != nil || newTime.Before(prevTime) {
+		return false
+	}
+	if calculateHash(header) != header.Hash {
+		return false
 	}
-	newBlock = proofOfWork(newBlock)
-	return newBlock
+	return hashMeetsDifficulty(header.Hash, header.Difficulty)
 }
 
-// 블록 유효성 검사 함수
-func isBlockValid(newBlock, prevBlock Block) bool {
-	if prevBlock.Index+1 != newBlock.Index {
+// 블록 유효성 검사 함수. chain은 newBlock 바로 앞 블록까지의 체인입니다.
+// 헤더를 검사하고 머클 루트가 거래 목록과 맞는지 확인합니다.
+// 거래의 서명, 순번, 잔액은 블록을 상태에 적용할 때 State.ApplyBlock이 검사합니다.
+func isBlockValid(newBlock Block, chain []Block) bool {
+	if !isHeaderValid(newBlock.BlockHeader, chain) {
 		return false
 	}
-	if prevBlock.Hash != newBlock.PrevHash {
+	if merkleRoot(newBlock.Transactions) != newBlock.MerkleRoot {
 		return false
 	}
-	if calculateHash(newBlock) != newBlock.Hash {
-		return false
+	size := 0
+	seen := make(map[string]bool)
+	for _, tx := range newBlock.Transactions {
+		if !validTransaction(tx) || seen[txID(tx)] {
+			return false
+		}
+		seen[txID(tx)] = true
+		size += txSize(tx)
 	}
-	if !strings.HasPrefix(newBlock.Hash, strings.Repeat("0", difficulty)) {
+	return size <= maxBlockSize
+}
+
+// isGenesisHeaderValid는 제네시스 블록의 헤더가 올바른지 검사합니다.
+func isGenesisHeaderValid(header BlockHeader) bool {
+	if _, err := time.Parse(time.RFC3339, header.Timestamp); err != nil {
 		return false
 	}
-	return true
+	return header.Index == 0 && header.PrevHash == "" && header.Difficulty == initialDifficulty &&
+		calculateHash(header) == header.Hash && hashMeetsDifficulty(header.Hash, header.Difficulty)
+}
+
+// isGenesisValid는 제네시스 블록이 올바른지 검사합니다.
+func isGenesisValid(genesis Block) bool {
+	return isGenesisHeaderValid(genesis.BlockHeader) && merkleRoot(genesis.Transactions) == genesis.MerkleRoot
+}
+
+// chainWork는 체인을 만드는 데 든 작업량입니다. 난이도가 1비트 오를 때마다 두 배가 됩니다.
+// 체인이 갈라지면 블록 수가 아니라 작업량이 더 많은 쪽을 따릅니다.
+func chainWork(chain []Block) float64 {
+	work := 0.0
+	for _, block := range chain {
+		work += math.Exp2(float64(block.Difficulty))
+	}
+	return work
+}
+
+// txLocation은 블록에 담긴 거래의 위치입니다.
+type txLocation struct {
+	Height int // 블록 번호
+	Index  int // 블록 안의 거래 순서
+}
+
+// indexBlocks는 blocks의 거래를 txIndex에 넣습니다. mutex를 잡은 상태에서 호출합니다.
+func indexBlocks(blocks []Block) {
+	for _, block := range blocks {
+		for i, tx := range block.Transactions {
+			txIndex[txID(tx)] = txLocation{Height: block.Index, Index: i}
+		}
+	}
+}
+
+// reindexTransactions는 체인이 oldChain에서 newChain으로 바뀔 때 갈라진 지점 뒤의 블록만
+// txIndex에서 바꿉니다. mutex를 잡은 상태에서 호출합니다.
+func reindexTransactions(oldChain, newChain []Block) {
+	fork := forkPoint(oldChain, newChain)
+	for _, block := range oldChain[fork:] {
+		for _, tx := range block.Transactions {
+			delete(txIndex, txID(tx))
+		}
+	}
+	indexBlocks(newChain[fork:])
+}
+
+// findTransaction은 체인에서 id의 거래를 찾아 담긴 블록과 위치를 반환합니다. mutex를 잡은 상태에서 호출합니다.
+func findTransaction(id string) (Block, int, bool) {
+	loc, ok := txIndex[id]
+	if !ok {
+		return Block{}, 0, false
+	}
+	return Blockchain[loc.Height], loc.Index, true
+}
+
+// forkPoint는 두 체인이 처음으로 달라지는 블록 번호입니다.
+func forkPoint(oldChain, newChain []Block) int {
+	fork := 0
+	for fork < len(oldChain) && fork < len(newChain) && oldChain[fork].Hash == newChain[fork].Hash {
+		fork++
+	}
+	return fork
 }
 
-// 블록체인에 새로운 블록 추가
+// 블록체인에 새로운 블록 추가. 직접 채굴했든 피어에게서 받았든 체인 끝에 이어지는 블록이면
+// 추가하고, 피어에게 전파한 뒤 채굴기를 새 블록 위에서 다시 시작시킵니다.
 func addBlock(newBlock Block) bool {
 	mutex.Lock()
 	defer mutex.Unlock()
 
-	if isBlockValid(newBlock, Blockchain[len(Blockchain)-1]) {
-		Blockchain = append(Blockchain, newBlock)
-		fmt.Println("블록이 추가되었습니다:", newBlock)
-		// 피어에게 블록 전파
-		broadcastBlock(newBlock)
-		// 웹소켓을 통해 클라이언트에 알림
-		notifyConnections(fmt.Sprintf("새 블록이 추가되었습니다: Index %d", newBlock.Index))
-		saveBlockchain()
-		return true
+	if !isBlockValid(newBlock, Blockchain) {
+		fmt.Println("블록 추가 실패: 유효하지 않은 블록입니다.")
+		return false
 	}
-	fmt.Println("블록 추가 실패: 유효하지 않은 블록입니다.")
-	return false
+	if err := chainState.ApplyBlock(newBlock); err != nil {
+		fmt.Printf("블록 추가 실패: 블록 %d의 거래가 유효하지 않습니다: %v\n", newBlock.Index, err)
+		return false
+	}
+	Blockchain = append(Blockchain, newBlock)
+	indexBlocks(Blockchain[len(Blockchain)-1:])
+	fmt.Printf("블록이 추가되었습니다: Index %d, 난이도 %d, Hash %s\n", newBlock.Index, newBlock.Difficulty, newBlock.Hash)
+	// 피어에게 블록 전파
+	broadcastBlock(newBlock)
+	// 웹소켓을 통해 클라이언트에 알림
+	notifyConnections(fmt.Sprintf("새 블록이 추가되었습니다: Index %d", newBlock.Index))
+	saveBlockchain()
+	mempool.Prune(chainState)
+	miner.Restart()
+	return true
 }
 
 // 제네시스 블록 생성 함수
 func createGenesisBlock() Block {
 	genesisBlock := Block{
-		Index:        0,
-		Timestamp:    time.Now().Format(time.RFC3339),
+		BlockHeader: BlockHeader{
+			Index:      0,
+			Timestamp:  time.Now().Format(time.RFC3339),
+			MerkleRoot: merkleRoot(nil),
+			PrevHash:   "",
+			Nonce:      0,
+			Hash:       "",
+			Difficulty: initialDifficulty,
+		},
 		Transactions: []Transaction{},
-		PrevHash:     "",
-		Nonce:        0,
-		Hash:         "",
 	}
-	genesisBlock = proofOfWork(genesisBlock)
+	genesisBlock, _ = proofOfWork(context.Background(), genesisBlock)
 	return genesisBlock
 }
 
@@ -145,8 +265,8 @@ func printBlockchain() {
 
 	fmt.Println("\n현재 블록체인:")
 	for _, block := range Blockchain {
-		fmt.Printf("Index: %d, Timestamp: %s, Transactions: %v, Hash: %s, PrevHash: %s, Nonce: %d\n",
-			block.Index, block.Timestamp, block.Transactions, block.Hash, block.PrevHash, block.Nonce)
+		fmt.Printf("Index: %d, Timestamp: %s, Transactions: %v, Hash: %s, PrevHash: %s, Nonce: %d, Difficulty: %d\n",
+			block.Index, block.Timestamp, block.Transactions, block.Hash, block.PrevHash, block.Nonce, block.Difficulty)
 	}
 	fmt.Println()
 }
@@ -167,6 +287,19 @@ func getBlockchain(w http.ResponseWriter, r *http.Request) {
 	w.Write(bytes)
 }
 
+// 블록 헤더 전체 조회. 라이트 클라이언트가 거래 없이 체인을 검사하고 머클 증명을 확인할 때 씁니다.
+func getHeaders(w http.ResponseWriter, r *http.Request) {
+	mutex.Lock()
+	headers := make([]BlockHeader, len(Blockchain))
+	for i, block := range Blockchain {
+		headers[i] = block.BlockHeader
+	}
+	mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(headers)
+}
+
 // 특정 블록 조회
 func getBlock(w http.ResponseWriter, r *http.Request) {
 	indexStr := strings.TrimPrefix(r.URL.Path, "/blocks/")
@@ -193,7 +326,8 @@ func getBlock(w http.ResponseWriter, r *http.Request) {
 	w.Write(bytes)
 }
 
-// 새로운 블록 추가 (거래 포함)
+// 서명된 거래 여러 개를 한 번에 추가. 예전 API를 위해 남겨 두며, 거래는 /transactions와
+// 같이 대기열에 들어가 채굴기가 블록에 담습니다.
 func createBlock(w http.ResponseWriter, r *http.Request) {
 	var data struct {
 		Transactions []Transaction `json:"transactions"`
@@ -205,19 +339,80 @@ func createBlock(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ids := []string{}
+	for _, tx := range data.Transactions {
+		if err := submitTransaction(tx); err != nil && err != ErrDuplicate {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ids = append(ids, txID(tx))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string][]string{"ids": ids})
+}
+
+// 피어가 채굴한 블록 받기. 체인 끝에 바로 이어지면 추가하고, 이어지지 않으면
+// 피어 쪽 체인이 더 길 수 있으므로 동기화합니다.
+func receiveBlock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST 요청만 가능합니다.", http.StatusMethodNotAllowed)
+		return
+	}
+	var block Block
+	if err := json.NewDecoder(r.Body).Decode(&block); err != nil {
+		http.Error(w, "유효한 블록 데이터가 필요합니다", http.StatusBadRequest)
+		return
+	}
+
 	mutex.Lock()
-	prevBlock := Blockchain[len(Blockchain)-1]
+	tip := Blockchain[len(Blockchain)-1]
 	mutex.Unlock()
 
-	newBlock := generateBlock(prevBlock, data.Transactions)
-	success := addBlock(newBlock)
-
-	if success {
+	switch {
+	case block.Index <= tip.Index:
+		// 이미 가진 블록이거나 더 짧은 갈래의 블록
+		w.WriteHeader(http.StatusOK)
+	case block.Index == tip.Index+1 && block.PrevHash == tip.Hash:
+		if !addBlock(block) {
+			http.Error(w, "유효하지 않은 블록입니다", http.StatusBadRequest)
+			return
+		}
 		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(newBlock)
-	} else {
-		http.Error(w, "블록 추가 실패", http.StatusInternalServerError)
+	default:
+		// 동기화는 피어마다 체인 전체를 받아 오므로, 작업 증명이 맞는 블록일 때만 시작함.
+		// 갈래가 달라도 난이도가 크게 차이 나지는 않으므로 너무 쉬운 블록도 거름.
+		if calculateHash(block.BlockHeader) != block.Hash || !hashMeetsDifficulty(block.Hash, block.Difficulty) ||
+			block.Difficulty < tip.Difficulty-maxRetargetStep {
+			http.Error(w, "작업 증명이 올바르지 않은 블록입니다", http.StatusBadRequest)
+			return
+		}
+		if requestSync() {
+			fmt.Printf("이어지지 않는 블록 %d을(를) 받아 피어와 동기화합니다.\n", block.Index)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// 동기화 요청 간격 제한
+const minSyncInterval = 10 * time.Second
+
+var (
+	syncMutex = &sync.Mutex{}
+	lastSync  time.Time
+)
+
+// requestSync는 마지막 동기화 뒤 minSyncInterval이 지났으면 백그라운드에서 동기화를 시작합니다.
+// 이어지지 않는 블록이 연달아 와도 피어에게서 체인을 한 번만 받아 오게 합니다.
+func requestSync() bool {
+	syncMutex.Lock()
+	defer syncMutex.Unlock()
+	if time.Since(lastSync) < minSyncInterval {
+		return false
 	}
+	lastSync = time.Now()
+	go syncBlockchain()
+	return true
 }
 
 // 피어 목록 저장을 위한 슬라이스 및 뮤텍스
@@ -286,29 +481,15 @@ func serveHome(w http.ResponseWriter, r *http.Request) {
 	tmpl.Execute(w, Blockchain)
 }
 
-// 블록체인 무결성 검사 함수
+// 블록체인 무결성 검사 함수. 체인 전체의 서명을 다시 확인하므로 mutex를 잡고 있지 않습니다.
+// 블록은 추가되기만 하고 바뀌지 않으며 동기화는 슬라이스를 통째로 바꾸므로, 잡아 둔 슬라이스는
+// 검사하는 동안 그대로입니다.
 func isBlockchainValid() bool {
 	mutex.Lock()
-	defer mutex.Unlock()
-
-	for i := 1; i < len(Blockchain); i++ {
-		currentBlock := Blockchain[i]
-		prevBlock := Blockchain[i-1]
+	chain := Blockchain
+	mutex.Unlock()
 
-		if currentBlock.Index != prevBlock.Index+1 {
-			return false
-		}
-		if currentBlock.PrevHash != prevBlock.Hash {
-			return false
-		}
-		if calculateHash(currentBlock) != currentBlock.Hash {
-			return false
-		}
-		if !strings.HasPrefix(currentBlock.Hash, strings.Repeat("0", difficulty)) {
-			return false
-		}
-	}
-	return true
+	return isBlockchainValidChain(chain)
 }
 
 // 무결성 검사 및 동기화 모니터링
@@ -324,11 +505,8 @@ func monitorBlockchain() {
 	}
 }
 
-// 블록체인 저장 함수
+// 블록체인 저장 함수. mutex를 잡은 상태에서 호출합니다.
 func saveBlockchain() {
-	mutex.Lock()
-	defer mutex.Unlock()
-
 	data, err := json.MarshalIndent(Blockchain, "", "  ")
 	if err != nil {
 		fmt.Println("블록체인 저장 중 오류 발생:", err)
@@ -353,8 +531,19 @@ func loadBlockchain() {
 			fmt.Println("블록체인 데이터 파싱 오류:", err)
 			return
 		}
+		if len(loadedBlockchain) == 0 {
+			return
+		}
+		// 서명이 없던 예전 형식이거나 손상된 파일은 덮어쓰지 않고 멈춤
+		state, err := buildState(loadedBlockchain)
+		if err != nil {
+			fmt.Printf("blockchain.json이 유효하지 않거나 예전 형식입니다 (%v). 파일을 옮기거나 지운 뒤 다시 시작하세요.\n", err)
+			os.Exit(1)
+		}
 		mutex.Lock()
 		Blockchain = loadedBlockchain
+		chainState = state
+		indexBlocks(Blockchain)
 		mutex.Unlock()
 		fmt.Println("블록체인이 로드되었습니다.")
 	}
@@ -376,11 +565,8 @@ func loadPeers() {
 	}
 }
 
-// 피어 목록 저장 함수
+// 피어 목록 저장 함수. peersMutex를 잡은 상태에서 호출합니다.
 func savePeers() {
-	peersMutex.Lock()
-	defer peersMutex.Unlock()
-
 	data, err := json.MarshalIndent(peers, "", "  ")
 	if err != nil {
 		fmt.Println("피어 저장 중 오류 발생:", err)
@@ -422,27 +608,49 @@ func removePeer(peer string) {
 	fmt.Println("피어가 제거되었습니다:", peer)
 }
 
-// 피어 간 블록체인 동기화
+// 피어 간 블록체인 동기화. 작업량이 더 많은 체인을 따릅니다.
 func syncBlockchain() {
-	for _, peer := range peers {
+	peersMutex.Lock()
+	peerList := append([]string{}, peers...)
+	peersMutex.Unlock()
+
+	for _, peer := range peerList {
 		resp, err := http.Get(peer + "/blocks")
 		if err != nil {
 			fmt.Println("블록체인 동기화 실패:", err)
 			continue
 		}
-		defer resp.Body.Close()
 
 		var peerBlockchain []Block
-		if err := json.NewDecoder(resp.Body).Decode(&peerBlockchain); err != nil {
+		err = json.NewDecoder(resp.Body).Decode(&peerBlockchain)
+		resp.Body.Close()
+		if err != nil {
 			fmt.Println("피어 블록체인 데이터 파싱 실패:", err)
 			continue
 		}
 
 		mutex.Lock()
-		if len(peerBlockchain) > len(Blockchain) && isBlockchainValidChain(peerBlockchain) {
+		heavier := chainWork(peerBlockchain) > chainWork(Blockchain)
+		mutex.Unlock()
+		if !heavier {
+			continue
+		}
+
+		// 검사는 오래 걸리므로 mutex 없이 하고, 바꾸기 직전에 작업량을 다시 비교합니다.
+		state, err := buildState(peerBlockchain)
+		if err != nil {
+			fmt.Printf("피어 블록체인이 유효하지 않습니다 (%s): %v\n", peer, err)
+			continue
+		}
+		mutex.Lock()
+		if chainWork(peerBlockchain) > chainWork(Blockchain) {
+			reorganize(Blockchain, peerBlockchain, state)
+			reindexTransactions(Blockchain, peerBlockchain)
 			Blockchain = peerBlockchain
-			fmt.Println("블록체인이 동기화되었습니다. 새로운 체인:", Blockchain)
+			chainState = state
+			fmt.Printf("블록체인이 동기화되었습니다. 블록 %d개 (%s)\n", len(Blockchain), peer)
 			saveBlockchain()
+			miner.Restart()
 		}
 		mutex.Unlock()
 	}
@@ -450,29 +658,23 @@ func syncBlockchain() {
 
 // 피어 블록체인이 유효한지 검사
 func isBlockchainValidChain(chain []Block) bool {
-	for i := 1; i < len(chain); i++ {
-		if !isBlockValid(chain[i], chain[i-1]) {
-			return false
-		}
-	}
-	return true
+	_, err := buildState(chain)
+	return err == nil
 }
 
-// 피어에게 블록 전파
+// 피어에게 블록 전파. 받은 피어는 새 블록이면 다시 자기 피어에게 전파합니다.
 func broadcastBlock(block Block) {
+	jsonData, err := json.Marshal(block)
+	if err != nil {
+		fmt.Println("블록 전파 중 JSON 마샬링 오류:", err)
+		return
+	}
+
+	peersMutex.Lock()
+	defer peersMutex.Unlock()
 	for _, peer := range peers {
 		go func(peer string) {
-			url := peer + "/blocks/create"
-
-			// 요청 바디를 구조체로 정의하여 JSON으로 마샬링
-			payload := map[string][]Transaction{
-				"transactions": block.Transactions,
-			}
-			jsonData, err := json.Marshal(payload)
-			if err != nil {
-				fmt.Println("블록 전파 중 JSON 마샬링 오류:", err)
-				return
-			}
+			url := peer + "/blocks/receive"
 
 			resp, err := http.Post(url, "application/json", bytes.NewReader(jsonData)) // jsonData 사용
 			if err != nil {
@@ -481,7 +683,7 @@ func broadcastBlock(block Block) {
 			}
 			defer resp.Body.Close()
 
-			if resp.StatusCode != http.StatusCreated {
+			if resp.StatusCode >= http.StatusBadRequest {
 				body, _ := io.ReadAll(resp.Body)
 				fmt.Printf("블록 전파 실패: %s\n", string(body))
 			}
@@ -490,6 +692,25 @@ func broadcastBlock(block Block) {
 }
 
 func main() {
+	addr := flag.String("addr", ":8080", "요청을 받을 주소")
+	mine := flag.Bool("mine", true, "백그라운드에서 블록을 채굴할지 여부")
+	rewardAddress := flag.String("reward-address", "", "채굴 보상을 받을 주소 (비워 두면 보상 거래를 넣지 않음)")
+	flag.Parse()
+
+	// 지갑 명령: go run . wallet new | address | balance | sign | send
+	if flag.Arg(0) == "wallet" {
+		if err := runWalletCommand(flag.Args()[1:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *rewardAddress != "" && !validAddress(*rewardAddress) {
+		fmt.Println("잘못된 채굴 보상 주소:", *rewardAddress)
+		os.Exit(1)
+	}
+	miner.Address = *rewardAddress
+
 	// 블록체인 로드
 	loadBlockchain()
 
@@ -499,10 +720,11 @@ func main() {
 	// 블록체인에 제네시스 블록이 없다면 생성
 	if len(Blockchain) == 0 {
 		genesisBlock := createGenesisBlock()
+		mutex.Lock()
 		Blockchain = append(Blockchain, genesisBlock)
-		fmt.Println("제네시스 블록이 생성되었습니다.")
-		printBlockchain()
 		saveBlockchain()
+		mutex.Unlock()
+		fmt.Println("제네시스 블록이 생성되었습니다.")
 	}
 
 	// 블록체인 출력 (콘솔용)
@@ -511,11 +733,21 @@ func main() {
 	// 무결성 검사 고루틴 시작
 	go monitorBlockchain()
 
+	// 채굴 시작
+	if *mine {
+		go miner.Run()
+	}
+
 	// REST API 라우팅 설정
 	http.HandleFunc("/", serveHome)
 	http.HandleFunc("/blocks", getBlockchain)
 	http.HandleFunc("/blocks/", getBlock)
 	http.HandleFunc("/blocks/create", createBlock)
+	http.HandleFunc("/blocks/receive", receiveBlock)
+	http.HandleFunc("/transactions", handleTransactions)
+	http.HandleFunc("/accounts/", handleAccount)
+	http.HandleFunc("/headers", getHeaders)
+	http.HandleFunc("/proofs/", handleProof)
 	http.HandleFunc("/ws", handleWebSocketConnection)
 
 	// 피어 추가 엔드포인트 (간단한 예)
@@ -533,7 +765,7 @@ func main() {
 		}
 		addPeer(peer.Peer)
 		// 피어에게 블록체인 요청
-		go syncBlockchain()
+		requestSync()
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("피어 추가 성공"))
 	})
@@ -542,8 +774,8 @@ func main() {
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
 
 	// 서버 시작
-	fmt.Println("블록체인 서버가 시작되었습니다. http://localhost:8080")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
+	fmt.Printf("블록체인 서버가 시작되었습니다. http://localhost%s\n", *addr)
+	if err := http.ListenAndServe(*addr, nil); err != nil {
 		fmt.Println("서버 시작 실패:", err)
 	}
 }
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	maxBlockSize   = 64 << 10  // 블록 하나에 담을 수 있는 거래의 최대 크기 (인코딩한 바이트)
+	maxMempoolSize = 10000     // 대기할 수 있는 거래의 최대 수
+	maxNonceGap    = 16        // 체인에 반영된 순번보다 앞서 받아 둘 수 있는 순번의 수
+	mempoolExpiry  = time.Hour // 블록에 담기지 못한 거래를 대기열에서 빼기까지의 시간
+)
+
+// 거래 접수 오류
+var (
+	ErrInvalidTransaction = errors.New("유효하지 않은 거래입니다")
+	ErrDuplicate          = errors.New("이미 받은 거래입니다")
+	ErrMempoolFull        = errors.New("대기 중인 거래가 너무 많습니다")
+	ErrNonceTooFar        = errors.New("거래 순번(nonce)이 체인보다 너무 앞서 있습니다")
+)
+
+// txID는 거래의 ID로, 서명한 내용의 해시입니다. 보내는 주소와 순번이 같으면
+// 같은 자리를 두고 다투는 거래이므로 둘 중 하나만 체인에 들어갈 수 있습니다.
+func txID(tx Transaction) string {
+	hash := sha256.Sum256(signingBytes(tx))
+	return hex.EncodeToString(hash[:])
+}
+
+// txSize는 블록 크기를 셀 때 쓰는 거래 하나의 크기입니다.
+func txSize(tx Transaction) int {
+	return len(encodeTransaction(tx))
+}
+
+// validTransaction은 거래의 형식을 검사합니다. 서명과 잔액은 State가 검사합니다.
+func validTransaction(tx Transaction) bool {
+	if tx.Amount <= 0 || !validAddress(tx.Recipient) {
+		return false
+	}
+	return isCoinbase(tx) || validAddress(tx.Sender)
+}
+
+// nonceKey는 보내는 주소와 순번으로 대기열 안의 자리를 나타냅니다.
+func nonceKey(sender string, nonce uint64) string {
+	return fmt.Sprintf("%s/%d", sender, nonce)
+}
+
+// mempoolEntry는 대기 중인 거래 하나입니다. 서명은 받을 때 한 번만 확인하고,
+// 블록에 담을 거래를 고를 때마다 다시 계산하지 않도록 크기도 기억해 둡니다.
+type mempoolEntry struct {
+	tx    Transaction
+	size  int
+	added time.Time
+}
+
+// Mempool은 아직 블록에 담기지 않은 거래를 받은 순서대로 보관합니다.
+// 보내는 주소와 순번이 같은 거래는 하나만 받으므로 대기열 안에서 이중 지불이 생기지 않습니다.
+// 보내는 주소마다 대기 중인 금액의 합이 잔액을 넘지 않고 순번이 체인보다 maxNonceGap 넘게 앞서지
+// 않아야 하므로, 잔액이 없는 주소는 대기열을 채울 수 없습니다.
+type Mempool struct {
+	mu      sync.Mutex
+	txs     map[string]*mempoolEntry // 거래 ID -> 거래
+	order   []string                 // 받은 순서
+	byNonce map[string]string        // nonceKey -> 거래 ID
+	pending map[string]int           // 보내는 주소 -> 대기 중인 금액의 합
+}
+
+var mempool = &Mempool{
+	txs:     make(map[string]*mempoolEntry),
+	byNonce: make(map[string]string),
+	pending: make(map[string]int),
+}
+
+// Add는 서명된 거래를 대기열에 넣습니다. 이미 대기 중이거나 체인에 담긴 거래면 ErrDuplicate를,
+// 같은 순번을 다른 거래가 이미 썼으면 ErrBadNonce를 반환합니다.
+// 앞 순번의 거래를 기다리는 거래도 maxNonceGap 안이면 받아 두지만, 대기 중인 거래와 합쳐
+// 잔액을 넘는 거래는 받지 않습니다. 대기 중인 다른 거래로 받을 금액은 잔액에 치지 않습니다.
+func (p *Mempool) Add(tx Transaction) error {
+	if !validTransaction(tx) || isCoinbase(tx) {
+		return ErrInvalidTransaction
+	}
+	if !verifyTransaction(tx) {
+		return ErrBadSignature
+	}
+	id := txID(tx)
+
+	mutex.Lock()
+	nonce, balance := chainState.Nonces[tx.Sender], chainState.Balances[tx.Sender]
+	confirmed := false
+	if tx.Nonce < nonce {
+		_, _, confirmed = findTransaction(id)
+	}
+	mutex.Unlock()
+	switch {
+	case confirmed:
+		return ErrDuplicate
+	case tx.Nonce < nonce:
+		return ErrBadNonce
+	case tx.Nonce-nonce >= maxNonceGap:
+		return ErrNonceTooFar
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.txs[id]; ok {
+		return ErrDuplicate
+	}
+	key := nonceKey(tx.Sender, tx.Nonce)
+	if _, ok := p.byNonce[key]; ok {
+		return ErrBadNonce
+	}
+	if tx.Amount > balance-p.pending[tx.Sender] {
+		return ErrOverdraft
+	}
+	if len(p.txs) >= maxMempoolSize {
+		p.expire(time.Now())
+		if len(p.txs) >= maxMempoolSize {
+			return ErrMempoolFull
+		}
+	}
+	p.txs[id] = &mempoolEntry{tx: tx, size: txSize(tx), added: time.Now()}
+	p.order = append(p.order, id)
+	p.byNonce[key] = id
+	p.pending[tx.Sender] += tx.Amount
+	return nil
+}
+
+// Select는 state 위에 차례로 적용할 수 있는 거래를 받은 순서대로 maxSize 바이트까지 골라 반환합니다.
+// 순번이 앞선 거래가 나중에 도착했을 수 있으므로 더 고를 거래가 없을 때까지 여러 번 훑습니다.
+// 대기열의 거래는 받을 때 서명을 확인했으므로 다시 확인하지 않습니다. 대기열에서 빼지는 않습니다.
+func (p *Mempool) Select(state *State, maxSize int) []Transaction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	state = state.Clone()
+	selected := []Transaction{}
+	taken := make(map[string]bool)
+	size := 0
+	for progress := true; progress; {
+		progress = false
+		for _, id := range p.order {
+			entry := p.txs[id]
+			if taken[id] || size+entry.size > maxSize || state.applyVerified(entry.tx) != nil {
+				continue
+			}
+			taken[id] = true
+			size += entry.size
+			selected = append(selected, entry.tx)
+			progress = true
+		}
+	}
+	return selected
+}
+
+// Prune은 state에 비추어 더는 블록에 담을 수 없는 거래를 대기열에서 뺍니다. 이미 쓴 순번의 거래
+// (블록에 담긴 거래와 같은 순번을 두고 다투다 밀려난 거래), 순번이 너무 앞선 거래, 순번 순서로
+// 더했을 때 잔액을 넘는 거래, mempoolExpiry보다 오래 기다린 거래가 빠집니다.
+func (p *Mempool) Prune(state *State) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	bySender := make(map[string][]string)
+	for _, id := range p.order {
+		sender := p.txs[id].tx.Sender
+		bySender[sender] = append(bySender[sender], id)
+	}
+	now := time.Now()
+	for sender, ids := range bySender {
+		sort.Slice(ids, func(i, j int) bool { return p.txs[ids[i]].tx.Nonce < p.txs[ids[j]].tx.Nonce })
+		nonce, balance := state.Nonces[sender], state.Balances[sender]
+		total := 0
+		for _, id := range ids {
+			entry := p.txs[id]
+			if entry.tx.Nonce < nonce || entry.tx.Nonce-nonce >= maxNonceGap ||
+				entry.tx.Amount > balance-total || now.Sub(entry.added) > mempoolExpiry {
+				p.remove(id)
+				continue
+			}
+			total += entry.tx.Amount
+		}
+	}
+	p.compact()
+}
+
+// expire는 mempoolExpiry보다 오래 기다린 거래를 뺍니다. p.mu를 잡은 상태에서 호출합니다.
+func (p *Mempool) expire(now time.Time) {
+	for _, id := range p.order {
+		if now.Sub(p.txs[id].added) > mempoolExpiry {
+			p.remove(id)
+		}
+	}
+	p.compact()
+}
+
+// remove는 id의 거래를 뺍니다. order는 compact가 정리합니다. p.mu를 잡은 상태에서 호출합니다.
+func (p *Mempool) remove(id string) {
+	entry, ok := p.txs[id]
+	if !ok {
+		return
+	}
+	delete(p.txs, id)
+	delete(p.byNonce, nonceKey(entry.tx.Sender, entry.tx.Nonce))
+	p.pending[entry.tx.Sender] -= entry.tx.Amount
+	if p.pending[entry.tx.Sender] <= 0 {
+		delete(p.pending, entry.tx.Sender)
+	}
+}
+
+// compact는 order에서 빠진 거래를 지웁니다. p.mu를 잡은 상태에서 호출합니다.
+func (p *Mempool) compact() {
+	order := p.order[:0]
+	for _, id := range p.order {
+		if _, ok := p.txs[id]; ok {
+			order = append(order, id)
+		}
+	}
+	p.order = order
+}
+
+// Requeue는 버려진 블록의 거래를 다시 대기열 앞쪽에 넣습니다. 원래 먼저 받은 거래이기 때문입니다.
+// 같은 순번의 거래가 이미 대기 중이면 그 거래를 남깁니다. 블록에 담겼던 거래이므로 서명은
+// 다시 확인하지 않으며, 새 체인에서 담을 수 없게 된 거래는 뒤이어 Prune이 뺍니다.
+func (p *Mempool) Requeue(txs []Transaction) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var ids []string
+	now := time.Now()
+	for _, tx := range txs {
+		id := txID(tx)
+		key := nonceKey(tx.Sender, tx.Nonce)
+		if _, ok := p.byNonce[key]; ok {
+			continue
+		}
+		p.txs[id] = &mempoolEntry{tx: tx, size: txSize(tx), added: now}
+		p.byNonce[key] = id
+		p.pending[tx.Sender] += tx.Amount
+		ids = append(ids, id)
+	}
+	p.order = append(ids, p.order...)
+}
+
+// NextNonce는 nonce부터 대기 중인 거래가 이어서 쓰고 있는 순번을 건너뛴 다음 순번을 반환합니다.
+func (p *Mempool) NextNonce(sender string, nonce uint64) uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for {
+		if _, ok := p.byNonce[nonceKey(sender, nonce)]; !ok {
+			return nonce
+		}
+		nonce++
+	}
+}
+
+// List는 대기 중인 거래를 받은 순서대로 반환합니다.
+func (p *Mempool) List() []Transaction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	txs := make([]Transaction, 0, len(p.order))
+	for _, id := range p.order {
+		txs = append(txs, p.txs[id].tx)
+	}
+	return txs
+}
+
+// reorganize는 체인이 oldChain에서 newChain으로 바뀔 때 대기열을 맞춥니다. state는 newChain의 상태입니다.
+// 갈라진 지점 뒤의 버려진 블록에만 있던 거래는 다시 대기열에 넣고, 새 체인에서 이미 쓴 순번의
+// 거래는 대기열에서 뺍니다. 채굴 보상 거래는 그 블록에만 의미가 있으므로 버립니다.
+// mutex를 잡은 상태에서 호출합니다.
+func reorganize(oldChain, newChain []Block, state *State) {
+	fork := forkPoint(oldChain, newChain)
+
+	var orphaned []Transaction
+	for _, block := range oldChain[fork:] {
+		for _, tx := range block.Transactions {
+			if !isCoinbase(tx) && tx.Nonce >= state.Nonces[tx.Sender] {
+				orphaned = append(orphaned, tx)
+			}
+		}
+	}
+
+	mempool.Requeue(orphaned)
+	mempool.Prune(state)
+	if len(orphaned) > 0 {
+		fmt.Printf("버려진 블록 %d개의 거래 %d개를 다시 대기열에 넣었습니다.\n", len(oldChain)-fork, len(orphaned))
+	}
+	// 버려진 블록은 이 노드만 가지고 있었을 수 있으므로 거래를 다시 알림
+	for _, tx := range orphaned {
+		broadcastTransaction(tx)
+	}
+}
+
+// submitTransaction은 새 거래를 대기열에 넣고, 처음 받은 거래면 피어에게 전파합니다.
+// 채굴 중인 계산은 멈추지 않으며, 거래는 채굴기가 다음 블록을 만들 때 담깁니다.
+func submitTransaction(tx Transaction) error {
+	if err := mempool.Add(tx); err != nil {
+		return err
+	}
+	fmt.Printf("거래를 받았습니다: %s (%s → %s: %d)\n", txID(tx)[:16], tx.Sender, tx.Recipient, tx.Amount)
+	broadcastTransaction(tx)
+	return nil
+}
+
+// 거래 핸들러
+//
+//	GET  /transactions   대기 중인 거래 목록
+//	POST /transactions   서명된 거래 하나 접수 (피어가 전파한 거래도 여기로 옴)
+func handleTransactions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(mempool.List())
+	case http.MethodPost:
+		var tx Transaction
+		if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
+			http.Error(w, "유효한 거래 데이터가 필요합니다", http.StatusBadRequest)
+			return
+		}
+		err := submitTransaction(tx)
+		switch {
+		case errors.Is(err, ErrDuplicate):
+			w.WriteHeader(http.StatusOK)
+		case errors.Is(err, ErrMempoolFull):
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		default:
+			w.WriteHeader(http.StatusAccepted)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id": txID(tx)})
+	default:
+		http.Error(w, "GET 또는 POST 요청만 가능합니다.", http.StatusMethodNotAllowed)
+	}
+}
+
+// 피어에게 거래 전파. 이미 가진 거래는 다시 전파하지 않으므로 전파가 끝없이 돌지 않습니다.
+func broadcastTransaction(tx Transaction) {
+	jsonData, err := json.Marshal(tx)
+	if err != nil {
+		fmt.Println("거래 전파 중 JSON 마샬링 오류:", err)
+		return
+	}
+
+	peersMutex.Lock()
+	defer peersMutex.Unlock()
+	for _, peer := range peers {
+		go func(peer string) {
+			resp, err := http.Post(peer+"/transactions", "application/json", bytes.NewReader(jsonData))
+			if err != nil {
+				fmt.Println("거래 전파 실패:", err)
+				return
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode >= http.StatusBadRequest {
+				body, _ := io.ReadAll(resp.Body)
+				fmt.Printf("거래 전파 실패: %s\n", string(body))
+			}
+		}(peer)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// resetChain은 전역 체인과 대기열을 테스트마다 비웁니다.
+func resetChain(t *testing.T) {
+	t.Helper()
+	Blockchain = []Block{{}}
+	chainState = NewState()
+	txIndex = make(map[string]txLocation)
+	mempool = &Mempool{txs: make(map[string]*mempoolEntry), byNonce: make(map[string]string), pending: make(map[string]int)}
+}
+
+func TestMempoolAdd(t *testing.T) {
+	alice, bob := mustWallet(t), mustWallet(t)
+
+	tests := []struct {
+		name    string
+		balance int
+		nonce   uint64
+		txs     []Transaction
+		want    []error
+	}{
+		{"no balance", 0, 0, []Transaction{alice.Sign(bob.Address, 1, 0)}, []error{ErrOverdraft}},
+		{"future nonce without balance", 0, 0, []Transaction{alice.Sign(bob.Address, 1, 5)}, []error{ErrOverdraft}},
+		{"pending total over balance", 10, 0,
+			[]Transaction{alice.Sign(bob.Address, 6, 0), alice.Sign(bob.Address, 5, 1), alice.Sign(bob.Address, 4, 1)},
+			[]error{nil, ErrOverdraft, nil}},
+		// 대기 중인 금액에 더하면 넘쳐 음수가 되는 금액
+		{"amount overflowing pending total", 10, 0,
+			[]Transaction{alice.Sign(bob.Address, 1, 0), alice.Sign(bob.Address, math.MaxInt, 1)},
+			[]error{nil, ErrOverdraft}},
+		{"nonce too far ahead", 100, 3,
+			[]Transaction{alice.Sign(bob.Address, 1, 3+maxNonceGap-1), alice.Sign(bob.Address, 1, 3+maxNonceGap)},
+			[]error{nil, ErrNonceTooFar}},
+		{"used nonce", 10, 1, []Transaction{alice.Sign(bob.Address, 1, 0)}, []error{ErrBadNonce}},
+		{"same nonce twice", 10, 0,
+			[]Transaction{alice.Sign(bob.Address, 1, 0), alice.Sign(bob.Address, 2, 0)},
+			[]error{nil, ErrBadNonce}},
+		{"duplicate", 10, 0,
+			[]Transaction{alice.Sign(bob.Address, 1, 0), alice.Sign(bob.Address, 1, 0)},
+			[]error{nil, ErrDuplicate}},
+		{"coinbase", 10, 0, []Transaction{newCoinbase(bob.Address, 1)}, []error{ErrInvalidTransaction}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetChain(t)
+			chainState.Balances[alice.Address] = tt.balance
+			chainState.Nonces[alice.Address] = tt.nonce
+			for i, tx := range tt.txs {
+				if err := mempool.Add(tx); !errors.Is(err, tt.want[i]) {
+					t.Errorf("Add #%d = %v, want %v", i, err, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMempoolPrune(t *testing.T) {
+	resetChain(t)
+	alice, bob := mustWallet(t), mustWallet(t)
+	chainState.Balances[alice.Address] = 10
+	for nonce := uint64(0); nonce < 5; nonce++ {
+		if err := mempool.Add(alice.Sign(bob.Address, 2, nonce)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 순번 0이 체인에 담기고, 다른 거래로 잔액이 줄어 대기 중인 거래 일부를 낼 수 없게 됨
+	state := NewState()
+	state.Nonces[alice.Address] = 1
+	state.Balances[alice.Address] = 5
+	mempool.Prune(state)
+	txs := mempool.List()
+	if len(txs) != 2 || txs[0].Nonce != 1 || txs[1].Nonce != 2 {
+		t.Fatalf("after prune: %+v", txs)
+	}
+	if mempool.pending[alice.Address] != 4 {
+		t.Errorf("pending = %d, want 4", mempool.pending[alice.Address])
+	}
+
+	// 오래 기다린 거래는 빠짐
+	for _, entry := range mempool.txs {
+		entry.added = time.Now().Add(-mempoolExpiry - time.Second)
+	}
+	mempool.Prune(state)
+	if n := len(mempool.List()); n != 0 {
+		t.Errorf("%d expired transactions left", n)
+	}
+}
+
+func TestMempoolSelect(t *testing.T) {
+	resetChain(t)
+	alice, bob := mustWallet(t), mustWallet(t)
+	chainState.Balances[alice.Address] = 10
+	// 순번이 뒤바뀌어 도착해도 차례대로 고름
+	for _, nonce := range []uint64{2, 0, 1} {
+		if err := mempool.Add(alice.Sign(bob.Address, 1, nonce)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	selected := mempool.Select(chainState, maxBlockSize)
+	if len(selected) != 3 {
+		t.Fatalf("selected %d transactions, want 3", len(selected))
+	}
+	for i, tx := range selected {
+		if tx.Nonce != uint64(i) {
+			t.Errorf("selected[%d].Nonce = %d", i, tx.Nonce)
+		}
+	}
+	if got := mempool.Select(chainState, txSize(selected[0])); len(got) != 1 {
+		t.Errorf("size-limited select returned %d transactions, want 1", len(got))
+	}
+}
+
+func TestReorganize(t *testing.T) {
+	resetChain(t)
+	alice, bob, carol := mustWallet(t), mustWallet(t), mustWallet(t)
+	chainState.Balances[carol.Address] = 5
+	waiting := carol.Sign(bob.Address, 1, 0)
+	if err := mempool.Add(waiting); err != nil {
+		t.Fatal(err)
+	}
+
+	// 두 체인 모두 순번 0 거래를 담았지만 순번 1 거래는 버려지는 블록에만 있음
+	confirmed := alice.Sign(bob.Address, 1, 0)
+	orphaned := alice.Sign(bob.Address, 2, 1)
+	genesis := Block{BlockHeader: BlockHeader{Hash: "genesis"}}
+	oldChain := []Block{genesis, {
+		BlockHeader:  BlockHeader{Index: 1, Hash: "old"},
+		Transactions: []Transaction{newCoinbase(carol.Address, 1), confirmed, orphaned},
+	}}
+	newChain := []Block{genesis, {
+		BlockHeader:  BlockHeader{Index: 1, Hash: "new"},
+		Transactions: []Transaction{newCoinbase(bob.Address, 1), confirmed},
+	}}
+	state := NewState()
+	state.Nonces[alice.Address] = 1
+	state.Balances[alice.Address] = 10
+	state.Balances[carol.Address] = 5
+
+	reorganize(oldChain, newChain, state)
+	txs := mempool.List()
+	if len(txs) != 2 || txID(txs[0]) != txID(orphaned) || txID(txs[1]) != txID(waiting) {
+		t.Fatalf("mempool after reorganize: %+v", txs)
+	}
+	if mempool.pending[alice.Address] != orphaned.Amount {
+		t.Errorf("pending = %d, want %d", mempool.pending[alice.Address], orphaned.Amount)
+	}
+}
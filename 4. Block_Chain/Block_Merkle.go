@@ -0,0 +1,256 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// 블록 헤더에는 거래 목록 대신 거래들로 만든 머클 트리의 루트가 들어갑니다. 그래서 거래 하나가
+// 블록에 담겼다는 것을 전체 체인 없이 헤더 목록과 머클 증명(잎에서 루트까지의 형제 해시)만으로
+// 확인할 수 있습니다.
+//
+// 잎과 안쪽 노드는 해시 앞에 다른 바이트를 붙여 서로 바꿔 끼울 수 없게 하고, 짝이 없는 마지막
+// 노드는 복제하지 않고 그대로 위 단계로 올립니다. 복제하면 거래 목록이 달라도 루트가 같아질 수 있습니다.
+const (
+	merkleLeafPrefix = 0x00 // 잎 노드(거래) 해시 앞에 붙는 바이트
+	merkleNodePrefix = 0x01 // 안쪽 노드 해시 앞에 붙는 바이트
+)
+
+// appendTransactionBody는 거래에서 서명하는 부분을 정규 이진 형식으로 buf 뒤에 붙입니다.
+//
+//	sender     uvarint 길이 + 바이트
+//	recipient  uvarint 길이 + 바이트
+//	amount     8바이트 빅엔디언 (부호 있는 정수)
+//	nonce      8바이트 빅엔디언
+func appendTransactionBody(buf []byte, tx Transaction) []byte {
+	buf = appendString(buf, tx.Sender)
+	buf = appendString(buf, tx.Recipient)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(int64(tx.Amount)))
+	buf = binary.BigEndian.AppendUint64(buf, tx.Nonce)
+	return buf
+}
+
+// encodeTransaction은 거래 전체의 정규 이진 형식입니다. 서명하는 부분 뒤에
+// public_key와 signature를 uvarint 길이 + 바이트로 붙입니다.
+// 같은 거래는 항상 같은 바이트가 되므로 머클 트리의 잎과 블록 크기 계산에 씁니다.
+func encodeTransaction(tx Transaction) []byte {
+	buf := appendTransactionBody(nil, tx)
+	buf = appendString(buf, tx.PublicKey)
+	buf = appendString(buf, tx.Signature)
+	return buf
+}
+
+// encodeHeader는 블록 헤더의 정규 이진 형식으로, 블록 해시는 이 바이트의 SHA-256입니다.
+// 해시 자신은 들어가지 않습니다.
+//
+//	index        8바이트 빅엔디언
+//	timestamp    uvarint 길이 + 바이트
+//	merkle_root  uvarint 길이 + 바이트
+//	prev_hash    uvarint 길이 + 바이트
+//	difficulty   8바이트 빅엔디언
+//	nonce        8바이트 빅엔디언
+func encodeHeader(header BlockHeader) []byte {
+	buf := binary.BigEndian.AppendUint64(nil, uint64(int64(header.Index)))
+	buf = appendString(buf, header.Timestamp)
+	buf = appendString(buf, header.MerkleRoot)
+	buf = appendString(buf, header.PrevHash)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(int64(header.Difficulty)))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(int64(header.Nonce)))
+	return buf
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// merkleLeaf는 거래 하나의 잎 해시입니다. 서명까지 들어가므로 블록 해시가 서명도 보증합니다.
+func merkleLeaf(tx Transaction) []byte {
+	hash := sha256.Sum256(append([]byte{merkleLeafPrefix}, encodeTransaction(tx)...))
+	return hash[:]
+}
+
+func merkleParent(left, right []byte) []byte {
+	data := make([]byte, 0, 1+len(left)+len(right))
+	data = append(data, merkleNodePrefix)
+	data = append(data, left...)
+	data = append(data, right...)
+	hash := sha256.Sum256(data)
+	return hash[:]
+}
+
+// merkleLevel은 한 단계 위의 노드들을 계산합니다.
+func merkleLevel(level [][]byte) [][]byte {
+	next := make([][]byte, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		if i+1 == len(level) {
+			next = append(next, level[i]) // 짝이 없으면 그대로 올림
+			continue
+		}
+		next = append(next, merkleParent(level[i], level[i+1]))
+	}
+	return next
+}
+
+func merkleLeaves(txs []Transaction) [][]byte {
+	leaves := make([][]byte, len(txs))
+	for i, tx := range txs {
+		leaves[i] = merkleLeaf(tx)
+	}
+	return leaves
+}
+
+// merkleRoot는 거래 목록의 머클 루트입니다. 거래가 없으면 빈 바이트열의 해시입니다.
+func merkleRoot(txs []Transaction) string {
+	if len(txs) == 0 {
+		hash := sha256.Sum256(nil)
+		return hex.EncodeToString(hash[:])
+	}
+	level := merkleLeaves(txs)
+	for len(level) > 1 {
+		level = merkleLevel(level)
+	}
+	return hex.EncodeToString(level[0])
+}
+
+// MerkleStep은 증명의 한 단계로, 지금까지 계산한 해시와 합칠 형제 노드입니다.
+type MerkleStep struct {
+	Hash string `json:"hash"`
+	Left bool   `json:"left"` // 형제 노드가 왼쪽에 오는지
+}
+
+// merklePath는 txs[index]의 잎에서 루트까지 올라가는 데 필요한 형제 노드들을 반환합니다.
+// 짝이 없어 그대로 올라가는 단계는 빠집니다.
+func merklePath(txs []Transaction, index int) []MerkleStep {
+	path := []MerkleStep{}
+	level := merkleLeaves(txs)
+	for len(level) > 1 {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			path = append(path, MerkleStep{Hash: hex.EncodeToString(level[sibling]), Left: sibling < index})
+		}
+		level = merkleLevel(level)
+		index /= 2
+	}
+	return path
+}
+
+// verifyMerklePath는 tx의 잎에서 path를 따라 올라간 해시가 root와 같은지 확인합니다.
+func verifyMerklePath(tx Transaction, path []MerkleStep, root string) bool {
+	hash := merkleLeaf(tx)
+	for _, step := range path {
+		sibling, err := hex.DecodeString(step.Hash)
+		if err != nil || len(sibling) != sha256.Size {
+			return false
+		}
+		if step.Left {
+			hash = merkleParent(sibling, hash)
+		} else {
+			hash = merkleParent(hash, sibling)
+		}
+	}
+	return hex.EncodeToString(hash) == root
+}
+
+// MerkleProof는 /proofs/<거래 ID>의 응답입니다.
+type MerkleProof struct {
+	TxID        string       `json:"tx_id"`
+	Transaction Transaction  `json:"transaction"`
+	Header      BlockHeader  `json:"header"` // 거래가 담긴 블록의 헤더
+	Path        []MerkleStep `json:"path"`
+}
+
+// verifyProof는 증명이 스스로 맞는지 확인합니다. 거래가 ID와 같고, 헤더의 작업 증명이 맞고,
+// 거래에서 path를 따라 올라가면 헤더의 머클 루트가 나와야 합니다.
+// 이 헤더가 실제로 체인에 들어 있는지는 verifyHeaders로 확인한 헤더 목록과 비교해 따로 확인합니다.
+func verifyProof(proof MerkleProof) error {
+	if txID(proof.Transaction) != proof.TxID {
+		return errors.New("거래 내용이 거래 ID와 맞지 않습니다")
+	}
+	header := proof.Header
+	if calculateHash(header) != header.Hash || !hashMeetsDifficulty(header.Hash, header.Difficulty) {
+		return errors.New("블록 헤더의 작업 증명이 올바르지 않습니다")
+	}
+	if !verifyMerklePath(proof.Transaction, proof.Path, header.MerkleRoot) {
+		return errors.New("머클 증명이 블록의 머클 루트와 맞지 않습니다")
+	}
+	return nil
+}
+
+// verifyHeaders는 거래 없이 헤더만으로 체인을 검사합니다. 노드가 블록을 받을 때와 같은
+// isHeaderValid로 해시와 작업 증명, 이전 해시 연결, 시각, 난이도 조정 규칙을 확인하며,
+// 거래의 서명과 잔액은 확인하지 않습니다.
+func verifyHeaders(headers []BlockHeader) error {
+	if len(headers) == 0 {
+		return errors.New("헤더가 없습니다")
+	}
+	if !isGenesisHeaderValid(headers[0]) {
+		return errors.New("제네시스 헤더가 올바르지 않습니다")
+	}
+	chain := make([]Block, 0, len(headers))
+	chain = append(chain, Block{BlockHeader: headers[0]})
+	for i := 1; i < len(headers); i++ {
+		if !isHeaderValid(headers[i], chain) {
+			return fmt.Errorf("헤더 %d이(가) 올바르지 않습니다", i)
+		}
+		chain = append(chain, Block{BlockHeader: headers[i]})
+	}
+	return nil
+}
+
+// 머클 증명 핸들러: GET /proofs/<거래 ID>
+func handleProof(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/proofs/")
+
+	mutex.Lock()
+	block, index, ok := findTransaction(id)
+	mutex.Unlock()
+	if !ok {
+		http.Error(w, "블록에 담긴 거래를 찾을 수 없습니다", http.StatusNotFound)
+		return
+	}
+
+	proof := MerkleProof{
+		TxID:        id,
+		Transaction: block.Transactions[index],
+		Header:      block.BlockHeader,
+		Path:        merklePath(block.Transactions, index),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(proof)
+}
+
+// verifyTransactionOnNode는 노드에서 헤더 목록과 증명만 받아 거래가 체인에 담겼는지 확인합니다.
+// 블록의 거래 목록은 받지 않습니다.
+func verifyTransactionOnNode(node, id string) error {
+	var headers []BlockHeader
+	if err := getJSON(node+"/headers", &headers); err != nil {
+		return err
+	}
+	if err := verifyHeaders(headers); err != nil {
+		return err
+	}
+	var proof MerkleProof
+	if err := getJSON(node+"/proofs/"+id, &proof); err != nil {
+		return err
+	}
+	if err := verifyProof(proof); err != nil {
+		return err
+	}
+	index := proof.Header.Index
+	if index < 0 || index >= len(headers) || headers[index].Hash != proof.Header.Hash {
+		return errors.New("증명의 블록이 체인에 없습니다")
+	}
+
+	tx := proof.Transaction
+	fmt.Printf("확인되었습니다: 거래 %s\n", id)
+	fmt.Printf("%s → %s: %d (순번 %d)\n", tx.Sender, tx.Recipient, tx.Amount, tx.Nonce)
+	fmt.Printf("블록 %d (%s), 확인 %d개\n", index, proof.Header.Hash, len(headers)-index)
+	return nil
+}
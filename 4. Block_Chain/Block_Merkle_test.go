@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func testTransactions(t *testing.T, n int) []Transaction {
+	t.Helper()
+	alice, bob := mustWallet(t), mustWallet(t)
+	txs := make([]Transaction, n)
+	for i := range txs {
+		txs[i] = alice.Sign(bob.Address, i+1, uint64(i))
+	}
+	return txs
+}
+
+func TestMerklePathRoundTrip(t *testing.T) {
+	for n := 1; n <= 17; n++ {
+		txs := testTransactions(t, n)
+		root := merkleRoot(txs)
+		for i, tx := range txs {
+			path := merklePath(txs, i)
+			if !verifyMerklePath(tx, path, root) {
+				t.Errorf("%d leaves: path for %d does not verify", n, i)
+			}
+			other := txs[(i+1)%n]
+			if n > 1 && verifyMerklePath(other, path, root) {
+				t.Errorf("%d leaves: path for %d verifies transaction %d", n, i, (i+1)%n)
+			}
+		}
+	}
+}
+
+func TestVerifyMerklePathTampered(t *testing.T) {
+	txs := testTransactions(t, 5)
+	root := merkleRoot(txs)
+	path := merklePath(txs, 2)
+
+	tests := []struct {
+		name   string
+		modify func(path []MerkleStep) []MerkleStep
+	}{
+		{"side flipped", func(path []MerkleStep) []MerkleStep { path[0].Left = !path[0].Left; return path }},
+		{"sibling changed", func(path []MerkleStep) []MerkleStep { path[0].Hash = flipHex(path[0].Hash); return path }},
+		{"sibling not hex", func(path []MerkleStep) []MerkleStep { path[0].Hash = "zz"; return path }},
+		{"sibling short", func(path []MerkleStep) []MerkleStep { path[0].Hash = path[0].Hash[:62]; return path }},
+		{"step missing", func(path []MerkleStep) []MerkleStep { return path[1:] }},
+		{"step added", func(path []MerkleStep) []MerkleStep { return append(path, path[0]) }},
+		{"empty", func(path []MerkleStep) []MerkleStep { return nil }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := tt.modify(append([]MerkleStep{}, path...))
+			if verifyMerklePath(txs[2], tampered, root) {
+				t.Error("tampered path verifies")
+			}
+		})
+	}
+}
+
+func TestMerkleRoot(t *testing.T) {
+	txs := testTransactions(t, 3)
+	tests := []struct {
+		name string
+		a, b []Transaction
+	}{
+		// 짝이 없는 마지막 잎을 복제하지 않으므로 마지막 거래를 반복해도 루트가 달라야 함
+		{"duplicated last leaf", txs, append(append([]Transaction{}, txs...), txs[2])},
+		{"reordered", txs, []Transaction{txs[1], txs[0], txs[2]}},
+		{"one leaf vs empty", txs[:1], nil},
+	}
+	for _, tt := range tests {
+		if merkleRoot(tt.a) == merkleRoot(tt.b) {
+			t.Errorf("%s: roots are equal", tt.name)
+		}
+	}
+	if merkleRoot(txs) != merkleRoot(append([]Transaction{}, txs...)) {
+		t.Error("root is not deterministic")
+	}
+}
+
+func TestCanonicalEncoding(t *testing.T) {
+	txs := []struct {
+		name string
+		a, b Transaction
+	}{
+		{"field boundary", Transaction{Sender: "ab", Recipient: "c"}, Transaction{Sender: "a", Recipient: "bc"}},
+		{"signature boundary", Transaction{PublicKey: "ab", Signature: "c"}, Transaction{PublicKey: "a", Signature: "bc"}},
+		{"amount vs nonce", Transaction{Amount: 1}, Transaction{Nonce: 1}},
+	}
+	for _, tt := range txs {
+		if bytes.Equal(encodeTransaction(tt.a), encodeTransaction(tt.b)) {
+			t.Errorf("%s: transactions encode the same", tt.name)
+		}
+	}
+
+	headers := []struct {
+		name string
+		a, b BlockHeader
+	}{
+		{"index and timestamp", BlockHeader{Index: 1, Timestamp: "12"}, BlockHeader{Index: 11, Timestamp: "2"}},
+		{"merkle root and prev hash", BlockHeader{MerkleRoot: "ab", PrevHash: "c"}, BlockHeader{MerkleRoot: "a", PrevHash: "bc"}},
+		{"prev hash and difficulty", BlockHeader{PrevHash: "a1", Difficulty: 2}, BlockHeader{PrevHash: "a", Difficulty: 12}},
+		{"difficulty and nonce", BlockHeader{Difficulty: 1}, BlockHeader{Nonce: 1}},
+	}
+	for _, tt := range headers {
+		if calculateHash(tt.a) == calculateHash(tt.b) {
+			t.Errorf("%s: headers hash the same", tt.name)
+		}
+	}
+}
+
+// mineHeader는 header의 작업 증명을 다시 계산합니다.
+func mineHeader(t *testing.T, header BlockHeader) BlockHeader {
+	t.Helper()
+	header.Nonce = 0
+	block, ok := proofOfWork(context.Background(), Block{BlockHeader: header})
+	if !ok {
+		t.Fatal("proof of work cancelled")
+	}
+	return block.BlockHeader
+}
+
+// testHeaders는 start부터 1분 간격으로 n개의 헤더가 이어진 체인을 만듭니다.
+func testHeaders(t *testing.T, start time.Time, n int) []BlockHeader {
+	t.Helper()
+	headers := []BlockHeader{mineHeader(t, BlockHeader{
+		Timestamp:  start.Format(time.RFC3339),
+		MerkleRoot: merkleRoot(nil),
+		Difficulty: initialDifficulty,
+	})}
+	for i := 1; i < n; i++ {
+		prev := headers[i-1]
+		headers = append(headers, mineHeader(t, BlockHeader{
+			Index:      i,
+			Timestamp:  start.Add(time.Duration(i) * time.Minute).Format(time.RFC3339),
+			MerkleRoot: merkleRoot(nil),
+			PrevHash:   prev.Hash,
+			Difficulty: prev.Difficulty,
+		}))
+	}
+	return headers
+}
+
+func TestVerifyHeaders(t *testing.T) {
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	valid := testHeaders(t, start, 3)
+	if err := verifyHeaders(valid); err != nil {
+		t.Fatalf("valid headers: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(h *BlockHeader)
+	}{
+		{"timestamp before previous", func(h *BlockHeader) { h.Timestamp = start.Format(time.RFC3339) }},
+		{"timestamp in the future", func(h *BlockHeader) { h.Timestamp = time.Now().Add(maxFutureDrift + time.Hour).Format(time.RFC3339) }},
+		{"timestamp unparsable", func(h *BlockHeader) { h.Timestamp = "yesterday" }},
+		{"lower difficulty", func(h *BlockHeader) { h.Difficulty-- }},
+		{"wrong previous hash", func(h *BlockHeader) { h.PrevHash = valid[0].PrevHash }},
+		{"wrong index", func(h *BlockHeader) { h.Index++ }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := append([]BlockHeader{}, valid...)
+			// 작업 증명은 다시 계산해 규칙 자체가 걸러내는지 확인함
+			tt.modify(&headers[2])
+			headers[2] = mineHeader(t, headers[2])
+			if err := verifyHeaders(headers); err == nil {
+				t.Error("invalid headers verify")
+			}
+		})
+	}
+
+	t.Run("hash not recomputed", func(t *testing.T) {
+		headers := append([]BlockHeader{}, valid...)
+		headers[1].Timestamp = start.Add(90 * time.Second).Format(time.RFC3339)
+		if err := verifyHeaders(headers); err == nil {
+			t.Error("modified header verifies without proof of work")
+		}
+	})
+}
+
+func TestVerifyProof(t *testing.T) {
+	txs := testTransactions(t, 4)
+	header := mineHeader(t, BlockHeader{
+		Index:      1,
+		Timestamp:  time.Now().Format(time.RFC3339),
+		MerkleRoot: merkleRoot(txs),
+		Difficulty: initialDifficulty,
+	})
+	proof := func() MerkleProof {
+		return MerkleProof{TxID: txID(txs[1]), Transaction: txs[1], Header: header, Path: merklePath(txs, 1)}
+	}
+	if err := verifyProof(proof()); err != nil {
+		t.Fatalf("valid proof: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(p *MerkleProof)
+	}{
+		{"other transaction", func(p *MerkleProof) { p.Transaction = txs[2] }},
+		{"other transaction with matching id", func(p *MerkleProof) { p.Transaction, p.TxID = txs[2], txID(txs[2]) }},
+		{"header without proof of work", func(p *MerkleProof) { p.Header.MerkleRoot = merkleRoot(txs[:1]) }},
+		{"forged root", func(p *MerkleProof) { p.Header = mineHeader(t, BlockHeader{Index: 1, MerkleRoot: merkleRoot(txs[:1]), Difficulty: initialDifficulty}) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := proof()
+			tt.modify(&p)
+			if err := verifyProof(p); err == nil {
+				t.Errorf("invalid proof verifies: %+v", p.Header)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// 난이도는 블록 해시 앞에 와야 하는 0 비트의 수입니다. 블록마다 기록되며,
+// retargetInterval 블록마다 실제로 걸린 시간을 보고 targetBlockTime에 맞도록 조정합니다.
+const (
+	initialDifficulty = 16               // 제네시스 블록의 난이도 (16진수로 0이 4개)
+	minDifficulty     = 1                // 난이도의 최솟값
+	maxRetargetStep   = 4                // 한 번에 바꿀 수 있는 난이도 (비트, 4면 16배)
+	retargetInterval  = 10               // 난이도를 다시 계산하는 블록 간격
+	targetBlockTime   = 10 * time.Second // 블록 하나를 만드는 데 걸렸으면 하는 시간
+	maxFutureDrift    = 2 * time.Minute  // 블록 시각이 현재보다 앞설 수 있는 한도
+	powCheckInterval  = 1 << 12          // 채굴 중 취소 여부를 확인하는 해시 계산 횟수
+)
+
+// hashMeetsDifficulty는 16진수 해시의 앞부분이 difficulty 비트만큼 0인지 확인합니다.
+func hashMeetsDifficulty(hash string, difficulty int) bool {
+	raw, err := hex.DecodeString(hash)
+	if err != nil {
+		return false
+	}
+	zeros := 0
+	for _, b := range raw {
+		zeros += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+	return zeros >= difficulty
+}
+
+// nextDifficulty는 chain 다음에 올 블록이 가져야 하는 난이도를 계산합니다.
+// retargetInterval 블록마다 그 사이에 걸린 시간을 예상 시간과 비교해, 두 배 빨랐으면
+// 1비트 올리고 두 배 느렸으면 1비트 내리는 식으로 최대 maxRetargetStep까지 조정합니다.
+func nextDifficulty(chain []Block) int {
+	last := chain[len(chain)-1]
+	next := last.Index + 1
+	if next%retargetInterval != 0 || next < retargetInterval {
+		return last.Difficulty
+	}
+
+	first := chain[len(chain)-retargetInterval]
+	start, err1 := time.Parse(time.RFC3339, first.Timestamp)
+	end, err2 := time.Parse(time.RFC3339, last.Timestamp)
+	if err1 != nil || err2 != nil {
+		return last.Difficulty
+	}
+	actual := end.Sub(start)
+	expected := targetBlockTime * (retargetInterval - 1)
+	// 시각은 초 단위이므로 0이 될 수 있음
+	if actual < time.Second {
+		actual = time.Second
+	}
+
+	difficulty := last.Difficulty
+	for step := 0; step < maxRetargetStep && actual*2 <= expected; step++ {
+		difficulty++
+		actual *= 2
+	}
+	for step := 0; step < maxRetargetStep && actual >= expected*2; step++ {
+		difficulty--
+		actual /= 2
+	}
+	return max(difficulty, minDifficulty)
+}
+
+// proofOfWork는 블록의 해시가 난이도를 만족할 때까지 논스를 바꿔 가며 계산합니다.
+// ctx가 취소되면 멈추고 false를 반환합니다.
+func proofOfWork(ctx context.Context, block Block) (Block, bool) {
+	for {
+		if block.Nonce%powCheckInterval == 0 && ctx.Err() != nil {
+			return block, false
+		}
+		hash := calculateHash(block.BlockHeader)
+		if hashMeetsDifficulty(hash, block.Difficulty) {
+			block.Hash = hash
+			return block, true
+		}
+		block.Nonce++
+	}
+}
+
+// Miner는 백그라운드에서 계속 다음 블록을 채굴합니다. 블록에는 Address에게 주는 채굴 보상 거래와
+// 대기열에서 지금 잔액과 순번으로 적용할 수 있는 거래를 받은 순서대로 maxBlockSize까지 담습니다.
+// 다른 곳(피어)에서 먼저 다음 블록이 추가되면 하던 계산을 버리고 최신 상태로 다시 시작합니다.
+// 새 거래가 들어와도 하던 계산은 계속하며, 그 거래는 다음 블록에 담깁니다.
+type Miner struct {
+	Address string // 채굴 보상을 받을 주소 (비어 있으면 보상 거래를 넣지 않음)
+
+	mu     sync.Mutex
+	cancel context.CancelFunc // 지금 채굴 중인 계산을 멈춤
+}
+
+var miner = &Miner{}
+
+// Restart는 지금 하던 채굴을 멈추고 최신 블록 위에서 다시 시작하게 합니다.
+func (m *Miner) Restart() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cancel != nil {
+		m.cancel()
+	}
+}
+
+// Run은 채굴을 반복합니다. 고루틴으로 실행합니다.
+func (m *Miner) Run() {
+	for {
+		ctx, cancel := context.WithCancel(context.Background())
+		m.mu.Lock()
+		m.cancel = cancel
+		m.mu.Unlock()
+
+		// 체인을 읽은 뒤에 블록이 추가되면 Restart로 ctx가 취소되므로, 이미 담긴 거래를 다시 담을 일은 없음
+		mutex.Lock()
+		prevBlock := Blockchain[len(Blockchain)-1]
+		difficulty := nextDifficulty(Blockchain)
+		state := chainState.Clone()
+		mutex.Unlock()
+
+		transactions := []Transaction{}
+		size := 0
+		if m.Address != "" {
+			coinbase := newCoinbase(m.Address, prevBlock.Index+1)
+			transactions = append(transactions, coinbase)
+			size += txSize(coinbase)
+		}
+		transactions = append(transactions, mempool.Select(state, maxBlockSize-size)...)
+
+		start := time.Now()
+		newBlock, ok := proofOfWork(ctx, generateBlock(prevBlock, transactions, difficulty))
+		cancel()
+		if !ok {
+			fmt.Printf("새 블록이 도착해 블록 %d 채굴을 다시 시작합니다.\n", prevBlock.Index+1)
+			continue
+		}
+
+		fmt.Printf("블록 %d 채굴 완료 (난이도 %d, 거래 %d개, %s)\n",
+			newBlock.Index, newBlock.Difficulty, len(newBlock.Transactions), time.Since(start).Round(time.Millisecond))
+		// 블록에 담긴 거래는 addBlock이 대기열에서 뺌
+		addBlock(newBlock)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// spacedChain은 difficulty 난이도의 블록 n개를 spacing 간격의 시각으로 만듭니다.
+// nextDifficulty는 번호, 시각, 난이도만 보므로 해시는 채우지 않습니다.
+func spacedChain(n, difficulty int, spacing time.Duration) []Block {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	chain := make([]Block, n)
+	for i := range chain {
+		chain[i].Index = i
+		chain[i].Timestamp = start.Add(time.Duration(i) * spacing).Format(time.RFC3339)
+		chain[i].Difficulty = difficulty
+	}
+	return chain
+}
+
+func TestNextDifficulty(t *testing.T) {
+	tests := []struct {
+		name       string
+		n          int
+		difficulty int
+		spacing    time.Duration
+		want       int
+	}{
+		// 재계산 높이가 아니면 얼마나 빨랐든 그대로
+		{"before first retarget", retargetInterval - 1, 16, 0, 16},
+		{"between retargets", retargetInterval + 1, 16, 0, 16},
+		{"just before retarget", 2*retargetInterval - 1, 16, time.Hour, 16},
+
+		{"on target", retargetInterval, 16, targetBlockTime, 16},
+		{"twice as fast", retargetInterval, 16, targetBlockTime / 2, 17},
+		{"twice as slow", retargetInterval, 16, targetBlockTime * 2, 15},
+		{"not quite twice as fast", retargetInterval, 16, targetBlockTime * 6 / 10, 16},
+		{"not quite twice as slow", retargetInterval, 16, targetBlockTime * 19 / 10, 16},
+		{"five times as fast", retargetInterval, 16, targetBlockTime / 5, 18},
+		{"eight times as fast", retargetInterval, 16, time.Second, 19},
+		{"second retarget", 2 * retargetInterval, 16, targetBlockTime / 2, 17},
+
+		// 한 번에 maxRetargetStep 비트까지만 바뀜
+		{"far too slow", retargetInterval, 16, time.Hour, 16 - maxRetargetStep},
+
+		// minDifficulty 밑으로는 내려가지 않음
+		{"floor", retargetInterval, minDifficulty + 1, time.Hour, minDifficulty},
+		{"at floor", retargetInterval, minDifficulty, time.Hour, minDifficulty},
+
+		// 같은 시각이 이어져도 1초로 보고 maxRetargetStep까지만 올림
+		{"identical timestamps", retargetInterval, 16, 0, 16 + maxRetargetStep},
+	}
+	for _, tt := range tests {
+		chain := spacedChain(tt.n, tt.difficulty, tt.spacing)
+		if got := nextDifficulty(chain); got != tt.want {
+			t.Errorf("%s: nextDifficulty = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNextDifficultyUsesLastInterval(t *testing.T) {
+	// 앞 구간이 아주 느렸어도 마지막 retargetInterval 블록만 봄
+	chain := spacedChain(retargetInterval, 16, time.Hour)
+	last, _ := time.Parse(time.RFC3339, chain[len(chain)-1].Timestamp)
+	for i := retargetInterval; i < 2*retargetInterval; i++ {
+		last = last.Add(targetBlockTime)
+		chain = append(chain, Block{BlockHeader: BlockHeader{
+			Index:      i,
+			Timestamp:  last.Format(time.RFC3339),
+			Difficulty: 16,
+		}})
+	}
+	if got := nextDifficulty(chain); got != 16 {
+		t.Errorf("nextDifficulty = %d, want 16", got)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 블록을 채굴하면 받는 보상. 새 코인은 이것으로만 생깁니다.
+const blockReward = 50
+
+// 거래 적용 오류
+var (
+	ErrBadSignature    = errors.New("서명이 올바르지 않습니다")
+	ErrBadNonce        = errors.New("거래 순번(nonce)이 맞지 않습니다")
+	ErrOverdraft       = errors.New("잔액이 부족합니다")
+	ErrBadCoinbase     = errors.New("채굴 보상 거래가 올바르지 않습니다")
+	ErrUnexpectedCoins = errors.New("채굴 보상이 아닌 곳에서 코인이 생겼습니다")
+)
+
+// State는 체인의 블록을 처음부터 적용한 결과인 계정별 잔액과 다음 거래 순번입니다.
+// 같은 순번을 두 번 쓸 수 없으므로 같은 거래를 다시 넣거나(이중 지불) 순서를 바꿀 수 없습니다.
+type State struct {
+	Balances map[string]int    // 주소 -> 잔액
+	Nonces   map[string]uint64 // 주소 -> 다음 거래에 써야 하는 순번
+}
+
+func NewState() *State {
+	return &State{Balances: make(map[string]int), Nonces: make(map[string]uint64)}
+}
+
+// Clone은 상태를 복사합니다. 블록을 검사할 때 원래 상태를 건드리지 않기 위해 씁니다.
+func (s *State) Clone() *State {
+	c := NewState()
+	for addr, balance := range s.Balances {
+		c.Balances[addr] = balance
+	}
+	for addr, nonce := range s.Nonces {
+		c.Nonces[addr] = nonce
+	}
+	return c
+}
+
+// ApplyBlock은 블록의 거래를 차례로 적용합니다. 채굴 보상 거래는 맨 앞에 하나까지만 올 수 있습니다.
+// 오류가 나면 블록이 건드린 계정을 원래대로 되돌리므로, 상태 전체를 Clone하지 않고 바로 적용해도 됩니다.
+func (s *State) ApplyBlock(block Block) error {
+	saved := make(map[string]savedAccount)
+	for _, tx := range block.Transactions {
+		s.save(saved, tx.Sender)
+		s.save(saved, tx.Recipient)
+	}
+	if err := s.applyBlock(block); err != nil {
+		s.restore(saved)
+		return err
+	}
+	return nil
+}
+
+// savedAccount는 블록을 적용하기 전 계정 하나의 상태입니다.
+type savedAccount struct {
+	balance    int
+	nonce      uint64
+	hasBalance bool
+	hasNonce   bool
+}
+
+func (s *State) save(saved map[string]savedAccount, addr string) {
+	if _, ok := saved[addr]; ok {
+		return
+	}
+	balance, hasBalance := s.Balances[addr]
+	nonce, hasNonce := s.Nonces[addr]
+	saved[addr] = savedAccount{balance, nonce, hasBalance, hasNonce}
+}
+
+func (s *State) restore(saved map[string]savedAccount) {
+	for addr, account := range saved {
+		delete(s.Balances, addr)
+		delete(s.Nonces, addr)
+		if account.hasBalance {
+			s.Balances[addr] = account.balance
+		}
+		if account.hasNonce {
+			s.Nonces[addr] = account.nonce
+		}
+	}
+}
+
+func (s *State) applyBlock(block Block) error {
+	for i, tx := range block.Transactions {
+		if isCoinbase(tx) {
+			if i != 0 || tx.Nonce != uint64(block.Index) || tx.Amount > blockReward {
+				return ErrBadCoinbase
+			}
+			s.Balances[tx.Recipient] += tx.Amount
+			continue
+		}
+		if err := s.ApplyTransaction(tx); err != nil {
+			return fmt.Errorf("거래 %s: %w", txID(tx)[:16], err)
+		}
+	}
+	return nil
+}
+
+// ApplyTransaction은 서명된 거래 하나를 적용합니다.
+func (s *State) ApplyTransaction(tx Transaction) error {
+	if isCoinbase(tx) {
+		return ErrUnexpectedCoins
+	}
+	if !verifyTransaction(tx) {
+		return ErrBadSignature
+	}
+	return s.applyVerified(tx)
+}
+
+// applyVerified는 서명을 이미 확인한 거래를 적용합니다. 대기열처럼 서명을 한 번 확인해 둔 곳에서 씁니다.
+func (s *State) applyVerified(tx Transaction) error {
+	if isCoinbase(tx) {
+		return ErrUnexpectedCoins
+	}
+	if tx.Nonce != s.Nonces[tx.Sender] {
+		return ErrBadNonce
+	}
+	if s.Balances[tx.Sender] < tx.Amount {
+		return ErrOverdraft
+	}
+	s.Balances[tx.Sender] -= tx.Amount
+	s.Balances[tx.Recipient] += tx.Amount
+	s.Nonces[tx.Sender]++
+	return nil
+}
+
+// isCoinbase는 채굴 보상 거래인지 확인합니다. 보내는 쪽이 없고 서명도 없습니다.
+func isCoinbase(tx Transaction) bool {
+	return tx.Sender == "" && tx.Signature == ""
+}
+
+// newCoinbase는 블록 index를 채굴한 address에게 보상을 주는 거래를 만듭니다.
+// 순번 자리에 블록 번호를 넣어 블록마다 다른 거래가 되게 합니다.
+func newCoinbase(address string, index int) Transaction {
+	return Transaction{Recipient: address, Amount: blockReward, Nonce: uint64(index)}
+}
+
+// buildState는 chain 전체를 검사하면서 상태를 만듭니다. 유효하지 않으면 오류를 반환합니다.
+func buildState(chain []Block) (*State, error) {
+	if len(chain) == 0 || !isGenesisValid(chain[0]) {
+		return nil, errors.New("제네시스 블록이 올바르지 않습니다")
+	}
+	state := NewState()
+	for i := 1; i < len(chain); i++ {
+		if !isBlockValid(chain[i], chain[:i]) {
+			return nil, fmt.Errorf("블록 %d이(가) 유효하지 않습니다", chain[i].Index)
+		}
+		if err := state.ApplyBlock(chain[i]); err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func mustWallet(t *testing.T) *Wallet {
+	t.Helper()
+	w, err := NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestVerifyTransaction(t *testing.T) {
+	alice, bob := mustWallet(t), mustWallet(t)
+	valid := alice.Sign(bob.Address, 10, 0)
+
+	tests := []struct {
+		name   string
+		modify func(tx *Transaction)
+		want   bool
+	}{
+		{"valid", func(tx *Transaction) {}, true},
+		{"amount changed", func(tx *Transaction) { tx.Amount = 11 }, false},
+		{"recipient changed", func(tx *Transaction) { tx.Recipient = alice.Address }, false},
+		{"nonce changed", func(tx *Transaction) { tx.Nonce = 1 }, false},
+		{"sender is not the key owner", func(tx *Transaction) { tx.Sender = bob.Address }, false},
+		{"other public key", func(tx *Transaction) { tx.PublicKey = bob.PublicKey }, false},
+		{"signature not hex", func(tx *Transaction) { tx.Signature = "zz" + tx.Signature[2:] }, false},
+		{"signature truncated", func(tx *Transaction) { tx.Signature = tx.Signature[:len(tx.Signature)-2] }, false},
+		{"signature flipped", func(tx *Transaction) { tx.Signature = flipHex(tx.Signature) }, false},
+		{"no signature", func(tx *Transaction) { tx.Signature = "" }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := valid
+			tt.modify(&tx)
+			if got := verifyTransaction(tx); got != tt.want {
+				t.Errorf("verifyTransaction = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// flipHex는 16진수 문자열의 첫 글자를 다른 글자로 바꿉니다.
+func flipHex(s string) string {
+	if s[0] == '0' {
+		return "1" + s[1:]
+	}
+	return "0" + s[1:]
+}
+
+func TestApplyTransaction(t *testing.T) {
+	alice, bob := mustWallet(t), mustWallet(t)
+
+	tests := []struct {
+		name    string
+		balance int
+		nonce   uint64
+		tx      Transaction
+		want    error
+	}{
+		{"valid", 10, 0, alice.Sign(bob.Address, 10, 0), nil},
+		{"overdraft", 9, 0, alice.Sign(bob.Address, 10, 0), ErrOverdraft},
+		{"replayed nonce", 10, 1, alice.Sign(bob.Address, 5, 0), ErrBadNonce},
+		{"future nonce", 10, 0, alice.Sign(bob.Address, 5, 1), ErrBadNonce},
+		{"bad signature", 10, 0, func() Transaction { tx := alice.Sign(bob.Address, 5, 0); tx.Amount = 6; return tx }(), ErrBadSignature},
+		{"coinbase", 0, 0, newCoinbase(bob.Address, 1), ErrUnexpectedCoins},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := NewState()
+			state.Balances[alice.Address] = tt.balance
+			state.Nonces[alice.Address] = tt.nonce
+			err := state.ApplyTransaction(tt.tx)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("ApplyTransaction = %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				return
+			}
+			if state.Balances[alice.Address] != tt.balance-tt.tx.Amount || state.Balances[bob.Address] != tt.tx.Amount {
+				t.Errorf("balances = %d, %d", state.Balances[alice.Address], state.Balances[bob.Address])
+			}
+			if state.Nonces[alice.Address] != tt.nonce+1 {
+				t.Errorf("nonce = %d, want %d", state.Nonces[alice.Address], tt.nonce+1)
+			}
+		})
+	}
+}
+
+func TestApplyBlock(t *testing.T) {
+	alice, bob, miner := mustWallet(t), mustWallet(t), mustWallet(t)
+
+	tests := []struct {
+		name string
+		txs  []Transaction
+		want error
+	}{
+		{"coinbase and transfers", []Transaction{newCoinbase(miner.Address, 1), alice.Sign(bob.Address, 6, 0), alice.Sign(bob.Address, 4, 1)}, nil},
+		{"spend received coins", []Transaction{alice.Sign(bob.Address, 10, 0), bob.Sign(miner.Address, 10, 0)}, nil},
+		{"double spend", []Transaction{alice.Sign(bob.Address, 6, 0), alice.Sign(miner.Address, 6, 0)}, ErrBadNonce},
+		{"overdraft across transactions", []Transaction{alice.Sign(bob.Address, 6, 0), alice.Sign(bob.Address, 6, 1)}, ErrOverdraft},
+		{"coinbase not first", []Transaction{alice.Sign(bob.Address, 1, 0), newCoinbase(miner.Address, 1)}, ErrBadCoinbase},
+		{"coinbase wrong height", []Transaction{newCoinbase(miner.Address, 2)}, ErrBadCoinbase},
+		{"coinbase too large", []Transaction{{Recipient: miner.Address, Amount: blockReward + 1, Nonce: 1}}, ErrBadCoinbase},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := NewState()
+			state.Balances[alice.Address] = 10
+			err := state.ApplyBlock(Block{BlockHeader: BlockHeader{Index: 1}, Transactions: tt.txs})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("ApplyBlock = %v, want %v", err, tt.want)
+			}
+			if err == nil {
+				return
+			}
+			// 실패한 블록은 상태를 바꾸지 않아야 함
+			if len(state.Balances) != 1 || state.Balances[alice.Address] != 10 || len(state.Nonces) != 0 {
+				t.Errorf("state changed after failed block: %v %v", state.Balances, state.Nonces)
+			}
+		})
+	}
+}
+
+func TestValidAddress(t *testing.T) {
+	w := mustWallet(t)
+	tests := []struct {
+		address string
+		want    bool
+	}{
+		{w.Address, true},
+		{strings.ToUpper(w.Address), false},
+		{w.Address[:38], false},
+		{w.Address + "00", false},
+		{"", false},
+		{strings.Repeat("g", 40), false},
+	}
+	for _, tt := range tests {
+		if got := validAddress(tt.address); got != tt.want {
+			t.Errorf("validAddress(%q) = %v, want %v", tt.address, got, tt.want)
+		}
+	}
+}
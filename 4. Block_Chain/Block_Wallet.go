@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	addressLength     = 20            // 주소의 바이트 수 (공개 키 SHA-256의 앞부분)
+	defaultWalletPath = "wallet.json" // 지갑 명령이 쓰는 기본 키 파일
+	defaultNode       = "http://localhost:8080"
+)
+
+// Wallet은 ed25519 키 쌍 하나입니다. 개인 키는 시드(32바이트)만 저장합니다.
+type Wallet struct {
+	Address    string `json:"address"`
+	PublicKey  string `json:"public_key"`
+	PrivateKey string `json:"private_key"` // 시드 (16진수)
+	key        ed25519.PrivateKey
+}
+
+// NewWallet은 새 키 쌍을 만듭니다.
+func NewWallet() (*Wallet, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Wallet{
+		Address:    addressFromPublicKey(pub),
+		PublicKey:  hex.EncodeToString(pub),
+		PrivateKey: hex.EncodeToString(priv.Seed()),
+		key:        priv,
+	}, nil
+}
+
+// LoadWallet은 path의 지갑을 읽습니다.
+func LoadWallet(path string) (*Wallet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &Wallet{}
+	if err := json.Unmarshal(data, w); err != nil {
+		return nil, err
+	}
+	seed, err := hex.DecodeString(w.PrivateKey)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, errors.New("지갑의 개인 키가 올바르지 않습니다")
+	}
+	w.key = ed25519.NewKeyFromSeed(seed)
+	pub := w.key.Public().(ed25519.PublicKey)
+	w.PublicKey = hex.EncodeToString(pub)
+	w.Address = addressFromPublicKey(pub)
+	return w, nil
+}
+
+// Save는 지갑을 path에 저장합니다. 개인 키가 들어 있으므로 본인만 읽을 수 있게 합니다.
+// 이미 있는 지갑을 덮어쓰지 않습니다.
+func (w *Wallet) Save(path string) error {
+	data, err := json.MarshalIndent(w, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Sign은 recipient에게 amount를 보내는 거래를 만들고 서명합니다.
+func (w *Wallet) Sign(recipient string, amount int, nonce uint64) Transaction {
+	tx := Transaction{
+		Sender:    w.Address,
+		Recipient: recipient,
+		Amount:    amount,
+		Nonce:     nonce,
+		PublicKey: w.PublicKey,
+	}
+	tx.Signature = hex.EncodeToString(ed25519.Sign(w.key, signingBytes(tx)))
+	return tx
+}
+
+// addressFromPublicKey는 공개 키로 주소를 만듭니다. 공개 키 SHA-256의 앞 20바이트입니다.
+func addressFromPublicKey(pub ed25519.PublicKey) string {
+	hash := sha256.Sum256(pub)
+	return hex.EncodeToString(hash[:addressLength])
+}
+
+// validAddress는 address가 주소 형식(16진수 40자)인지 확인합니다.
+func validAddress(address string) bool {
+	raw, err := hex.DecodeString(address)
+	return err == nil && len(raw) == addressLength && address == strings.ToLower(address)
+}
+
+// signingBytes는 서명할 거래 내용입니다. 서명과 공개 키 자체는 들어가지 않습니다.
+func signingBytes(tx Transaction) []byte {
+	return appendTransactionBody(nil, tx)
+}
+
+// verifyTransaction은 공개 키가 보내는 주소의 것이고 서명이 맞는지 확인합니다.
+func verifyTransaction(tx Transaction) bool {
+	pub, err := hex.DecodeString(tx.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return false
+	}
+	sig, err := hex.DecodeString(tx.Signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return false
+	}
+	if addressFromPublicKey(pub) != tx.Sender {
+		return false
+	}
+	return ed25519.Verify(pub, signingBytes(tx), sig)
+}
+
+// Account는 /accounts/<주소>의 응답입니다.
+type Account struct {
+	Address   string `json:"address"`
+	Balance   int    `json:"balance"`    // 체인에 반영된 잔액
+	Nonce     uint64 `json:"nonce"`      // 체인에 반영된 다음 순번
+	NextNonce uint64 `json:"next_nonce"` // 대기 중인 거래까지 고려한 다음 순번
+}
+
+// 계정 조회 핸들러: GET /accounts/<주소>
+func handleAccount(w http.ResponseWriter, r *http.Request) {
+	address := strings.TrimPrefix(r.URL.Path, "/accounts/")
+	if !validAddress(address) {
+		http.Error(w, "잘못된 주소", http.StatusBadRequest)
+		return
+	}
+
+	mutex.Lock()
+	account := Account{Address: address, Balance: chainState.Balances[address], Nonce: chainState.Nonces[address]}
+	mutex.Unlock()
+	account.NextNonce = mempool.NextNonce(address, account.Nonce)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(account)
+}
+
+// runWalletCommand는 지갑 명령을 실행합니다.
+//
+//	wallet new                       새 키를 만들어 지갑 파일에 저장
+//	wallet address                   지갑 주소 출력
+//	wallet balance [주소]            잔액 조회 (주소를 빼면 지갑 주소)
+//	wallet sign <받는 주소> <금액> <순번>   서명한 거래를 JSON으로 출력 (노드에 보내지 않음)
+//	wallet send <받는 주소> <금액>    노드에서 순번을 받아 서명한 뒤 보냄
+//	wallet verify <거래 ID>          헤더와 머클 증명만 받아 거래가 체인에 담겼는지 확인
+//
+// 모든 명령에 -wallet <파일>과 -node <주소>를 줄 수 있습니다.
+func runWalletCommand(args []string) error {
+	usage := errors.New("사용법: wallet [-wallet 파일] [-node 주소] new | address | balance [주소] | sign <받는 주소> <금액> <순번> | send <받는 주소> <금액> | verify <거래 ID>")
+	fs := flag.NewFlagSet("wallet", flag.ContinueOnError)
+	walletPath := fs.String("wallet", defaultWalletPath, "키 파일")
+	node := fs.String("node", defaultNode, "거래를 보내고 잔액을 물어볼 노드")
+	if err := fs.Parse(args); err != nil {
+		return usage
+	}
+	args = fs.Args()
+	if len(args) == 0 {
+		return usage
+	}
+
+	if args[0] == "new" {
+		w, err := NewWallet()
+		if err != nil {
+			return err
+		}
+		if err := w.Save(*walletPath); err != nil {
+			return fmt.Errorf("지갑을 저장할 수 없습니다: %w", err)
+		}
+		fmt.Printf("새 지갑을 %s에 저장했습니다.\n주소: %s\n", *walletPath, w.Address)
+		return nil
+	}
+
+	// 다른 주소의 잔액 조회와 거래 확인에는 지갑 파일이 없어도 됨
+	if args[0] == "balance" && len(args) == 2 {
+		return printBalance(*node, args[1])
+	}
+	if args[0] == "verify" && len(args) == 2 {
+		return verifyTransactionOnNode(*node, args[1])
+	}
+
+	w, err := LoadWallet(*walletPath)
+	if err != nil {
+		return fmt.Errorf("지갑을 읽을 수 없습니다 (먼저 'wallet new'): %w", err)
+	}
+
+	switch {
+	case args[0] == "address" && len(args) == 1:
+		fmt.Println(w.Address)
+		return nil
+	case args[0] == "balance" && len(args) == 1:
+		return printBalance(*node, w.Address)
+	case args[0] == "sign" && len(args) == 4:
+		recipient, amount, err := parseTransfer(args[1], args[2])
+		if err != nil {
+			return err
+		}
+		nonce, err := strconv.ParseUint(args[3], 10, 64)
+		if err != nil {
+			return fmt.Errorf("잘못된 순번: %q", args[3])
+		}
+		data, _ := json.MarshalIndent(w.Sign(recipient, amount, nonce), "", "  ")
+		fmt.Println(string(data))
+		return nil
+	case args[0] == "send" && len(args) == 3:
+		recipient, amount, err := parseTransfer(args[1], args[2])
+		if err != nil {
+			return err
+		}
+		account, err := fetchAccount(*node, w.Address)
+		if err != nil {
+			return err
+		}
+		if account.Balance < amount {
+			fmt.Printf("경고: 체인에 반영된 잔액(%d)이 보내는 금액보다 적습니다.\n", account.Balance)
+		}
+		tx := w.Sign(recipient, amount, account.NextNonce)
+		jsonData, _ := json.Marshal(tx)
+		resp, err := http.Post(*node+"/transactions", "application/json", bytes.NewReader(jsonData))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("거래를 보내지 못했습니다: %s", strings.TrimSpace(string(body)))
+		}
+		fmt.Printf("거래를 보냈습니다: %s → %s: %d (순번 %d)\nID: %s\n", tx.Sender, tx.Recipient, tx.Amount, tx.Nonce, txID(tx))
+		return nil
+	}
+	return usage
+}
+
+// parseTransfer는 명령줄의 받는 주소와 금액을 검사합니다.
+func parseTransfer(recipient, amountStr string) (string, int, error) {
+	if !validAddress(recipient) {
+		return "", 0, fmt.Errorf("잘못된 주소: %q", recipient)
+	}
+	amount, err := strconv.Atoi(amountStr)
+	if err != nil || amount <= 0 {
+		return "", 0, fmt.Errorf("잘못된 금액: %q", amountStr)
+	}
+	return recipient, amount, nil
+}
+
+// getJSON은 url에 GET 요청을 보내 JSON 응답을 v에 읽습니다.
+func getJSON(url string, v any) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("요청 실패 (%s): %s", url, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// fetchAccount는 노드에서 계정 정보를 받아 옵니다.
+func fetchAccount(node, address string) (Account, error) {
+	var account Account
+	err := getJSON(node+"/accounts/"+address, &account)
+	return account, err
+}
+
+func printBalance(node, address string) error {
+	account, err := fetchAccount(node, address)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("주소: %s\n잔액: %d\n다음 순번: %d\n", account.Address, account.Balance, account.NextNonce)
+	return nil
+}
@@ -0,0 +1,5 @@
+module Block_Chain
+
+go 1.23.3
+
+require github.com/gorilla/websocket v1.5.3